@@ -0,0 +1,99 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/wu8685/lpv-res-predicate/cmd/predicate-server/app/options"
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+	"github.com/wu8685/lpv-res-predicate/pkg/handlers/predicate"
+)
+
+func NewAnnotateCommand() *cobra.Command {
+	opts := options.NewAnnotateOptions()
+
+	cmd := &cobra.Command{
+		Use:   "annotate",
+		Short: "Set, change or remove the reservation annotations of persistent volumes",
+		Long: `Set, change or remove the reservation annotations of the local persistent volumes selected by label, StorageClass,
+node or name pattern. An annotation already set to another value is only changed with --overwrite.
+The PVs are updated through the API server with optimistic concurrency, so that a PV modified concurrently
+is read again and the change is applied on the latest one. --dry-run prints the changes without updating.
+It exits with 1 if any PV fails to be annotated.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := annotate(os.Stdout, opts); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	opts.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+func annotate(out io.Writer, opts *options.AnnotateOptions) error {
+	if err := completeOptions(opts.Options, opts.Validate); err != nil {
+		return err
+	}
+
+	selector := predicate.PVSelector{
+		StorageClass: opts.StorageClass,
+		Node:         opts.Node,
+		NamePattern:  opts.NamePattern,
+	}
+	if len(opts.LabelSelector) > 0 {
+		var err error
+		if selector.Labels, err = labels.Parse(opts.LabelSelector); err != nil {
+			return fmt.Errorf("invalid --selector: %s", err)
+		}
+	}
+	change := predicate.ReservationChange{Overwrite: opts.Overwrite}
+	for _, c := range []struct {
+		value  string
+		remove bool
+		change **string
+	}{
+		{opts.Cpu, opts.RemoveCpu, &change.Cpu},
+		{opts.Memory, opts.RemoveMemory, &change.Mem},
+	} {
+		if len(c.value) > 0 || c.remove {
+			value := c.value
+			*c.change = &value
+		}
+	}
+
+	objects, client, err := clusterObjects(&opts.ClusterOptions)
+	if err != nil {
+		return err
+	}
+	cfg := &config.Config{Client: client, Options: newOptionConfig(opts.Options)}
+
+	results, err := predicate.Annotate(cfg, objects, selector, change, opts.DryRun)
+	if err != nil {
+		return err
+	}
+	if err := predicate.WriteAnnotations(out, results, opts.Output); err != nil {
+		return err
+	}
+	return failedAnnotations(results)
+}
+
+// failedAnnotations returns an error if any PV fails to be annotated.
+func failedAnnotations(results []predicate.PVAnnotation) error {
+	failed := 0
+	for _, result := range results {
+		if len(result.Error) > 0 {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("fail to annotate %d of %d persistent volumes", failed, len(results))
+	}
+	return nil
+}
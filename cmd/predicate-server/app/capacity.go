@@ -0,0 +1,61 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/wu8685/lpv-res-predicate/cmd/predicate-server/app/options"
+	"github.com/wu8685/lpv-res-predicate/pkg/handlers/predicate"
+)
+
+func NewCapacityCommand() *cobra.Command {
+	opts := options.NewCapacityOptions()
+
+	cmd := &cobra.Command{
+		Use:   "capacity",
+		Short: "Report how many more pods of a shape fit on the nodes",
+		Long: `Report how many more pods of the shape given by --cpu and --memory fit on each node and in total,
+separately for the pods mounting a reserved local PV, which fit in the reservation left on the PVs,
+and for the pods without reserved local PV, which fit in the resources left after the reservation.
+The cluster is read from the API server, or from the files given by --filename.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := reportCapacity(os.Stdout, opts); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	opts.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+func reportCapacity(out io.Writer, opts *options.CapacityOptions) error {
+	if err := completeOptions(opts.Options, opts.Validate); err != nil {
+		return err
+	}
+	shape, err := predicate.ParsePodShape(opts.Cpu, opts.Memory)
+	if err != nil {
+		return err
+	}
+	selector, err := labels.Parse(opts.NodeSelector)
+	if err != nil {
+		return fmt.Errorf("invalid --selector: %s", err)
+	}
+
+	objects, _, err := clusterObjects(&opts.ClusterOptions)
+	if err != nil {
+		return err
+	}
+
+	report, err := predicate.Capacity(newOptionConfig(opts.Options), objects, selector, shape)
+	if err != nil {
+		return err
+	}
+	return predicate.WriteCapacityReport(out, report, opts.Output)
+}
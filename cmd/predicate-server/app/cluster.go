@@ -0,0 +1,41 @@
+package app
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/wu8685/lpv-res-predicate/cmd/predicate-server/app/options"
+)
+
+// completeOptions overrides the options of a subcommand with the configuration file if provided, then validates them.
+func completeOptions(opts *options.Options, validate func() []error) error {
+	if len(opts.ConfigFile) > 0 {
+		if err := opts.ApplyConfigFile(opts.ConfigFile); err != nil {
+			return err
+		}
+	}
+	if errs := validate(); len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+	return nil
+}
+
+// clusterObjects reads the objects of the cluster from the files given by --filename, or lists them from the API server.
+// The client of the API server is returned as well, or nil if the objects are read from the files.
+func clusterObjects(opts *options.ClusterOptions) ([]runtime.Object, kubernetes.Interface, error) {
+	if len(opts.ClusterFiles) > 0 {
+		objects, err := loadObjects(opts.ClusterFiles)
+		return objects, nil, err
+	}
+
+	client, err := newClient(opts.Options)
+	if err != nil {
+		return nil, nil, err
+	}
+	objects, err := listObjects(client)
+	if err != nil {
+		return nil, nil, err
+	}
+	return objects, client, nil
+}
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/util/diff"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/wu8685/lpv-res-predicate/cmd/predicate-server/app/options"
+	"github.com/wu8685/lpv-res-predicate/pkg"
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+)
+
+const configCheckPeriod = 5 * time.Second
+
+// configWatcher reloads the options once the config file is changed.
+// The file is always applied onto the flags, so that the fields removed from the file fall back to the flags.
+type configWatcher struct {
+	flagOpts *options.Options
+
+	data    []byte
+	current *options.Options
+}
+
+func newConfigWatcher(flagOpts *options.Options) *configWatcher {
+	copied := *flagOpts
+	return &configWatcher{
+		flagOpts: &copied,
+	}
+}
+
+// load reads the config file and returns the validated options.
+func (w *configWatcher) load() (*options.Options, error) {
+	data, err := ioutil.ReadFile(w.flagOpts.ConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read config file %s: %s", w.flagOpts.ConfigFile, err)
+	}
+
+	opts, err := w.apply(data)
+	if err != nil {
+		return nil, err
+	}
+
+	w.data = data
+	w.current = opts
+	return opts, nil
+}
+
+// apply returns the options even if they are invalid, as long as the file can be decoded.
+func (w *configWatcher) apply(data []byte) (*options.Options, error) {
+	opts := *w.flagOpts
+	if err := opts.ApplyConfigData(opts.ConfigFile, data); err != nil {
+		return nil, err
+	}
+
+	if errs := opts.Validate(); len(errs) > 0 {
+		return &opts, utilerrors.NewAggregate(errs)
+	}
+	return &opts, nil
+}
+
+func (w *configWatcher) Run(svr *pkg.PredicateServer, running *config.OptionConfig, stopCh <-chan struct{}) {
+	glog.V(0).Infof("Watch config file %s", w.flagOpts.ConfigFile)
+	wait.Until(func() {
+		var err error
+		if running, err = w.check(svr, running); err != nil {
+			glog.Errorf("%s", err)
+		}
+	}, configCheckPeriod, stopCh)
+}
+
+// check reloads the config file if changed, and returns the options running after that.
+// The running options are kept if the file is failed to read or rejected.
+func (w *configWatcher) check(svr *pkg.PredicateServer, running *config.OptionConfig) (*config.OptionConfig, error) {
+	file := w.flagOpts.ConfigFile
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return running, fmt.Errorf("fail to read config file %s: %s", file, err)
+	}
+
+	if bytes.Equal(data, w.data) {
+		return running, nil
+	}
+	w.data = data
+
+	opts, err := w.apply(data)
+	if err != nil {
+		if opts != nil {
+			return running, fmt.Errorf("reject invalid config file %s: %s, diff from the running options:\n%s", file, err, diff.ObjectReflectDiff(w.current, opts))
+		}
+		return running, fmt.Errorf("reject invalid config file %s: %s", file, err)
+	}
+	w.current = opts
+
+	loaded := newOptionConfig(opts)
+	reloaded := running.WithReloadable(loaded)
+	if !reflect.DeepEqual(reloaded, loaded) {
+		glog.Warningf("Options requiring restart are changed in config file %s, which are ignored until restart:\n%s", file, diff.ObjectReflectDiff(reloaded, loaded))
+	}
+
+	if reflect.DeepEqual(reloaded, running) {
+		glog.V(1).Infof("No option to reload in config file %s", file)
+		return running, nil
+	}
+
+	glog.V(0).Infof("Reload options from config file %s:\n%s", file, diff.ObjectReflectDiff(running, reloaded))
+	svr.Reload(reloaded)
+	return reloaded, nil
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wu8685/lpv-res-predicate/cmd/predicate-server/app/options"
+	"github.com/wu8685/lpv-res-predicate/pkg"
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+)
+
+const watchedConfig = `
+apiVersion: lpvrespredicate.config/v1alpha1
+kind: PredicateServerConfiguration
+reservedCpuAnnotationKey: reserved-cpu
+filterFailurePolicy: %s
+`
+
+func TestConfigWatcherCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configwatcher")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "config.yaml")
+	writeConfig := func(failurePolicy string) {
+		if err := ioutil.WriteFile(file, []byte(fmt.Sprintf(watchedConfig, failurePolicy)), 0644); err != nil {
+			t.Fatalf("unexpected err: %s", err)
+		}
+	}
+
+	flagOpts := options.NewOptions()
+	flagOpts.Master = "https://127.0.0.1:6443"
+	flagOpts.ConfigFile = file
+	writeConfig("fail-node")
+
+	watcher := newConfigWatcher(flagOpts)
+	opts, err := watcher.load()
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	running := newOptionConfig(opts)
+	svr := pkg.NewPredicateServer(&config.Config{Options: running})
+
+	// an unchanged file is a no-op
+	checked, err := watcher.check(svr, running)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if checked != running {
+		t.Fatalf("expected the running options kept for an unchanged file, got %+v", checked)
+	}
+
+	// a valid change is swapped in
+	writeConfig("pass-node")
+	checked, err = watcher.check(svr, running)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if checked == running || checked.FilterFailurePolicy != "pass-node" {
+		t.Fatalf("expected the failure policy reloaded, got %s", checked.FilterFailurePolicy)
+	}
+	if running.FilterFailurePolicy != "fail-node" {
+		t.Fatalf("expected the previous options not modified, got %s", running.FilterFailurePolicy)
+	}
+	running = checked
+
+	// an invalid file is rejected with the diff from the running options
+	writeConfig("unknown")
+	checked, err = watcher.check(svr, running)
+	if err == nil {
+		t.Fatal("expected err for invalid config file")
+	}
+	if checked != running {
+		t.Fatalf("expected the running options kept for an invalid file, got %+v", checked)
+	}
+	for _, expected := range []string{"--filter-failure-policy unknown", "object.FilterFailurePolicy:", "a: \"pass-node\"", "b: \"unknown\""} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected %q in err: %s", expected, err)
+		}
+	}
+
+	// the rejected file is not checked again until changed
+	checked, err = watcher.check(svr, running)
+	if err != nil || checked != running {
+		t.Fatalf("expected the rejected file skipped, got %+v with err %v", checked, err)
+	}
+	if watcher.current.FilterFailurePolicy != "pass-node" {
+		t.Fatalf("expected the last valid options kept, got %s", watcher.current.FilterFailurePolicy)
+	}
+}
@@ -0,0 +1,30 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/wu8685/lpv-res-predicate/cmd/predicate-server/app/options"
+	"github.com/wu8685/lpv-res-predicate/pkg"
+)
+
+// listHandlers prints the registered handlers with whether they are enabled and where they are mounted.
+func listHandlers(out io.Writer, opts *options.Options) error {
+	// the other options are not validated, since the server is not run
+	if len(opts.ConfigFile) > 0 {
+		loaded := *opts
+		if err := loaded.ApplyConfigFile(opts.ConfigFile); err != nil {
+			return err
+		}
+		opts = &loaded
+	}
+
+	optionConfig := newOptionConfig(opts)
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tENABLED\tPATH")
+	for _, name := range pkg.RegisteredHandlers() {
+		fmt.Fprintf(w, "%s\t%v\t%s\n", name, pkg.IsHandlerEnabled(name, opts.Handlers), pkg.HandlerPath(optionConfig, name, ""))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/wu8685/lpv-res-predicate/cmd/predicate-server/app/options"
+	"github.com/wu8685/lpv-res-predicate/pkg/handlers/predicate"
+)
+
+// lintFindingsExitCode is the exit code of the lint subcommand if there is any finding,
+// distinguished from the exit code 1 on errors.
+const lintFindingsExitCode = 2
+
+func NewLintCommand() *cobra.Command {
+	opts := options.NewLintOptions()
+
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Audit the reservation annotations of the persistent volumes",
+		Long: `Audit the reservation annotations of every persistent volume and report the quantities which can not be parsed,
+the reservations on PVs which are not local, the local PVs with missing or malformed NodeAffinity or matching no node,
+the reservations more than the allocatable of their node, and the nodes whose reservations add up to more than their allocatable.
+The cluster is read from the API server, or from the files given by --filename.
+It exits with 2 if there is any finding, and with 1 on errors.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			findings, err := lint(os.Stdout, opts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			if findings > 0 {
+				os.Exit(lintFindingsExitCode)
+			}
+		},
+	}
+
+	opts.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+// lint writes the findings and returns how many there are.
+func lint(out io.Writer, opts *options.LintOptions) (int, error) {
+	if err := completeOptions(opts.Options, opts.Validate); err != nil {
+		return 0, err
+	}
+
+	objects, _, err := clusterObjects(&opts.ClusterOptions)
+	if err != nil {
+		return 0, err
+	}
+
+	findings, err := predicate.Lint(newOptionConfig(opts.Options), objects)
+	if err != nil {
+		return 0, err
+	}
+	return len(findings), predicate.WriteLintFindings(out, findings, opts.Output)
+}
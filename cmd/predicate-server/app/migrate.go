@@ -0,0 +1,59 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/wu8685/lpv-res-predicate/cmd/predicate-server/app/options"
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+	"github.com/wu8685/lpv-res-predicate/pkg/handlers/predicate"
+)
+
+func NewMigrateCommand() *cobra.Command {
+	opts := options.NewMigrateOptions()
+
+	cmd := &cobra.Command{
+		Use:   "migrate-annotations",
+		Short: "Copy the reservation annotations of persistent volumes from the alias keys to the keys",
+		Long: `Copy the reservation annotations of the local persistent volumes from the keys given by
+--reserved-cpu-annotation-key-aliases and --reserved-mem-annotation-key-aliases to the keys given by
+--reserved-cpu-annotation-key and --reserved-mem-annotation-key. The aliases are kept unless --remove-aliases.
+A PV whose key and aliases have different values is reported as a conflict and left unchanged.
+The PVs are updated through the API server with optimistic concurrency, the same as the annotate subcommand.
+It exits with 1 if any PV conflicts or fails to be updated.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := migrate(os.Stdout, opts); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	opts.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+func migrate(out io.Writer, opts *options.MigrateOptions) error {
+	if err := completeOptions(opts.Options, opts.Validate); err != nil {
+		return err
+	}
+
+	objects, client, err := clusterObjects(&opts.ClusterOptions)
+	if err != nil {
+		return err
+	}
+	cfg := &config.Config{Client: client, Options: newOptionConfig(opts.Options)}
+
+	results, err := predicate.MigrateAnnotations(cfg, objects, opts.RemoveAliases, opts.DryRun)
+	if err != nil {
+		return err
+	}
+	if err := predicate.WriteAnnotations(out, results, opts.Output); err != nil {
+		return err
+	}
+	return failedAnnotations(results)
+}
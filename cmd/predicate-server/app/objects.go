@@ -0,0 +1,197 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/wu8685/lpv-res-predicate/cmd/predicate-server/app/options"
+	"github.com/wu8685/lpv-res-predicate/pkg/informers"
+)
+
+// loadObjects decodes the Kubernetes objects in the files, or in the .yaml, .yml and .json files of the directories,
+// such as dumped by 'kubectl get -o yaml'. A file may hold multiple YAML documents, and lists are flattened into their items.
+// The objects of kinds not known to the client are skipped, and the pods and claims without a namespace are in the default one, as kubectl does.
+func loadObjects(paths []string) ([]runtime.Object, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			switch filepath.Ext(entry.Name()) {
+			case ".yaml", ".yml", ".json":
+				if !entry.IsDir() {
+					files = append(files, filepath.Join(path, entry.Name()))
+				}
+			}
+		}
+	}
+
+	objects := []runtime.Object{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		decoded, err := decodeObjects(data)
+		if err != nil {
+			return nil, fmt.Errorf("fail to decode objects in %s: %s", file, err)
+		}
+		for _, obj := range decoded {
+			defaultNamespace(obj)
+		}
+		objects = append(objects, decoded...)
+	}
+	return objects, nil
+}
+
+func decodeObjects(data []byte) ([]runtime.Object, error) {
+	objects := []runtime.Object{}
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		raw := runtime.RawExtension{}
+		if err := decoder.Decode(&raw); err == io.EOF {
+			return objects, nil
+		} else if err != nil {
+			return nil, err
+		}
+		// an empty document
+		if len(raw.Raw) == 0 || string(raw.Raw) == "null" {
+			continue
+		}
+
+		decoded, err := decodeObject(raw.Raw)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, decoded...)
+	}
+}
+
+func decodeObject(data []byte) ([]runtime.Object, error) {
+	obj, gvk, err := scheme.Codecs.UniversalDeserializer().Decode(data, nil, nil)
+	if runtime.IsNotRegisteredError(err) {
+		glog.Warningf("Skip object of unknown kind: %s", err)
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if !meta.IsListType(obj) {
+		return []runtime.Object{obj}, nil
+	}
+
+	items, err := meta.ExtractList(obj)
+	if err != nil {
+		return nil, fmt.Errorf("fail to extract items of %s: %s", gvk.Kind, err)
+	}
+	objects := []runtime.Object{}
+	for _, item := range items {
+		// the items of a v1 List are left undecoded
+		if unknown, ok := item.(*runtime.Unknown); ok {
+			decoded, err := decodeObject(unknown.Raw)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, decoded...)
+			continue
+		}
+		objects = append(objects, item)
+	}
+	return objects, nil
+}
+
+// defaultNamespace sets the namespace of a pod or a claim written without one, so that the claims of the pod are found.
+func defaultNamespace(obj runtime.Object) {
+	switch o := obj.(type) {
+	case *v1.Pod:
+		if len(o.Namespace) == 0 {
+			o.Namespace = metav1.NamespaceDefault
+		}
+	case *v1.PersistentVolumeClaim:
+		if len(o.Namespace) == 0 {
+			o.Namespace = metav1.NamespaceDefault
+		}
+	}
+}
+
+// podsOf returns the pods in the objects, and fails if there is another kind of object.
+func podsOf(objects []runtime.Object) ([]*v1.Pod, error) {
+	pods := make([]*v1.Pod, 0, len(objects))
+	for _, obj := range objects {
+		pod, ok := obj.(*v1.Pod)
+		if !ok {
+			return nil, fmt.Errorf("expecting pods, got %T", obj)
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+// listObjects lists the nodes, pods, persistent volumes and claims read by the predicate from the API server,
+// with the same pods as cached by the informers.
+func listObjects(client kubernetes.Interface) ([]runtime.Object, error) {
+	objects := []runtime.Object{}
+	lists := []func() (runtime.Object, error){
+		func() (runtime.Object, error) {
+			return client.CoreV1().Nodes().List(metav1.ListOptions{})
+		},
+		func() (runtime.Object, error) {
+			return client.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{FieldSelector: informers.ScheduledPodSelector})
+		},
+		func() (runtime.Object, error) {
+			return client.CoreV1().PersistentVolumes().List(metav1.ListOptions{})
+		},
+		func() (runtime.Object, error) {
+			return client.CoreV1().PersistentVolumeClaims(metav1.NamespaceAll).List(metav1.ListOptions{})
+		},
+	}
+	for _, list := range lists {
+		listed, err := list()
+		if err != nil {
+			return nil, err
+		}
+		items, err := meta.ExtractList(listed)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, items...)
+	}
+	return objects, nil
+}
+
+// newClient returns the client of the API server given by --master and --kubeconfig.
+func newClient(opts *options.Options) (kubernetes.Interface, error) {
+	cfg, err := clientcmd.BuildConfigFromFlags(opts.Master, opts.KubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error building kubeconfig: %s", err.Error())
+	}
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error building kubernetes clientset: %s", err.Error())
+	}
+	return client, nil
+}
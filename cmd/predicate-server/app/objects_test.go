@@ -0,0 +1,116 @@
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const multiDocuments = `
+apiVersion: v1
+kind: Node
+metadata:
+  name: node1
+---
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: PersistentVolume
+  metadata:
+    name: pv1
+- apiVersion: v1
+  kind: PersistentVolumeClaim
+  metadata:
+    name: pvc1
+    namespace: test
+---
+apiVersion: example.com/v1
+kind: Unknown
+metadata:
+  name: skipped
+`
+
+const podList = `{
+  "apiVersion": "v1",
+  "kind": "PodList",
+  "items": [
+    {"metadata": {"name": "pod1"}, "spec": {"volumes": [{"name": "data", "persistentVolumeClaim": {"claimName": "pvc1"}}]}},
+    {"metadata": {"name": "pod2", "namespace": "test"}}
+  ]
+}`
+
+func TestLoadObjects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "objects")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	clusterDir := filepath.Join(dir, "cluster")
+	if err := os.Mkdir(clusterDir, 0755); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	for name, content := range map[string]string{
+		"cluster.yaml": multiDocuments,
+		"README.md":    "not loaded",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(clusterDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("unexpected err: %s", err)
+		}
+	}
+	podFile := filepath.Join(dir, "pods.json")
+	if err := ioutil.WriteFile(podFile, []byte(podList), 0644); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	objects, err := loadObjects([]string{clusterDir})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if keys := objectKeys(t, objects); !reflect.DeepEqual(keys, []string{"*v1.Node /node1", "*v1.PersistentVolume /pv1", "*v1.PersistentVolumeClaim test/pvc1"}) {
+		t.Fatalf("unexpected objects %v", keys)
+	}
+
+	objects, err = loadObjects([]string{podFile})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	pods, err := podsOf(objects)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	// the pod without a namespace is in the default one
+	if keys := objectKeys(t, objects); !reflect.DeepEqual(keys, []string{"*v1.Pod default/pod1", "*v1.Pod test/pod2"}) {
+		t.Fatalf("unexpected pods %v", keys)
+	}
+	if claim := pods[0].Spec.Volumes[0].PersistentVolumeClaim; claim == nil || claim.ClaimName != "pvc1" {
+		t.Fatalf("expecting the claim of pod1 decoded, got %+v", pods[0].Spec.Volumes)
+	}
+
+	if _, err := podsOf([]runtime.Object{&v1.Pod{}, &v1.Node{}}); err == nil {
+		t.Fatal("expecting err for a node in the pods")
+	}
+	if _, err := decodeObjects([]byte("kind: [")); err == nil {
+		t.Fatal("expecting err for malformed YAML")
+	}
+}
+
+func objectKeys(t *testing.T, objects []runtime.Object) []string {
+	keys := []string{}
+	for _, obj := range objects {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			t.Fatalf("unexpected err: %s", err)
+		}
+		keys = append(keys, reflect.TypeOf(obj).String()+" "+accessor.GetNamespace()+"/"+accessor.GetName())
+	}
+	return keys
+}
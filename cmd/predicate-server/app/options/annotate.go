@@ -0,0 +1,85 @@
+package options
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// AnnotateOptions are the options of the annotate subcommand, which sets, changes or removes the reservation annotations of PVs.
+type AnnotateOptions struct {
+	// the options of the reservation annotation keys, how to connect to the API server and the files to annotate on dry run
+	ClusterOptions
+
+	LabelSelector string
+	StorageClass  string
+	Node          string
+	NamePattern   string
+	All           bool
+
+	Cpu          string
+	Memory       string
+	RemoveCpu    bool
+	RemoveMemory bool
+	Overwrite    bool
+
+	DryRun bool
+	Output string
+}
+
+func NewAnnotateOptions() *AnnotateOptions {
+	return &AnnotateOptions{
+		ClusterOptions: newClusterOptions(),
+		Output:         "diff",
+	}
+}
+
+func (o *AnnotateOptions) AddFlags(fs *pflag.FlagSet) {
+	o.addFlags(fs, clusterFlagUsages{
+		config:  "the reservation annotation keys and the API server",
+		cluster: "the cluster whose PVs are annotated",
+		files:   "the nodes and persistent volumes to annotate on dry run",
+	})
+
+	fs.StringVarP(&o.LabelSelector, "selector", "l", o.LabelSelector, "the label selector of the PVs to annotate")
+	fs.StringVar(&o.StorageClass, "storage-class", o.StorageClass, "the StorageClass of the PVs to annotate")
+	fs.StringVar(&o.Node, "node", o.Node, "the node whose local PVs are annotated")
+	fs.StringVar(&o.NamePattern, "name", o.NamePattern, "the shell pattern of the names of the PVs to annotate, such as 'ssd-*'")
+	fs.BoolVar(&o.All, "all", o.All, "annotate all the local PVs, required if none of --selector, --storage-class, --node and --name is provided")
+
+	fs.StringVar(&o.Cpu, "cpu", o.Cpu, "the quantity to set the reserved cpu annotation to")
+	fs.StringVar(&o.Memory, "memory", o.Memory, "the quantity to set the reserved memory annotation to")
+	fs.BoolVar(&o.RemoveCpu, "remove-cpu", o.RemoveCpu, "remove the reserved cpu annotation and its aliases")
+	fs.BoolVar(&o.RemoveMemory, "remove-memory", o.RemoveMemory, "remove the reserved memory annotation and its aliases")
+	fs.BoolVar(&o.Overwrite, "overwrite", o.Overwrite, "change the annotations already set to another value, otherwise such PVs are left unchanged and reported as failed")
+
+	fs.BoolVar(&o.DryRun, "dry-run", o.DryRun, "only print the changes without updating the PVs")
+	fs.StringVarP(&o.Output, "output", "o", o.Output, "the output format, 'diff' or 'json'")
+}
+
+func (o *AnnotateOptions) Validate() []error {
+	errs := []error{}
+
+	if len(o.ClusterFiles) > 0 && !o.DryRun {
+		errs = append(errs, fmt.Errorf("--filename is only supported with --dry-run"))
+	}
+	errs = append(errs, o.validateClusterSource()...)
+	errs = append(errs, o.validateReservationFlags()...)
+	selected := len(o.LabelSelector) > 0 || len(o.StorageClass) > 0 || len(o.Node) > 0 || len(o.NamePattern) > 0
+	if selected == o.All {
+		errs = append(errs, fmt.Errorf("either --all or some of --selector, --storage-class, --node and --name should be provided"))
+	}
+	if len(o.Cpu) > 0 && o.RemoveCpu {
+		errs = append(errs, fmt.Errorf("--cpu and --remove-cpu are exclusive"))
+	}
+	if len(o.Memory) > 0 && o.RemoveMemory {
+		errs = append(errs, fmt.Errorf("--memory and --remove-memory are exclusive"))
+	}
+	if len(o.Cpu) == 0 && len(o.Memory) == 0 && !o.RemoveCpu && !o.RemoveMemory {
+		errs = append(errs, fmt.Errorf("none of --cpu, --memory, --remove-cpu and --remove-memory is provided"))
+	}
+	if o.Output != "diff" && o.Output != "json" {
+		errs = append(errs, fmt.Errorf("--output %s should be diff or json", o.Output))
+	}
+	return errs
+}
@@ -0,0 +1,51 @@
+package options
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// CapacityOptions are the options of the capacity subcommand, which reports how many more pods of a shape fit on the nodes.
+type CapacityOptions struct {
+	// the options of how the reservation is read and where the cluster is read from
+	ClusterOptions
+
+	Cpu          string
+	Memory       string
+	NodeSelector string
+	Output       string
+}
+
+func NewCapacityOptions() *CapacityOptions {
+	return &CapacityOptions{
+		ClusterOptions: newClusterOptions(),
+		Output:         "table",
+	}
+}
+
+func (o *CapacityOptions) AddFlags(fs *pflag.FlagSet) {
+	o.addFlags(fs, clusterFlagUsages{
+		config:  "the reservation options and the API server",
+		cluster: "the cluster to report",
+		files:   "the nodes, pods, persistent volumes and claims to report",
+	})
+	fs.StringVar(&o.Cpu, "cpu", o.Cpu, "the cpu request of the pod shape")
+	fs.StringVar(&o.Memory, "memory", o.Memory, "the memory request of the pod shape")
+	fs.StringVarP(&o.NodeSelector, "selector", "l", o.NodeSelector, "the label selector of the nodes to report, all the nodes if empty")
+	fs.StringVarP(&o.Output, "output", "o", o.Output, "the output format, 'table', 'json' or 'csv'")
+}
+
+func (o *CapacityOptions) Validate() []error {
+	errs := []error{}
+
+	errs = append(errs, o.validateClusterSource()...)
+	errs = append(errs, o.validateReservationFlags()...)
+	if len(o.Cpu) == 0 || len(o.Memory) == 0 {
+		errs = append(errs, fmt.Errorf("--cpu and --memory are required"))
+	}
+	if o.Output != "table" && o.Output != "json" && o.Output != "csv" {
+		errs = append(errs, fmt.Errorf("--output %s should be table, json or csv", o.Output))
+	}
+	return errs
+}
@@ -0,0 +1,50 @@
+package options
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// ClusterOptions are the options of the subcommands reading the cluster from the API server,
+// or from the files given by --filename instead.
+type ClusterOptions struct {
+	// the options of how the reservation is read and how to connect to the API server,
+	// overridden by the configuration file if provided
+	*Options
+
+	ClusterFiles []string
+}
+
+func newClusterOptions() ClusterOptions {
+	return ClusterOptions{
+		Options: NewOptions(),
+	}
+}
+
+// clusterFlagUsages complete the usages of the flags added by ClusterOptions.addFlags with what a subcommand reads.
+type clusterFlagUsages struct {
+	// what is taken from the configuration file, such as "the reservation options and the API server"
+	config string
+	// the cluster read from the API server, such as "the cluster to audit"
+	cluster string
+	// the objects read from --filename, such as "the nodes and persistent volumes to audit"
+	files string
+}
+
+// addFlags adds --config, --kubeconfig, --master, --filename and the reservation flags.
+func (o *ClusterOptions) addFlags(fs *pflag.FlagSet, usages clusterFlagUsages) {
+	fs.StringVar(&o.ConfigFile, "config", o.ConfigFile, fmt.Sprintf("Path to a PredicateServerConfiguration file to take %s from, whose fields override the flags.", usages.config))
+	fs.StringVar(&o.KubeConfig, "kubeconfig", o.KubeConfig, fmt.Sprintf("Path to a kubeconfig file of %s, unless --filename is provided.", usages.cluster))
+	fs.StringVar(&o.Master, "master", o.Master, "The address of the Kubernetes API server (overrides any value in kubeconfig)")
+	o.addReservationFlags(fs)
+	fs.StringSliceVarP(&o.ClusterFiles, "filename", "f", o.ClusterFiles, fmt.Sprintf("YAML or JSON files of %s instead of the cluster of the API server, such as dumped by 'kubectl get -o yaml'. A directory loads its .yaml, .yml and .json files.", usages.files))
+}
+
+// validateClusterSource requires the cluster to be read from --filename or the API server.
+func (o *ClusterOptions) validateClusterSource() []error {
+	if len(o.ClusterFiles) == 0 && len(o.KubeConfig) == 0 && len(o.Master) == 0 {
+		return []error{fmt.Errorf("neither --filename, --kubeconfig nor --master is provided")}
+	}
+	return nil
+}
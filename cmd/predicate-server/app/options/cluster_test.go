@@ -0,0 +1,59 @@
+package options
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestSubcommandsValidateReservationFlags(t *testing.T) {
+	subcommands := map[string]interface {
+		AddFlags(fs *pflag.FlagSet)
+		Validate() []error
+	}{
+		"annotate": NewAnnotateOptions(),
+		"capacity": NewCapacityOptions(),
+		"lint":     NewLintOptions(),
+		"migrate":  NewMigrateOptions(),
+		"replay":   NewReplayOptions(),
+		"simulate": NewSimulateOptions(),
+	}
+	for name, opts := range subcommands {
+		fs := pflag.NewFlagSet(name, pflag.ContinueOnError)
+		opts.AddFlags(fs)
+		if err := fs.Parse([]string{"--reserved-cpu-annotation-key-aliases=old,old"}); err != nil {
+			t.Fatalf("%s: unexpected err: %s", name, err)
+		}
+
+		found := false
+		for _, err := range opts.Validate() {
+			found = found || strings.HasPrefix(err.Error(), "--reserved-cpu-annotation-key-aliases")
+		}
+		if !found {
+			t.Fatalf("%s: expecting the duplicated alias rejected", name)
+		}
+	}
+}
+
+func TestValidateClusterSource(t *testing.T) {
+	for _, c := range []struct {
+		args  []string
+		valid bool
+	}{
+		{nil, false},
+		{[]string{"--filename=cluster.yaml"}, true},
+		{[]string{"--kubeconfig=kubeconfig"}, true},
+		{[]string{"--master=https://127.0.0.1:6443"}, true},
+	} {
+		opts := newClusterOptions()
+		fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		opts.addFlags(fs, clusterFlagUsages{})
+		if err := fs.Parse(c.args); err != nil {
+			t.Fatalf("unexpected err: %s", err)
+		}
+		if errs := opts.validateClusterSource(); (len(errs) == 0) != c.valid {
+			t.Fatalf("expecting %v valid %v, got %v", c.args, c.valid, errs)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package options
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ghodss/yaml"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ConfigAPIVersion = "lpvrespredicate.config/v1alpha1"
+	ConfigKind       = "PredicateServerConfiguration"
+)
+
+// PredicateServerConfiguration is the versioned configuration file of the predicate server.
+// Each field corresponds to a flag, and the flag value is kept if the field is omitted.
+type PredicateServerConfiguration struct {
+	metav1.TypeMeta `json:",inline"`
+
+	KubeConfig string `json:"kubeConfig"`
+	Master     string `json:"master"`
+	ListenPort int    `json:"listenPort"`
+
+	TLSCertFile       string `json:"tlsCertFile"`
+	TLSPrivateKeyFile string `json:"tlsPrivateKeyFile"`
+	ClientCAFile      string `json:"clientCAFile"`
+
+	MaxRequestBodyBytes int64           `json:"maxRequestBodyBytes"`
+	RequestTimeout      metav1.Duration `json:"requestTimeout"`
+
+	Handlers            []string          `json:"handlers"`
+	HandlerPathPrefixes map[string]string `json:"handlerPathPrefixes"`
+	PathPrefix          string            `json:"pathPrefix"`
+
+	DelegatedAuth DelegatedAuthConfiguration `json:"delegatedAuth"`
+
+	CacheSyncTimeout    metav1.Duration `json:"cacheSyncTimeout"`
+	InformerResync      metav1.Duration `json:"informerResyncPeriod"`
+	ShutdownDrainPeriod metav1.Duration `json:"shutdownDrainPeriod"`
+	ShutdownTimeout     metav1.Duration `json:"shutdownTimeout"`
+
+	ReservedCpuAnnotationKey string `json:"reservedCpuAnnotationKey"`
+	ReservedMemAnnotationKey string `json:"reservedMemAnnotationKey"`
+	// read in priority order if the keys above are absent
+	ReservedCpuAnnotationKeyAliases []string `json:"reservedCpuAnnotationKeyAliases"`
+	ReservedMemAnnotationKeyAliases []string `json:"reservedMemAnnotationKeyAliases"`
+
+	ConsiderUnboundLocalPV bool `json:"considerUnboundLocalPV"`
+
+	FilterTimeout       metav1.Duration `json:"filterTimeout"`
+	FilterTimeoutPolicy string          `json:"filterTimeoutPolicy"`
+	FilterMaxInFlight   int             `json:"filterMaxInFlight"`
+	FilterParallelism   int             `json:"filterParallelism"`
+	FilterFailurePolicy string          `json:"filterFailurePolicy"`
+	FilterCacheTTL      metav1.Duration `json:"filterCacheTTL"`
+
+	FilterRecordFile       string `json:"filterRecordFile"`
+	FilterRecordMaxBytes   int64  `json:"filterRecordMaxBytes"`
+	FilterRecordMaxBackups int    `json:"filterRecordMaxBackups"`
+
+	LedgerResyncPeriod metav1.Duration `json:"ledgerResyncPeriod"`
+
+	LeaderElection LeaderElectionConfiguration `json:"leaderElection"`
+
+	PublishNodeReservation    bool            `json:"publishNodeReservation"`
+	PublishExtendedResources  bool            `json:"publishExtendedResources"`
+	NodeReservationSyncPeriod metav1.Duration `json:"nodeReservationSyncPeriod"`
+}
+
+type LeaderElectionConfiguration struct {
+	LeaderElect       bool            `json:"leaderElect"`
+	LeaseDuration     metav1.Duration `json:"leaseDuration"`
+	RenewDeadline     metav1.Duration `json:"renewDeadline"`
+	RetryPeriod       metav1.Duration `json:"retryPeriod"`
+	ResourceLock      string          `json:"resourceLock"`
+	ResourceNamespace string          `json:"resourceNamespace"`
+	ResourceName      string          `json:"resourceName"`
+}
+
+type DelegatedAuthConfiguration struct {
+	Enabled          bool            `json:"enabled"`
+	ResourceGroup    string          `json:"resourceGroup"`
+	Resource         string          `json:"resource"`
+	CacheTTL         metav1.Duration `json:"cacheTTL"`
+	AlwaysAllowUsers []string        `json:"alwaysAllowUsers"`
+	ExtenderHandlers []string        `json:"extenderHandlers"`
+}
+
+// ApplyConfigFile overrides the options with the fields provided in the configuration file.
+func (o *Options) ApplyConfigFile(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("fail to read config file %s: %s", file, err)
+	}
+	return o.ApplyConfigData(file, data)
+}
+
+// ApplyConfigData overrides the options with the fields provided in the content of the configuration file.
+func (o *Options) ApplyConfigData(file string, data []byte) error {
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return fmt.Errorf("fail to parse config file %s: %s", file, err)
+	}
+
+	cfg := o.toConfiguration()
+	cfg.APIVersion = ""
+	cfg.Kind = ""
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("fail to decode config file %s: %s", file, err)
+	}
+
+	if cfg.APIVersion != ConfigAPIVersion || cfg.Kind != ConfigKind {
+		return fmt.Errorf("config file %s should be %s of %s, got %s of %s", file, ConfigKind, ConfigAPIVersion, cfg.Kind, cfg.APIVersion)
+	}
+
+	o.fromConfiguration(cfg)
+	return nil
+}
+
+func (o *Options) toConfiguration() *PredicateServerConfiguration {
+	return &PredicateServerConfiguration{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: ConfigAPIVersion,
+			Kind:       ConfigKind,
+		},
+
+		KubeConfig: o.KubeConfig,
+		Master:     o.Master,
+		ListenPort: o.Port,
+
+		TLSCertFile:       o.TLSCertFile,
+		TLSPrivateKeyFile: o.TLSPrivateKeyFile,
+		ClientCAFile:      o.ClientCAFile,
+
+		MaxRequestBodyBytes: o.MaxRequestBodyBytes,
+		RequestTimeout:      metav1.Duration{Duration: o.RequestTimeout},
+
+		// copied, since decoding the file reuses the slice and merges into the map
+		Handlers:            append([]string{}, o.Handlers...),
+		HandlerPathPrefixes: copyStringMap(o.HandlerPathPrefixes),
+		PathPrefix:          o.PathPrefix,
+
+		DelegatedAuth: DelegatedAuthConfiguration{
+			Enabled:          o.DelegatedAuth,
+			ResourceGroup:    o.AuthResourceGroup,
+			Resource:         o.AuthResource,
+			CacheTTL:         metav1.Duration{Duration: o.AuthCacheTTL},
+			AlwaysAllowUsers: append([]string{}, o.AuthAlwaysAllowUsers...),
+			ExtenderHandlers: append([]string{}, o.AuthExtenderHandlers...),
+		},
+
+		CacheSyncTimeout:    metav1.Duration{Duration: o.CacheSyncTimeout},
+		InformerResync:      metav1.Duration{Duration: o.InformerResync},
+		ShutdownDrainPeriod: metav1.Duration{Duration: o.ShutdownDrainPeriod},
+		ShutdownTimeout:     metav1.Duration{Duration: o.ShutdownTimeout},
+
+		ReservedCpuAnnotationKey:        o.ReservedCpuAnnoKey,
+		ReservedMemAnnotationKey:        o.ReservedMemAnnoKey,
+		ReservedCpuAnnotationKeyAliases: append([]string{}, o.ReservedCpuAnnoKeyAliases...),
+		ReservedMemAnnotationKeyAliases: append([]string{}, o.ReservedMemAnnoKeyAliases...),
+
+		ConsiderUnboundLocalPV: o.ConsiderUnboundLocalPV,
+
+		FilterTimeout:       metav1.Duration{Duration: o.FilterTimeout},
+		FilterTimeoutPolicy: o.FilterTimeoutPolicy,
+		FilterMaxInFlight:   o.FilterMaxInFlight,
+		FilterParallelism:   o.FilterParallelism,
+		FilterFailurePolicy: o.FilterFailurePolicy,
+		FilterCacheTTL:      metav1.Duration{Duration: o.FilterCacheTTL},
+
+		FilterRecordFile:       o.FilterRecordFile,
+		FilterRecordMaxBytes:   o.FilterRecordMaxBytes,
+		FilterRecordMaxBackups: o.FilterRecordMaxBackups,
+
+		LedgerResyncPeriod: metav1.Duration{Duration: o.LedgerResyncPeriod},
+
+		LeaderElection: LeaderElectionConfiguration{
+			LeaderElect:       o.LeaderElect,
+			LeaseDuration:     metav1.Duration{Duration: o.LeaderElectLeaseDuration},
+			RenewDeadline:     metav1.Duration{Duration: o.LeaderElectRenewDeadline},
+			RetryPeriod:       metav1.Duration{Duration: o.LeaderElectRetryPeriod},
+			ResourceLock:      o.LeaderElectResourceLock,
+			ResourceNamespace: o.LeaderElectResourceNamespace,
+			ResourceName:      o.LeaderElectResourceName,
+		},
+
+		PublishNodeReservation:    o.PublishNodeReservation,
+		PublishExtendedResources:  o.PublishExtendedResources,
+		NodeReservationSyncPeriod: metav1.Duration{Duration: o.NodeReservationSyncPeriod},
+	}
+}
+
+func (o *Options) fromConfiguration(cfg *PredicateServerConfiguration) {
+	o.KubeConfig = cfg.KubeConfig
+	o.Master = cfg.Master
+	o.Port = cfg.ListenPort
+
+	o.TLSCertFile = cfg.TLSCertFile
+	o.TLSPrivateKeyFile = cfg.TLSPrivateKeyFile
+	o.ClientCAFile = cfg.ClientCAFile
+
+	o.MaxRequestBodyBytes = cfg.MaxRequestBodyBytes
+	o.RequestTimeout = cfg.RequestTimeout.Duration
+
+	o.Handlers = cfg.Handlers
+	o.HandlerPathPrefixes = cfg.HandlerPathPrefixes
+	o.PathPrefix = cfg.PathPrefix
+
+	o.DelegatedAuth = cfg.DelegatedAuth.Enabled
+	o.AuthResourceGroup = cfg.DelegatedAuth.ResourceGroup
+	o.AuthResource = cfg.DelegatedAuth.Resource
+	o.AuthCacheTTL = cfg.DelegatedAuth.CacheTTL.Duration
+	o.AuthAlwaysAllowUsers = cfg.DelegatedAuth.AlwaysAllowUsers
+	o.AuthExtenderHandlers = cfg.DelegatedAuth.ExtenderHandlers
+
+	o.CacheSyncTimeout = cfg.CacheSyncTimeout.Duration
+	o.InformerResync = cfg.InformerResync.Duration
+	o.ShutdownDrainPeriod = cfg.ShutdownDrainPeriod.Duration
+	o.ShutdownTimeout = cfg.ShutdownTimeout.Duration
+
+	o.ReservedCpuAnnoKey = cfg.ReservedCpuAnnotationKey
+	o.ReservedMemAnnoKey = cfg.ReservedMemAnnotationKey
+	o.ReservedCpuAnnoKeyAliases = cfg.ReservedCpuAnnotationKeyAliases
+	o.ReservedMemAnnoKeyAliases = cfg.ReservedMemAnnotationKeyAliases
+
+	o.ConsiderUnboundLocalPV = cfg.ConsiderUnboundLocalPV
+
+	o.FilterTimeout = cfg.FilterTimeout.Duration
+	o.FilterTimeoutPolicy = cfg.FilterTimeoutPolicy
+	o.FilterMaxInFlight = cfg.FilterMaxInFlight
+	o.FilterParallelism = cfg.FilterParallelism
+	o.FilterFailurePolicy = cfg.FilterFailurePolicy
+	o.FilterCacheTTL = cfg.FilterCacheTTL.Duration
+
+	o.FilterRecordFile = cfg.FilterRecordFile
+	o.FilterRecordMaxBytes = cfg.FilterRecordMaxBytes
+	o.FilterRecordMaxBackups = cfg.FilterRecordMaxBackups
+
+	o.LedgerResyncPeriod = cfg.LedgerResyncPeriod.Duration
+
+	o.LeaderElect = cfg.LeaderElection.LeaderElect
+	o.LeaderElectLeaseDuration = cfg.LeaderElection.LeaseDuration.Duration
+	o.LeaderElectRenewDeadline = cfg.LeaderElection.RenewDeadline.Duration
+	o.LeaderElectRetryPeriod = cfg.LeaderElection.RetryPeriod.Duration
+	o.LeaderElectResourceLock = cfg.LeaderElection.ResourceLock
+	o.LeaderElectResourceNamespace = cfg.LeaderElection.ResourceNamespace
+	o.LeaderElectResourceName = cfg.LeaderElection.ResourceName
+
+	o.PublishNodeReservation = cfg.PublishNodeReservation
+	o.PublishExtendedResources = cfg.PublishExtendedResources
+	o.NodeReservationSyncPeriod = cfg.NodeReservationSyncPeriod.Duration
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	copied := make(map[string]string, len(m))
+	for k, v := range m {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,96 @@
+package options
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApplyConfigData(t *testing.T) {
+	opts := NewOptions()
+	opts.Master = "https://127.0.0.1:6443"
+
+	data := []byte(`
+apiVersion: lpvrespredicate.config/v1alpha1
+kind: PredicateServerConfiguration
+reservedCpuAnnotationKey: lpv.example.com/reserved-cpu
+reservedCpuAnnotationKeyAliases: [reserved-cpu]
+considerUnboundLocalPV: false
+cacheSyncTimeout: 30s
+leaderElection:
+  leaderElect: true
+  resourceLock: configmaps
+`)
+	if err := opts.ApplyConfigData("test", data); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	if opts.ReservedCpuAnnoKey != "lpv.example.com/reserved-cpu" {
+		t.Fatalf("unexpected reserved cpu annotation key %s", opts.ReservedCpuAnnoKey)
+	}
+	if len(opts.ReservedCpuAnnoKeyAliases) != 1 || opts.ReservedCpuAnnoKeyAliases[0] != "reserved-cpu" {
+		t.Fatalf("unexpected reserved cpu annotation key aliases %v", opts.ReservedCpuAnnoKeyAliases)
+	}
+	if opts.ConsiderUnboundLocalPV {
+		t.Fatal("expected unbound local pv not considered")
+	}
+	if opts.CacheSyncTimeout != 30*time.Second {
+		t.Fatalf("unexpected cache sync timeout %s", opts.CacheSyncTimeout)
+	}
+	if !opts.LeaderElect || opts.LeaderElectResourceLock != "configmaps" {
+		t.Fatalf("unexpected leader election %v with %s", opts.LeaderElect, opts.LeaderElectResourceLock)
+	}
+
+	// omitted fields keep the flag values
+	if opts.Master != "https://127.0.0.1:6443" || opts.ReservedMemAnnoKey != "reserved-mem" || opts.LeaderElectLeaseDuration != 15*time.Second {
+		t.Fatalf("unexpected omitted fields: %s, %s, %s", opts.Master, opts.ReservedMemAnnoKey, opts.LeaderElectLeaseDuration)
+	}
+	if errs := opts.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected errs: %v", errs)
+	}
+}
+
+func TestApplyInvalidConfigData(t *testing.T) {
+	for name, data := range map[string]string{
+		"unknown field": `
+apiVersion: lpvrespredicate.config/v1alpha1
+kind: PredicateServerConfiguration
+reservedCpuAnnoKey: cpu
+`,
+		"wrong kind": `
+apiVersion: lpvrespredicate.config/v1alpha1
+kind: KubeSchedulerConfiguration
+`,
+		"missing version": `
+reservedCpuAnnotationKey: cpu
+`,
+	} {
+		opts := NewOptions()
+		if err := opts.ApplyConfigData("test", []byte(data)); err == nil {
+			t.Fatalf("expected err for %s", name)
+		}
+	}
+}
+
+func TestApplyConfigDataNotChangingFlags(t *testing.T) {
+	flagOpts := NewOptions()
+	flagOpts.HandlerPathPrefixes["health"] = "status"
+
+	opts := *flagOpts
+	data := []byte(`
+apiVersion: lpvrespredicate.config/v1alpha1
+kind: PredicateServerConfiguration
+handlers: ["-metrics"]
+handlerPathPrefixes:
+  filter: predicates
+`)
+	if err := opts.ApplyConfigData("test", data); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	if len(opts.Handlers) != 1 || opts.Handlers[0] != "-metrics" || len(opts.HandlerPathPrefixes) != 2 {
+		t.Fatalf("unexpected handlers %v with path prefixes %v", opts.Handlers, opts.HandlerPathPrefixes)
+	}
+	if len(flagOpts.Handlers) != 1 || flagOpts.Handlers[0] != "*" || len(flagOpts.HandlerPathPrefixes) != 1 {
+		t.Fatalf("flag options are changed to handlers %v with path prefixes %v", flagOpts.Handlers, flagOpts.HandlerPathPrefixes)
+	}
+}
@@ -0,0 +1,42 @@
+package options
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// LintOptions are the options of the lint subcommand, which audits the reservation annotations of the PVs.
+type LintOptions struct {
+	// the options of how the reservation is read and where the cluster is read from
+	ClusterOptions
+
+	Output string
+}
+
+func NewLintOptions() *LintOptions {
+	return &LintOptions{
+		ClusterOptions: newClusterOptions(),
+		Output:         "table",
+	}
+}
+
+func (o *LintOptions) AddFlags(fs *pflag.FlagSet) {
+	o.addFlags(fs, clusterFlagUsages{
+		config:  "the reservation options and the API server",
+		cluster: "the cluster to audit",
+		files:   "the nodes and persistent volumes to audit",
+	})
+	fs.StringVarP(&o.Output, "output", "o", o.Output, "the output format, 'table' or 'json'")
+}
+
+func (o *LintOptions) Validate() []error {
+	errs := []error{}
+
+	errs = append(errs, o.validateClusterSource()...)
+	errs = append(errs, o.validateReservationFlags()...)
+	if o.Output != "table" && o.Output != "json" {
+		errs = append(errs, fmt.Errorf("--output %s should be table or json", o.Output))
+	}
+	return errs
+}
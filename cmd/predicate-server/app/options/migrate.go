@@ -0,0 +1,54 @@
+package options
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// MigrateOptions are the options of the migrate-annotations subcommand, which copies the reservation annotations
+// from the aliases of the annotation keys to the keys.
+type MigrateOptions struct {
+	// the options of the reservation annotation keys and their aliases, how to connect to the API server
+	// and the files to migrate on dry run
+	ClusterOptions
+
+	RemoveAliases bool
+	DryRun        bool
+	Output        string
+}
+
+func NewMigrateOptions() *MigrateOptions {
+	return &MigrateOptions{
+		ClusterOptions: newClusterOptions(),
+		Output:         "diff",
+	}
+}
+
+func (o *MigrateOptions) AddFlags(fs *pflag.FlagSet) {
+	o.addFlags(fs, clusterFlagUsages{
+		config:  "the reservation annotation keys and the API server",
+		cluster: "the cluster whose PVs are migrated",
+		files:   "the persistent volumes to migrate on dry run",
+	})
+	fs.BoolVar(&o.RemoveAliases, "remove-aliases", o.RemoveAliases, "remove the annotations of the aliases once migrated, which are kept by default for the predicate servers still reading them")
+	fs.BoolVar(&o.DryRun, "dry-run", o.DryRun, "only print the changes and the conflicts without updating the PVs")
+	fs.StringVarP(&o.Output, "output", "o", o.Output, "the output format, 'diff' or 'json'")
+}
+
+func (o *MigrateOptions) Validate() []error {
+	errs := []error{}
+
+	if len(o.ClusterFiles) > 0 && !o.DryRun {
+		errs = append(errs, fmt.Errorf("--filename is only supported with --dry-run"))
+	}
+	errs = append(errs, o.validateClusterSource()...)
+	if len(o.ReservedCpuAnnoKeyAliases) == 0 && len(o.ReservedMemAnnoKeyAliases) == 0 {
+		errs = append(errs, fmt.Errorf("neither --reserved-cpu-annotation-key-aliases nor --reserved-mem-annotation-key-aliases is provided to migrate from"))
+	}
+	errs = append(errs, o.validateReservationFlags()...)
+	if o.Output != "diff" && o.Output != "json" {
+		errs = append(errs, fmt.Errorf("--output %s should be diff or json", o.Output))
+	}
+	return errs
+}
@@ -2,38 +2,177 @@ package options
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
+	"k8s.io/client-go/tools/leaderelection"
 )
 
 type Options struct {
+	ConfigFile string
+
 	KubeConfig string
 	Master     string
 	Port       int
 
-	ReservedCpuAnnoKey   string
-	ReservedMemAnnoKey   string
+	TLSCertFile       string
+	TLSPrivateKeyFile string
+	ClientCAFile      string
+
+	MaxRequestBodyBytes int64
+	RequestTimeout      time.Duration
+
+	ListHandlers        bool
+	Handlers            []string
+	HandlerPathPrefixes map[string]string
+	PathPrefix          string
+
+	DelegatedAuth        bool
+	AuthResourceGroup    string
+	AuthResource         string
+	AuthCacheTTL         time.Duration
+	AuthAlwaysAllowUsers []string
+	AuthExtenderHandlers []string
+
+	CacheSyncTimeout    time.Duration
+	InformerResync      time.Duration
+	ShutdownDrainPeriod time.Duration
+	ShutdownTimeout     time.Duration
+
+	ReservedCpuAnnoKey        string
+	ReservedMemAnnoKey        string
+	ReservedCpuAnnoKeyAliases []string
+	ReservedMemAnnoKeyAliases []string
 
 	ConsiderUnboundLocalPV bool
+
+	FilterTimeout       time.Duration
+	FilterTimeoutPolicy string
+	FilterMaxInFlight   int
+	FilterParallelism   int
+	FilterFailurePolicy string
+	FilterCacheTTL      time.Duration
+
+	FilterRecordFile       string
+	FilterRecordMaxBytes   int64
+	FilterRecordMaxBackups int
+
+	LedgerResyncPeriod time.Duration
+
+	LeaderElect                  bool
+	LeaderElectLeaseDuration     time.Duration
+	LeaderElectRenewDeadline     time.Duration
+	LeaderElectRetryPeriod       time.Duration
+	LeaderElectResourceLock      string
+	LeaderElectResourceNamespace string
+	LeaderElectResourceName      string
+
+	PublishNodeReservation    bool
+	PublishExtendedResources  bool
+	NodeReservationSyncPeriod time.Duration
 }
 
 func NewOptions() *Options {
 	return &Options{
 		Port: 8089,
 
+		MaxRequestBodyBytes: 32 * 1024 * 1024,
+		RequestTimeout:      30 * time.Second,
+
+		Handlers:            []string{"*"},
+		HandlerPathPrefixes: map[string]string{},
+
+		AuthResourceGroup:    "lpvrespredicate.io",
+		AuthResource:         "handlers",
+		AuthCacheTTL:         10 * time.Second,
+		AuthAlwaysAllowUsers: []string{"system:kube-scheduler"},
+		AuthExtenderHandlers: []string{"filter"},
+
+		CacheSyncTimeout:    2 * time.Minute,
+		InformerResync:      30 * time.Second,
+		ShutdownDrainPeriod: 5 * time.Second,
+		ShutdownTimeout:     30 * time.Second,
+
 		ReservedCpuAnnoKey: "reserved-cpu",
 		ReservedMemAnnoKey: "reserved-mem",
 
 		ConsiderUnboundLocalPV: true,
+
+		FilterTimeoutPolicy: "error",
+		FilterParallelism:   16,
+		FilterFailurePolicy: "fail-request",
+		FilterCacheTTL:      30 * time.Second,
+
+		FilterRecordMaxBytes:   100 * 1024 * 1024,
+		FilterRecordMaxBackups: 3,
+
+		LedgerResyncPeriod: 5 * time.Minute,
+
+		LeaderElectLeaseDuration:     15 * time.Second,
+		LeaderElectRenewDeadline:     10 * time.Second,
+		LeaderElectRetryPeriod:       2 * time.Second,
+		LeaderElectResourceLock:      "leases",
+		LeaderElectResourceNamespace: "kube-system",
+		LeaderElectResourceName:      "lpv-res-predicate",
+
+		NodeReservationSyncPeriod: 30 * time.Second,
 	}
 }
 
 func (o *Options) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.ConfigFile, "config", o.ConfigFile, "Path to a PredicateServerConfiguration file, whose fields override the flags. The file is watched and the options not requiring restart are reloaded once it is changed.")
 	fs.StringVar(&o.KubeConfig, "kubeconfig", o.KubeConfig, "Path to a kubeconfig file, specifying how to connect to the API server. Providing --kubeconfig enables API server mode, omitting --kubeconfig enables standalone mode.")
 	fs.StringVar(&o.Master, "master", o.Master, "The address of the Kubernetes API server (overrides any value in kubeconfig)")
 	fs.IntVar(&o.Port, "listen-port", o.Port, "the port to listen to")
+	fs.StringVar(&o.TLSCertFile, "tls-cert-file", o.TLSCertFile, "File containing the x509 certificate for HTTPS. HTTPS is served if provided together with --tls-private-key-file. The file is reloaded once it is modified.")
+	fs.StringVar(&o.TLSPrivateKeyFile, "tls-private-key-file", o.TLSPrivateKeyFile, "File containing the x509 private key matching --tls-cert-file. The file is reloaded once it is modified.")
+	fs.StringVar(&o.ClientCAFile, "client-ca-file", o.ClientCAFile, "If set, any request should present a client certificate signed by one of the authorities in this file, such as the certificate configured in the TLSConfig of the scheduler extender config. Requires HTTPS.")
+	fs.Int64Var(&o.MaxRequestBodyBytes, "max-request-body-bytes", o.MaxRequestBodyBytes, "the limit on the size of request body, 0 means no limit")
+	fs.DurationVar(&o.RequestTimeout, "request-timeout", o.RequestTimeout, "the deadline of each request, 0 means no deadline")
+	fs.BoolVar(&o.ListHandlers, "list-handlers", o.ListHandlers, "List the registered handlers with their paths and exit.")
+	fs.StringSliceVar(&o.Handlers, "handlers", o.Handlers, "A list of handlers to enable. '*' enables all the handlers, 'foo' enables the handler named 'foo', '-foo' disables the handler named 'foo'. See --list-handlers for the registered ones.")
+	fs.StringToStringVar(&o.HandlerPathPrefixes, "handler-path-prefixes", o.HandlerPathPrefixes, "Remap the path prefixes of handlers, such as 'filter=predicates'. A handler is mounted at /<name> by default.")
+	fs.StringVar(&o.PathPrefix, "path-prefix", o.PathPrefix, "the path prefix all the handlers are mounted under, such as the path of an ingress")
+	fs.BoolVar(&o.DelegatedAuth, "delegated-auth", o.DelegatedAuth, "Authenticate requests by the client certificate or by the bearer token with TokenReview, and authorize them with SubjectAccessReview. Requires HTTPS.")
+	fs.StringVar(&o.AuthResourceGroup, "auth-resource-group", o.AuthResourceGroup, "the API group of the virtual resource checked by SubjectAccessReview, whose resource name is the handler name")
+	fs.StringVar(&o.AuthResource, "auth-resource", o.AuthResource, "the virtual resource checked by SubjectAccessReview, whose resource name is the handler name")
+	fs.DurationVar(&o.AuthCacheTTL, "auth-cache-ttl", o.AuthCacheTTL, "the duration to cache the results of TokenReview and SubjectAccessReview")
+	fs.StringSliceVar(&o.AuthAlwaysAllowUsers, "auth-always-allow-users", o.AuthAlwaysAllowUsers, "the users allowed to call the handlers of --auth-extender-handlers without SubjectAccessReview, such as the identity of kube-scheduler")
+	fs.StringSliceVar(&o.AuthExtenderHandlers, "auth-extender-handlers", o.AuthExtenderHandlers, "the handlers serving the extender verbs called by kube-scheduler")
+	fs.DurationVar(&o.CacheSyncTimeout, "cache-sync-timeout", o.CacheSyncTimeout, "the timeout to wait for the informer caches to sync at start up")
+	fs.DurationVar(&o.InformerResync, "informer-resync-period", o.InformerResync, "the period the informers replay the cached objects to the event handlers. 0 means never")
+	fs.DurationVar(&o.ShutdownDrainPeriod, "shutdown-drain-period", o.ShutdownDrainPeriod, "the period to keep serving after being signaled to shut down and reporting not ready, before closing the listener")
+	fs.DurationVar(&o.ShutdownTimeout, "shutdown-timeout", o.ShutdownTimeout, "the timeout to wait for in-flight requests to finish after closing the listener")
+	o.addReservationFlags(fs)
+	fs.DurationVar(&o.FilterTimeout, "filter-timeout", o.FilterTimeout, "the deadline to predicate the nodes of a filter call, which should be shorter than the HTTPTimeout of the extender config. 0 means only --request-timeout applies")
+	fs.StringVar(&o.FilterTimeoutPolicy, "filter-timeout-policy", o.FilterTimeoutPolicy, "how to answer the nodes not predicated before the deadline: 'error' fails the filter call, 'pass-all' passes the nodes, 'fail-all' fails the nodes")
+	fs.IntVar(&o.FilterMaxInFlight, "filter-max-in-flight", o.FilterMaxInFlight, "the maximum number of filter calls predicated concurrently, the others wait until the deadline. 0 means no limit")
+	fs.IntVar(&o.FilterParallelism, "filter-parallelism", o.FilterParallelism, "the number of workers predicating the nodes of a filter call in parallel")
+	fs.StringVar(&o.FilterFailurePolicy, "filter-failure-policy", o.FilterFailurePolicy, "how to answer a node failing to be predicated because of an internal error: 'fail-request' fails the filter call, 'fail-node' fails the node, 'pass-node' passes the node")
+	fs.DurationVar(&o.FilterCacheTTL, "filter-cache-ttl", o.FilterCacheTTL, "the duration to cache the decision of a pod on a node, which is invalidated earlier by the changes of the node, its local persistent volumes and the pods mounting them. 0 disables the cache")
+	fs.StringVar(&o.FilterRecordFile, "filter-record-file", o.FilterRecordFile, "If set, each filter call is recorded to this file as a JSON line, with the response and the objects read by the predicate, to be replayed by the replay subcommand")
+	fs.Int64Var(&o.FilterRecordMaxBytes, "filter-record-max-bytes", o.FilterRecordMaxBytes, "the size of --filter-record-file beyond which it is rotated")
+	fs.IntVar(&o.FilterRecordMaxBackups, "filter-record-max-backups", o.FilterRecordMaxBackups, "the number of rotated --filter-record-file kept, with the suffixes .1 for the newest to .N for the oldest")
+	fs.DurationVar(&o.LedgerResyncPeriod, "ledger-resync-period", o.LedgerResyncPeriod, "the period to recompute the reservation ledger of all the nodes, reporting the drift from the incremental updates. 0 means never")
+	fs.BoolVar(&o.LeaderElect, "leader-elect", o.LeaderElect, "Start a leader election client and gain leadership before running controllers which write to the API server. Every replica serves filter calls regardless of the leadership.")
+	fs.DurationVar(&o.LeaderElectLeaseDuration, "leader-elect-lease-duration", o.LeaderElectLeaseDuration, "The duration that non-leader candidates will wait after observing a leadership renewal until attempting to acquire leadership.")
+	fs.DurationVar(&o.LeaderElectRenewDeadline, "leader-elect-renew-deadline", o.LeaderElectRenewDeadline, "The interval between attempts by the acting leader to renew a leadership slot before it stops leading. This must be less than or equal to the lease duration.")
+	fs.DurationVar(&o.LeaderElectRetryPeriod, "leader-elect-retry-period", o.LeaderElectRetryPeriod, "The duration the clients should wait between attempting acquisition and renewal of a leadership.")
+	fs.StringVar(&o.LeaderElectResourceLock, "leader-elect-resource-lock", o.LeaderElectResourceLock, "The type of resource object that is used for locking during leader election. Supported options are `leases` and `configmaps`.")
+	fs.StringVar(&o.LeaderElectResourceNamespace, "leader-elect-resource-namespace", o.LeaderElectResourceNamespace, "The namespace of resource object that is used for locking during leader election.")
+	fs.StringVar(&o.LeaderElectResourceName, "leader-elect-resource-name", o.LeaderElectResourceName, "The name of resource object that is used for locking during leader election.")
+	fs.BoolVar(&o.PublishNodeReservation, "publish-node-reservation", o.PublishNodeReservation, "whether to publish the reserved and unreserved resources of each node as node annotations")
+	fs.BoolVar(&o.PublishExtendedResources, "publish-extended-resources", o.PublishExtendedResources, "whether to also publish the reserved and unreserved resources of each node as extended resources in node status, requires --publish-node-reservation")
+	fs.DurationVar(&o.NodeReservationSyncPeriod, "node-reservation-sync-period", o.NodeReservationSyncPeriod, "the period to publish the reserved and unreserved resources of nodes")
+}
+
+// addReservationFlags adds the flags of how the reservation of local PVs is read, which are shared with the subcommands.
+func (o *Options) addReservationFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&o.ReservedCpuAnnoKey, "reserved-cpu-annotation-key", o.ReservedCpuAnnoKey, "key of the annotation for information of reserved cpu of persistent local volume")
 	fs.StringVar(&o.ReservedMemAnnoKey, "reserved-mem-annotation-key", o.ReservedMemAnnoKey, "key of the annotation for information of reserved memory of persistent local volume")
+	fs.StringSliceVar(&o.ReservedCpuAnnoKeyAliases, "reserved-cpu-annotation-key-aliases", o.ReservedCpuAnnoKeyAliases, "keys of the annotation of reserved cpu read in priority order if --reserved-cpu-annotation-key is absent, such as the old key during a migration")
+	fs.StringSliceVar(&o.ReservedMemAnnoKeyAliases, "reserved-mem-annotation-key-aliases", o.ReservedMemAnnoKeyAliases, "keys of the annotation of reserved memory read in priority order if --reserved-mem-annotation-key is absent, such as the old key during a migration")
 	fs.BoolVar(&o.ConsiderUnboundLocalPV, "consider-unbound-local-pv", o.ConsiderUnboundLocalPV, "whether the unbound local persistent volume will be considered")
 }
 
@@ -47,5 +186,143 @@ func (o *Options) Validate() []error {
 	if o.Port <= 0 {
 		errs = append(errs, fmt.Errorf("--port %d should be greater than 0", o.Port))
 	}
+
+	if (len(o.TLSCertFile) == 0) != (len(o.TLSPrivateKeyFile) == 0) {
+		errs = append(errs, fmt.Errorf("--tls-cert-file and --tls-private-key-file should be provided together"))
+	}
+
+	if len(o.ClientCAFile) > 0 && len(o.TLSCertFile) == 0 {
+		errs = append(errs, fmt.Errorf("--client-ca-file requires --tls-cert-file and --tls-private-key-file"))
+	}
+
+	if o.MaxRequestBodyBytes < 0 {
+		errs = append(errs, fmt.Errorf("--max-request-body-bytes %d should not be negative", o.MaxRequestBodyBytes))
+	}
+
+	if o.RequestTimeout < 0 {
+		errs = append(errs, fmt.Errorf("--request-timeout %s should not be negative", o.RequestTimeout))
+	}
+
+	for _, handler := range o.Handlers {
+		if len(strings.TrimPrefix(handler, "-")) == 0 {
+			errs = append(errs, fmt.Errorf("--handlers %v should not contain an empty handler name", o.Handlers))
+			break
+		}
+	}
+
+	if o.DelegatedAuth {
+		if len(o.TLSCertFile) == 0 {
+			errs = append(errs, fmt.Errorf("--delegated-auth requires --tls-cert-file and --tls-private-key-file"))
+		}
+		if len(o.AuthResource) == 0 {
+			errs = append(errs, fmt.Errorf("--auth-resource should not be empty"))
+		}
+		if o.AuthCacheTTL <= 0 {
+			errs = append(errs, fmt.Errorf("--auth-cache-ttl %s should be greater than 0", o.AuthCacheTTL))
+		}
+	}
+
+	if o.CacheSyncTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("--cache-sync-timeout %s should be greater than 0", o.CacheSyncTimeout))
+	}
+
+	if o.InformerResync < 0 {
+		errs = append(errs, fmt.Errorf("--informer-resync-period %s should not be negative", o.InformerResync))
+	}
+
+	if o.ShutdownDrainPeriod < 0 {
+		errs = append(errs, fmt.Errorf("--shutdown-drain-period %s should not be negative", o.ShutdownDrainPeriod))
+	}
+
+	if o.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("--shutdown-timeout %s should be greater than 0", o.ShutdownTimeout))
+	}
+
+	errs = append(errs, o.validateReservationFlags()...)
+
+	if o.FilterTimeout < 0 {
+		errs = append(errs, fmt.Errorf("--filter-timeout %s should not be negative", o.FilterTimeout))
+	}
+
+	if o.FilterTimeoutPolicy != "error" && o.FilterTimeoutPolicy != "pass-all" && o.FilterTimeoutPolicy != "fail-all" {
+		errs = append(errs, fmt.Errorf("--filter-timeout-policy %s should be error, pass-all or fail-all", o.FilterTimeoutPolicy))
+	}
+
+	if o.FilterMaxInFlight < 0 {
+		errs = append(errs, fmt.Errorf("--filter-max-in-flight %d should not be negative", o.FilterMaxInFlight))
+	}
+
+	if o.FilterParallelism <= 0 {
+		errs = append(errs, fmt.Errorf("--filter-parallelism %d should be greater than 0", o.FilterParallelism))
+	}
+
+	if o.FilterFailurePolicy != "fail-request" && o.FilterFailurePolicy != "fail-node" && o.FilterFailurePolicy != "pass-node" {
+		errs = append(errs, fmt.Errorf("--filter-failure-policy %s should be fail-request, fail-node or pass-node", o.FilterFailurePolicy))
+	}
+
+	if o.FilterCacheTTL < 0 {
+		errs = append(errs, fmt.Errorf("--filter-cache-ttl %s should not be negative", o.FilterCacheTTL))
+	}
+
+	if o.FilterRecordMaxBytes <= 0 {
+		errs = append(errs, fmt.Errorf("--filter-record-max-bytes %d should be greater than 0", o.FilterRecordMaxBytes))
+	}
+
+	if o.FilterRecordMaxBackups < 0 {
+		errs = append(errs, fmt.Errorf("--filter-record-max-backups %d should not be negative", o.FilterRecordMaxBackups))
+	}
+
+	if o.LedgerResyncPeriod < 0 {
+		errs = append(errs, fmt.Errorf("--ledger-resync-period %s should not be negative", o.LedgerResyncPeriod))
+	}
+
+	if o.LeaderElect {
+		if o.LeaderElectRetryPeriod <= 0 {
+			errs = append(errs, fmt.Errorf("--leader-elect-retry-period %s should be greater than 0", o.LeaderElectRetryPeriod))
+		}
+		if o.LeaderElectRenewDeadline <= time.Duration(leaderelection.JitterFactor*float64(o.LeaderElectRetryPeriod)) {
+			errs = append(errs, fmt.Errorf("--leader-elect-renew-deadline %s should be greater than --leader-elect-retry-period %s times the jitter factor %v", o.LeaderElectRenewDeadline, o.LeaderElectRetryPeriod, leaderelection.JitterFactor))
+		}
+		if o.LeaderElectLeaseDuration <= o.LeaderElectRenewDeadline {
+			errs = append(errs, fmt.Errorf("--leader-elect-lease-duration %s should be greater than --leader-elect-renew-deadline %s", o.LeaderElectLeaseDuration, o.LeaderElectRenewDeadline))
+		}
+		if o.LeaderElectResourceLock != "leases" && o.LeaderElectResourceLock != "configmaps" {
+			errs = append(errs, fmt.Errorf("--leader-elect-resource-lock %s should be leases or configmaps", o.LeaderElectResourceLock))
+		}
+		if len(o.LeaderElectResourceNamespace) == 0 || len(o.LeaderElectResourceName) == 0 {
+			errs = append(errs, fmt.Errorf("--leader-elect-resource-namespace and --leader-elect-resource-name should not be empty"))
+		}
+	}
+
+	if o.PublishExtendedResources && !o.PublishNodeReservation {
+		errs = append(errs, fmt.Errorf("--publish-extended-resources requires --publish-node-reservation"))
+	}
+
+	if o.PublishNodeReservation && o.NodeReservationSyncPeriod <= 0 {
+		errs = append(errs, fmt.Errorf("--node-reservation-sync-period %s should be greater than 0", o.NodeReservationSyncPeriod))
+	}
+	return errs
+}
+
+// validateReservationFlags validates the flags added by addReservationFlags, which are shared with the subcommands.
+func (o *Options) validateReservationFlags() []error {
+	errs := []error{}
+	errs = append(errs, validateAnnotationKeyAliases("--reserved-cpu-annotation-key-aliases", o.ReservedCpuAnnoKey, o.ReservedCpuAnnoKeyAliases)...)
+	errs = append(errs, validateAnnotationKeyAliases("--reserved-mem-annotation-key-aliases", o.ReservedMemAnnoKey, o.ReservedMemAnnoKeyAliases)...)
+	return errs
+}
+
+// validateAnnotationKeyAliases requires the aliases to be distinct from each other and from the key.
+func validateAnnotationKeyAliases(flag, key string, aliases []string) []error {
+	errs := []error{}
+	seen := map[string]bool{key: true}
+	for _, alias := range aliases {
+		if len(alias) == 0 {
+			errs = append(errs, fmt.Errorf("%s %v should not contain an empty key", flag, aliases))
+		} else if seen[alias] {
+			errs = append(errs, fmt.Errorf("%s %v should not contain %s more than once, nor the key itself", flag, aliases, alias))
+		}
+		seen[alias] = true
+	}
 	return errs
 }
@@ -0,0 +1,54 @@
+package options
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// ReplayOptions are the options of the replay subcommand, which predicates the recorded filter calls again.
+type ReplayOptions struct {
+	// the options of how to predicate and where the cluster is read from with --live
+	ClusterOptions
+
+	RecordFiles []string
+	Live        bool
+	Output      string
+}
+
+func NewReplayOptions() *ReplayOptions {
+	return &ReplayOptions{
+		ClusterOptions: newClusterOptions(),
+		Output:         "table",
+	}
+}
+
+func (o *ReplayOptions) AddFlags(fs *pflag.FlagSet) {
+	o.addFlags(fs, clusterFlagUsages{
+		config:  "the predicate options and the API server",
+		cluster: "the cluster to replay against with --live",
+		files:   "the nodes, pods, persistent volumes and claims to replay against with --live",
+	})
+	fs.StringSliceVarP(&o.RecordFiles, "records", "r", o.RecordFiles, "The files recorded by --filter-record-file, replayed in order, such as the rotated files from the oldest one.")
+	fs.BoolVar(&o.Live, "live", o.Live, "Replay against the current state of the cluster instead of the objects recorded with each call.")
+	fs.StringVarP(&o.Output, "output", "o", o.Output, "the output format, 'table' or 'json'")
+}
+
+func (o *ReplayOptions) Validate() []error {
+	errs := []error{}
+
+	if len(o.RecordFiles) == 0 {
+		errs = append(errs, fmt.Errorf("--records is not provided"))
+	}
+	if o.Live {
+		errs = append(errs, o.validateClusterSource()...)
+	}
+	errs = append(errs, o.validateReservationFlags()...)
+	if !o.Live && len(o.ClusterFiles) > 0 {
+		errs = append(errs, fmt.Errorf("--filename is only allowed with --live"))
+	}
+	if o.Output != "table" && o.Output != "json" {
+		errs = append(errs, fmt.Errorf("--output %s should be table or json", o.Output))
+	}
+	return errs
+}
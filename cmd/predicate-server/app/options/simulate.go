@@ -0,0 +1,48 @@
+package options
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// SimulateOptions are the options of the simulate subcommand, which predicates pods against the objects loaded from files.
+type SimulateOptions struct {
+	// the options of how the reservation is read, overridden by the configuration file if provided
+	*Options
+
+	ClusterFiles []string
+	PodFiles     []string
+	Output       string
+}
+
+func NewSimulateOptions() *SimulateOptions {
+	return &SimulateOptions{
+		Options: NewOptions(),
+		Output:  "table",
+	}
+}
+
+func (o *SimulateOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.ConfigFile, "config", o.ConfigFile, "Path to a PredicateServerConfiguration file to take the reservation options from, whose fields override the flags.")
+	o.addReservationFlags(fs)
+	fs.StringSliceVarP(&o.ClusterFiles, "filename", "f", o.ClusterFiles, "YAML or JSON files of the nodes, pods, persistent volumes and claims of the cluster, such as dumped by 'kubectl get -o yaml'. A directory loads its .yaml, .yml and .json files.")
+	fs.StringSliceVar(&o.PodFiles, "pod", o.PodFiles, "YAML or JSON files of the pods to predicate, each predicated against the cluster independently.")
+	fs.StringVarP(&o.Output, "output", "o", o.Output, "the output format, 'table' or 'json'")
+}
+
+func (o *SimulateOptions) Validate() []error {
+	errs := []error{}
+
+	if len(o.ClusterFiles) == 0 {
+		errs = append(errs, fmt.Errorf("--filename is required"))
+	}
+	if len(o.PodFiles) == 0 {
+		errs = append(errs, fmt.Errorf("--pod is required"))
+	}
+	errs = append(errs, o.validateReservationFlags()...)
+	if o.Output != "table" && o.Output != "json" {
+		errs = append(errs, fmt.Errorf("--output %s should be table or json", o.Output))
+	}
+	return errs
+}
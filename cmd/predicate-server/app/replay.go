@@ -0,0 +1,70 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/wu8685/lpv-res-predicate/cmd/predicate-server/app/options"
+	"github.com/wu8685/lpv-res-predicate/pkg/handlers/predicate"
+)
+
+// replayDiffsExitCode is the exit code of the replay subcommand if any decision differs,
+// distinguished from the exit code 1 on errors.
+const replayDiffsExitCode = 2
+
+func NewReplayCommand() *cobra.Command {
+	opts := options.NewReplayOptions()
+
+	cmd := &cobra.Command{
+		Use:   "replay",
+		Short: "Replay the recorded filter calls and diff the decisions",
+		Long: `Predicate the filter calls recorded by --filter-record-file again with the given options,
+and report the nodes whose decision differs from the recorded one, such as to validate an upgrade or an option change against real traffic.
+Each call is replayed against the objects recorded with it, or with --live against the cluster of the API server or of the files given by --filename,
+in which case the records whose objects changed since are counted.
+It exits with 2 if any decision differs, and with 1 on errors.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			diffs, err := replay(os.Stdout, opts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+			if diffs > 0 {
+				os.Exit(replayDiffsExitCode)
+			}
+		},
+	}
+
+	opts.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+// replay writes the report and returns how many decisions differ.
+func replay(out io.Writer, opts *options.ReplayOptions) (int, error) {
+	if err := completeOptions(opts.Options, opts.Validate); err != nil {
+		return 0, err
+	}
+
+	records, err := predicate.ReadFilterRecords(opts.RecordFiles)
+	if err != nil {
+		return 0, err
+	}
+
+	var live []runtime.Object
+	if opts.Live {
+		if live, _, err = clusterObjects(&opts.ClusterOptions); err != nil {
+			return 0, err
+		}
+	}
+
+	report, err := predicate.Replay(newOptionConfig(opts.Options), records, live)
+	if err != nil {
+		return 0, err
+	}
+	return len(report.Diffs), predicate.WriteReplayReport(out, report, opts.Output)
+}
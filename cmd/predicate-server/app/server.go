@@ -3,11 +3,9 @@ package app
 import (
 	"fmt"
 	"os"
-	"time"
 
 	"github.com/spf13/cobra"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
-	"k8s.io/client-go/informers"
 	"k8s.io/kubernetes/pkg/version/verflag"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
@@ -15,6 +13,7 @@ import (
 	"github.com/wu8685/lpv-res-predicate/pkg/config"
 	"github.com/wu8685/lpv-res-predicate/cmd/predicate-server/app/options"
 	"github.com/wu8685/lpv-res-predicate/pkg"
+	"github.com/wu8685/lpv-res-predicate/pkg/informers"
 )
 
 func NewPredicateServerCommand() *cobra.Command {
@@ -34,12 +33,23 @@ after it provisions the current pod.`,
 				fmt.Fprint(os.Stderr, "Arguments are not supported\n")
 			}
 
-			if errs := opts.Validate(); len(errs) > 0 {
-				fmt.Fprintf(os.Stderr, "%v\n", utilerrors.NewAggregate(errs))
-				os.Exit(1)
+			if opts.ListHandlers {
+				if err := listHandlers(os.Stdout, opts); err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+					os.Exit(1)
+				}
+				return
+			}
+
+			// options with a config file are validated after loading the file
+			if len(opts.ConfigFile) == 0 {
+				if errs := opts.Validate(); len(errs) > 0 {
+					fmt.Fprintf(os.Stderr, "%v\n", utilerrors.NewAggregate(errs))
+					os.Exit(1)
+				}
 			}
 
-			if err := Run(opts); err != nil {
+			if err := Run(opts, setupSignalHandler()); err != nil {
 				fmt.Fprintf(os.Stderr, "%v\n", err)
 				os.Exit(1)
 			}
@@ -47,18 +57,37 @@ after it provisions the current pod.`,
 	}
 
 	opts.AddFlags(cmd.Flags())
+	cmd.AddCommand(NewSimulateCommand())
+	cmd.AddCommand(NewCapacityCommand())
+	cmd.AddCommand(NewLintCommand())
+	cmd.AddCommand(NewAnnotateCommand())
+	cmd.AddCommand(NewMigrateCommand())
+	cmd.AddCommand(NewReplayCommand())
 
 	return cmd
 }
 
-func Run(opts *options.Options) error {
+func Run(opts *options.Options, stopCh <-chan struct{}) error {
+	var watcher *configWatcher
+	if len(opts.ConfigFile) > 0 {
+		watcher = newConfigWatcher(opts)
+		loaded, err := watcher.load()
+		if err != nil {
+			return err
+		}
+		opts = loaded
+	}
+
 	cfg, err := newConfig(opts)
 	if err != nil {
 		return err
 	}
 
 	svr := pkg.NewPredicateServer(cfg)
-	return svr.Run()
+	if watcher != nil {
+		go watcher.Run(svr, cfg.Options, stopCh)
+	}
+	return svr.Run(stopCh)
 }
 
 func newConfig(opts *options.Options) (*config.Config, error) {
@@ -72,21 +101,81 @@ func newConfig(opts *options.Options) (*config.Config, error) {
 		return nil, fmt.Errorf("error building kubernetes clientset: %s", err.Error())
 	}
 
-	informerFactory := informers.NewSharedInformerFactory(kubeClient, time.Second*30)
+	informerFactory := informers.NewInformerFactory(kubeClient, opts.InformerResync)
+	// register all the informers needed up front, so that they are started and synced together
+	informerFactory.Core().V1().Nodes().Informer()
+	informerFactory.Core().V1().Pods().Informer()
+	informerFactory.Core().V1().PersistentVolumes().Informer()
+	informerFactory.Core().V1().PersistentVolumeClaims().Informer()
 
-	options := &config.OptionConfig{
-		ListenPort:             opts.Port,
-		ReservedCpuAnnoKey:     opts.ReservedCpuAnnoKey,
-		ReservedMemAnnoKey:     opts.ReservedMemAnnoKey,
-		ConsiderUnboundLocalPV: opts.ConsiderUnboundLocalPV,
-	}
+	options := newOptionConfig(opts)
 
 	config := &config.Config{
 		Options: options,
 
 		Client:          kubeClient,
 		InformerFactory: informerFactory,
+
+		State: &config.State{},
 	}
 
 	return config, nil
 }
+
+func newOptionConfig(opts *options.Options) *config.OptionConfig {
+	return &config.OptionConfig{
+		ListenPort:          opts.Port,
+		MaxRequestBodyBytes: opts.MaxRequestBodyBytes,
+		RequestTimeout:      opts.RequestTimeout,
+		CacheSyncTimeout:    opts.CacheSyncTimeout,
+		InformerResync:      opts.InformerResync,
+		ShutdownDrainPeriod: opts.ShutdownDrainPeriod,
+		ShutdownTimeout:     opts.ShutdownTimeout,
+
+		TLSCertFile:       opts.TLSCertFile,
+		TLSPrivateKeyFile: opts.TLSPrivateKeyFile,
+		ClientCAFile:      opts.ClientCAFile,
+
+		Handlers:            opts.Handlers,
+		HandlerPathPrefixes: opts.HandlerPathPrefixes,
+		PathPrefix:          opts.PathPrefix,
+
+		DelegatedAuth:        opts.DelegatedAuth,
+		AuthResourceGroup:    opts.AuthResourceGroup,
+		AuthResource:         opts.AuthResource,
+		AuthCacheTTL:         opts.AuthCacheTTL,
+		AuthAlwaysAllowUsers: opts.AuthAlwaysAllowUsers,
+		AuthExtenderHandlers: opts.AuthExtenderHandlers,
+
+		ReservedCpuAnnoKey:        opts.ReservedCpuAnnoKey,
+		ReservedMemAnnoKey:        opts.ReservedMemAnnoKey,
+		ReservedCpuAnnoKeyAliases: opts.ReservedCpuAnnoKeyAliases,
+		ReservedMemAnnoKeyAliases: opts.ReservedMemAnnoKeyAliases,
+		ConsiderUnboundLocalPV:    opts.ConsiderUnboundLocalPV,
+
+		FilterTimeout:       opts.FilterTimeout,
+		FilterTimeoutPolicy: opts.FilterTimeoutPolicy,
+		FilterMaxInFlight:   opts.FilterMaxInFlight,
+		FilterParallelism:   opts.FilterParallelism,
+		FilterFailurePolicy: opts.FilterFailurePolicy,
+		FilterCacheTTL:      opts.FilterCacheTTL,
+
+		FilterRecordFile:       opts.FilterRecordFile,
+		FilterRecordMaxBytes:   opts.FilterRecordMaxBytes,
+		FilterRecordMaxBackups: opts.FilterRecordMaxBackups,
+
+		LedgerResyncPeriod: opts.LedgerResyncPeriod,
+
+		LeaderElect:                  opts.LeaderElect,
+		LeaderElectLeaseDuration:     opts.LeaderElectLeaseDuration,
+		LeaderElectRenewDeadline:     opts.LeaderElectRenewDeadline,
+		LeaderElectRetryPeriod:       opts.LeaderElectRetryPeriod,
+		LeaderElectResourceLock:      opts.LeaderElectResourceLock,
+		LeaderElectResourceNamespace: opts.LeaderElectResourceNamespace,
+		LeaderElectResourceName:      opts.LeaderElectResourceName,
+
+		PublishNodeReservation:    opts.PublishNodeReservation,
+		PublishExtendedResources:  opts.PublishExtendedResources,
+		NodeReservationSyncPeriod: opts.NodeReservationSyncPeriod,
+	}
+}
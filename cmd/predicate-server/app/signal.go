@@ -0,0 +1,26 @@
+package app
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/golang/glog"
+)
+
+// setupSignalHandler returns a channel closed on SIGTERM or SIGINT.
+// A second signal exits directly.
+func setupSignalHandler() <-chan struct{} {
+	stopCh := make(chan struct{})
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-c
+		glog.V(0).Infof("Receive signal %s, shutting down", sig)
+		close(stopCh)
+		<-c
+		os.Exit(1)
+	}()
+
+	return stopCh
+}
@@ -0,0 +1,79 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/wu8685/lpv-res-predicate/cmd/predicate-server/app/options"
+	"github.com/wu8685/lpv-res-predicate/pkg/handlers/predicate"
+)
+
+func NewSimulateCommand() *cobra.Command {
+	opts := options.NewSimulateOptions()
+
+	cmd := &cobra.Command{
+		Use:   "simulate",
+		Short: "Predicate pods against a cluster loaded from files",
+		Long: `Predicate pods against the nodes, pods, persistent volumes and claims loaded from YAML or JSON files,
+such as dumped by 'kubectl get -o yaml', and print whether each pod fits each node with the reason.
+It does not connect to any API server, so that the reservation options can be tried before rolling them out.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := simulate(os.Stdout, opts); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	opts.AddFlags(cmd.Flags())
+
+	return cmd
+}
+
+func simulate(out io.Writer, opts *options.SimulateOptions) error {
+	if err := completeOptions(opts.Options, opts.Validate); err != nil {
+		return err
+	}
+
+	objects, err := loadObjects(opts.ClusterFiles)
+	if err != nil {
+		return err
+	}
+	podObjects, err := loadObjects(opts.PodFiles)
+	if err != nil {
+		return err
+	}
+	pods, err := podsOf(podObjects)
+	if err != nil {
+		return err
+	}
+
+	results, err := predicate.Simulate(newOptionConfig(opts.Options), objects, pods)
+	if err != nil {
+		return err
+	}
+
+	if opts.Output == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "POD\tNODE\tFIT\tREASON")
+	for _, pod := range results {
+		for _, node := range pod.Nodes {
+			reason := node.Reason
+			if len(node.Error) > 0 {
+				reason = "error: " + node.Error
+			}
+			fmt.Fprintf(w, "%s\t%s\t%v\t%s\n", pod.Pod, node.Node, node.Fit, reason)
+		}
+	}
+	return w.Flush()
+}
@@ -9,8 +9,11 @@ import (
 	"k8s.io/apiserver/pkg/util/logs"
 
 	"github.com/wu8685/lpv-res-predicate/cmd/predicate-server/app"
+	_ "github.com/wu8685/lpv-res-predicate/pkg/controllers/nodereservation"
 	_ "github.com/wu8685/lpv-res-predicate/pkg/handlers/health"
+	_ "github.com/wu8685/lpv-res-predicate/pkg/handlers/metrics"
 	_ "github.com/wu8685/lpv-res-predicate/pkg/handlers/predicate"
+	_ "github.com/wu8685/lpv-res-predicate/pkg/middlewares/auth"
 )
 
 func main() {
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"time"
+
 	"k8s.io/client-go/informers"
 	clientset "k8s.io/client-go/kubernetes"
 )
@@ -10,12 +12,81 @@ type Config struct {
 
 	Client          clientset.Interface
 	InformerFactory informers.SharedInformerFactory
+
+	State *State
 }
 
+// OptionConfig is immutable once built, reloaded options are delivered as a new one.
 type OptionConfig struct {
 	ListenPort           int
-	ReservedCpuAnnoKey   string
-	ReservedMemAnnoKey   string
+	MaxRequestBodyBytes  int64
+	RequestTimeout       time.Duration
+	CacheSyncTimeout     time.Duration
+	InformerResync       time.Duration
+	ShutdownDrainPeriod  time.Duration
+	ShutdownTimeout      time.Duration
+
+	TLSCertFile       string
+	TLSPrivateKeyFile string
+	ClientCAFile      string
+
+	Handlers            []string
+	HandlerPathPrefixes map[string]string
+	PathPrefix          string
+
+	DelegatedAuth        bool
+	AuthResourceGroup    string
+	AuthResource         string
+	AuthCacheTTL         time.Duration
+	AuthAlwaysAllowUsers []string
+	AuthExtenderHandlers []string
+
+	ReservedCpuAnnoKey string
+	ReservedMemAnnoKey string
+	// the keys read in priority order if the key above is absent, such as the old keys during a migration
+	ReservedCpuAnnoKeyAliases []string
+	ReservedMemAnnoKeyAliases []string
 
 	ConsiderUnboundLocalPV bool
+
+	FilterTimeout       time.Duration
+	FilterTimeoutPolicy string
+	FilterMaxInFlight   int
+	FilterParallelism   int
+	FilterFailurePolicy string
+	FilterCacheTTL      time.Duration
+
+	FilterRecordFile       string
+	FilterRecordMaxBytes   int64
+	FilterRecordMaxBackups int
+
+	LedgerResyncPeriod time.Duration
+
+	LeaderElect                  bool
+	LeaderElectLeaseDuration     time.Duration
+	LeaderElectRenewDeadline     time.Duration
+	LeaderElectRetryPeriod       time.Duration
+	LeaderElectResourceLock      string
+	LeaderElectResourceNamespace string
+	LeaderElectResourceName      string
+
+	PublishNodeReservation    bool
+	PublishExtendedResources  bool
+	NodeReservationSyncPeriod time.Duration
+}
+
+// WithReloadable returns a copy of the config with the options taking effect without restart taken from another config.
+func (o *OptionConfig) WithReloadable(from *OptionConfig) *OptionConfig {
+	reloaded := *o
+	reloaded.ReservedCpuAnnoKey = from.ReservedCpuAnnoKey
+	reloaded.ReservedMemAnnoKey = from.ReservedMemAnnoKey
+	reloaded.ReservedCpuAnnoKeyAliases = from.ReservedCpuAnnoKeyAliases
+	reloaded.ReservedMemAnnoKeyAliases = from.ReservedMemAnnoKeyAliases
+	reloaded.ConsiderUnboundLocalPV = from.ConsiderUnboundLocalPV
+	reloaded.FilterTimeout = from.FilterTimeout
+	reloaded.FilterTimeoutPolicy = from.FilterTimeoutPolicy
+	reloaded.FilterParallelism = from.FilterParallelism
+	reloaded.FilterFailurePolicy = from.FilterFailurePolicy
+	reloaded.FilterCacheTTL = from.FilterCacheTTL
+	return &reloaded
 }
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"sync/atomic"
+)
+
+// State is the runtime state of the server shared by handlers and controllers.
+type State struct {
+	synced       int32
+	shuttingDown int32
+
+	leaderElection int32
+	leading        int32
+	leader         atomic.Value
+}
+
+// Synced returns whether the informer caches have been synced.
+func (s *State) Synced() bool {
+	return atomic.LoadInt32(&s.synced) == 1
+}
+
+func (s *State) SetSynced() {
+	atomic.StoreInt32(&s.synced, 1)
+}
+
+// ShuttingDown returns whether the server is shutting down and should not receive new requests.
+func (s *State) ShuttingDown() bool {
+	return atomic.LoadInt32(&s.shuttingDown) == 1
+}
+
+func (s *State) SetShuttingDown() {
+	atomic.StoreInt32(&s.shuttingDown, 1)
+}
+
+// LeaderElection returns whether the leader election is enabled.
+func (s *State) LeaderElection() bool {
+	return atomic.LoadInt32(&s.leaderElection) == 1
+}
+
+func (s *State) SetLeaderElection() {
+	atomic.StoreInt32(&s.leaderElection, 1)
+}
+
+// Leading returns whether this replica is the leader.
+func (s *State) Leading() bool {
+	return atomic.LoadInt32(&s.leading) == 1
+}
+
+func (s *State) SetLeading(leading bool) {
+	if leading {
+		atomic.StoreInt32(&s.leading, 1)
+	} else {
+		atomic.StoreInt32(&s.leading, 0)
+	}
+}
+
+// Leader returns the identity of the last observed leader.
+func (s *State) Leader() string {
+	leader, _ := s.leader.Load().(string)
+	return leader
+}
+
+func (s *State) SetLeader(identity string) {
+	s.leader.Store(identity)
+}
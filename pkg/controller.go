@@ -0,0 +1,25 @@
+package pkg
+
+import (
+	"fmt"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+)
+
+// ControllerInit returns a nil Controller if the controller is not enabled by the config.
+type ControllerInit func(*config.Config) (Controller, error)
+
+// Controller is run after the informer caches are synced.
+type Controller interface {
+	Run(stopCh <-chan struct{})
+}
+
+func RegisterControllerInit(name string, controllerInit ControllerInit) {
+	if _, exist := controllerInits[name]; exist {
+		panic(fmt.Sprintf("controller init %s already exist", name))
+	}
+
+	controllerInits[name] = controllerInit
+}
+
+var controllerInits = map[string]ControllerInit{}
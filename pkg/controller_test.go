@@ -0,0 +1,21 @@
+package pkg
+
+import (
+	"testing"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+)
+
+func TestDuplicateController(t *testing.T) {
+	tmpInit := func(*config.Config) (Controller, error) {
+		return nil, nil
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("expecting panic")
+		}
+	}()
+	RegisterControllerInit("exist", tmpInit)
+	RegisterControllerInit("exist", tmpInit)
+}
@@ -0,0 +1,188 @@
+package nodereservation
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	clientset "k8s.io/client-go/kubernetes"
+	listerv1 "k8s.io/client-go/listers/core/v1"
+
+	"github.com/wu8685/lpv-res-predicate/pkg"
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+	"github.com/wu8685/lpv-res-predicate/pkg/handlers/predicate"
+)
+
+const (
+	ReservedCpuAnnoKey   = "lpv-res-predicate/reserved-cpu"
+	ReservedMemAnnoKey   = "lpv-res-predicate/reserved-mem"
+	UnreservedCpuAnnoKey = "lpv-res-predicate/unreserved-cpu"
+	UnreservedMemAnnoKey = "lpv-res-predicate/unreserved-mem"
+
+	// extended resources have to be integers, so cpu is published in millicores
+	ReservedCpuResource   v1.ResourceName = "lpv-res-predicate/reserved-milli-cpu"
+	ReservedMemResource   v1.ResourceName = "lpv-res-predicate/reserved-mem"
+	UnreservedCpuResource v1.ResourceName = "lpv-res-predicate/unreserved-milli-cpu"
+	UnreservedMemResource v1.ResourceName = "lpv-res-predicate/unreserved-mem"
+)
+
+func init() {
+	pkg.RegisterControllerInit("node-reservation", NewPublisher)
+}
+
+// Publisher periodically publishes the reserved and unreserved resources of each node,
+// so that tools other than the scheduler extender can see them.
+type Publisher struct {
+	cfg        *config.OptionConfig
+	client     clientset.Interface
+	nodeLister listerv1.NodeLister
+	calculator predicate.ReservationCalculator
+}
+
+func NewPublisher(cfg *config.Config) (pkg.Controller, error) {
+	if !cfg.Options.PublishNodeReservation {
+		return nil, nil
+	}
+
+	calculator, err := predicate.NewReservationCalculator(cfg)
+	if err != nil {
+		return nil, err
+	}
+	publisher := &Publisher{
+		cfg:        cfg.Options,
+		client:     cfg.Client,
+		nodeLister: cfg.InformerFactory.Core().V1().Nodes().Lister(),
+		calculator: calculator,
+	}
+	return publisher, nil
+}
+
+// Reload applies the reloaded options to the reservation calculation,
+// while the publishing options require restart.
+func (p *Publisher) Reload(options *config.OptionConfig) {
+	if reloadable, ok := p.calculator.(pkg.Reloadable); ok {
+		reloadable.Reload(options)
+	}
+}
+
+func (p *Publisher) Run(stopCh <-chan struct{}) {
+	glog.V(0).Infof("Start publishing node reservation every %s", p.cfg.NodeReservationSyncPeriod)
+	wait.Until(p.sync, p.cfg.NodeReservationSyncPeriod, stopCh)
+}
+
+func (p *Publisher) sync() {
+	if glog.V(2) {
+		startTime := time.Now()
+		defer func() {
+			glog.V(2).Infof("Publish node reservation cost %s", time.Now().Sub(startTime).String())
+		}()
+	}
+
+	nodes, err := p.nodeLister.List(labels.Everything())
+	if err != nil {
+		glog.Errorf("Fail to list nodes to publish reservation: %s", err)
+		return
+	}
+
+	for _, node := range nodes {
+		if err := p.publish(node); err != nil {
+			glog.Errorf("Fail to publish reservation of node %s: %s", node.Name, err)
+		}
+	}
+}
+
+func (p *Publisher) publish(node *v1.Node) error {
+	reservation, err := p.calculator.NodeReservation(node)
+	if err != nil {
+		return fmt.Errorf("fail to calculate reservation: %s", err)
+	}
+
+	annotations := reservationAnnotations(reservation)
+	if !annotationsUpToDate(node, annotations) {
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": annotations,
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		glog.V(2).Infof("Publish reservation annotations of node %s: %v", node.Name, annotations)
+		if _, err := p.client.CoreV1().Nodes().Patch(node.Name, types.StrategicMergePatchType, patch); err != nil {
+			return fmt.Errorf("fail to patch annotations: %s", err)
+		}
+	}
+
+	if !p.cfg.PublishExtendedResources {
+		return nil
+	}
+
+	resources := reservationResources(reservation)
+	if !resourcesUpToDate(node, resources) {
+		patch, err := json.Marshal(map[string]interface{}{
+			"status": map[string]interface{}{
+				"capacity": resources,
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		glog.V(2).Infof("Publish reservation extended resources of node %s: %v", node.Name, resources)
+		if _, err := p.client.CoreV1().Nodes().Patch(node.Name, types.StrategicMergePatchType, patch, "status"); err != nil {
+			return fmt.Errorf("fail to patch status: %s", err)
+		}
+	}
+	return nil
+}
+
+func reservationAnnotations(r *predicate.NodeReservation) map[string]string {
+	return map[string]string{
+		ReservedCpuAnnoKey:   r.ReservedCpu.String(),
+		ReservedMemAnnoKey:   r.ReservedMem.String(),
+		UnreservedCpuAnnoKey: r.UnreservedCpu.String(),
+		UnreservedMemAnnoKey: r.UnreservedMem.String(),
+	}
+}
+
+func reservationResources(r *predicate.NodeReservation) v1.ResourceList {
+	return v1.ResourceList{
+		ReservedCpuResource:   nonNegative(*resource.NewQuantity(r.ReservedCpu.MilliValue(), resource.DecimalSI)),
+		ReservedMemResource:   nonNegative(*resource.NewQuantity(r.ReservedMem.Value(), resource.BinarySI)),
+		UnreservedCpuResource: nonNegative(*resource.NewQuantity(r.UnreservedCpu.MilliValue(), resource.DecimalSI)),
+		UnreservedMemResource: nonNegative(*resource.NewQuantity(r.UnreservedMem.Value(), resource.BinarySI)),
+	}
+}
+
+// the unreserved resources are negative if pods already take part of the reservation
+func nonNegative(q resource.Quantity) resource.Quantity {
+	if q.Sign() < 0 {
+		return *resource.NewQuantity(0, q.Format)
+	}
+	return q
+}
+
+func annotationsUpToDate(node *v1.Node, annotations map[string]string) bool {
+	for key, value := range annotations {
+		if current, exist := node.Annotations[key]; !exist || current != value {
+			return false
+		}
+	}
+	return true
+}
+
+func resourcesUpToDate(node *v1.Node, resources v1.ResourceList) bool {
+	for name, quantity := range resources {
+		if current, exist := node.Status.Capacity[name]; !exist || current.Cmp(quantity) != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package nodereservation
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/handlers/predicate"
+)
+
+func TestPublishedReservation(t *testing.T) {
+	reservation := &predicate.NodeReservation{
+		ReservedCpu:   resource.MustParse("1500m"),
+		ReservedMem:   resource.MustParse("1Gi"),
+		UnreservedCpu: resource.MustParse("-500m"),
+		UnreservedMem: resource.MustParse("2Gi"),
+	}
+
+	node := &v1.Node{}
+	node.Annotations = reservationAnnotations(reservation)
+	if !annotationsUpToDate(node, reservationAnnotations(reservation)) {
+		t.Fatal("expected annotations up to date")
+	}
+	if node.Annotations[UnreservedCpuAnnoKey] != "-500m" {
+		t.Fatalf("unexpected unreserved cpu annotation %s", node.Annotations[UnreservedCpuAnnoKey])
+	}
+
+	resources := reservationResources(reservation)
+	reservedCpu := resources[ReservedCpuResource]
+	if reservedCpu.Value() != 1500 {
+		t.Fatalf("unexpected reserved milli cpu %v", resources[ReservedCpuResource])
+	}
+	unreservedCpu := resources[UnreservedCpuResource]
+	if unreservedCpu.Value() != 0 {
+		t.Fatalf("expected negative unreserved cpu published as 0, got %v", resources[UnreservedCpuResource])
+	}
+
+	node.Status.Capacity = resources
+	if !resourcesUpToDate(node, reservationResources(reservation)) {
+		t.Fatal("expected resources up to date")
+	}
+
+	reservation.ReservedMem = resource.MustParse("2Gi")
+	if resourcesUpToDate(node, reservationResources(reservation)) {
+		t.Fatal("expected resources out of date")
+	}
+}
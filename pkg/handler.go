@@ -3,6 +3,8 @@ package pkg
 import (
 	"fmt"
 	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/wu8685/lpv-res-predicate/pkg/config"
 )
@@ -13,6 +15,16 @@ type Handler interface {
 	RestInfos() []RestInfo
 }
 
+// Reloadable is implemented by handlers and controllers which apply reloaded options without restart.
+type Reloadable interface {
+	Reload(*config.OptionConfig)
+}
+
+// Runnable is implemented by handlers running in background once the informer caches are synced, until stopped.
+type Runnable interface {
+	Run(stopCh <-chan struct{})
+}
+
 type RestInfo struct {
 	Path    string
 	Methods []string
@@ -27,4 +39,60 @@ func RegisterHandlerInit(name string, handlerInit HandlerInit) {
 	restHandlerInits[name] = handlerInit
 }
 
-var restHandlerInits = map[string]HandlerInit{}
\ No newline at end of file
+var restHandlerInits = map[string]HandlerInit{}
+
+// RegisteredHandlers returns the names of all the registered handlers in order.
+func RegisteredHandlers() []string {
+	names := make([]string, 0, len(restHandlerInits))
+	for name := range restHandlerInits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsHandlerEnabled tells whether the handler is enabled by a list like "*,-foo,bar",
+// where '*' enables all the handlers not disabled by '-' explicitly.
+func IsHandlerEnabled(name string, handlers []string) bool {
+	hasStar := false
+	for _, handler := range handlers {
+		if handler == name {
+			return true
+		}
+		if handler == "-"+name {
+			return false
+		}
+		if handler == "*" {
+			hasStar = true
+		}
+	}
+	return hasStar
+}
+
+// HandlerPath returns the path of a REST API of the handler, mounted under the global path prefix
+// and the path prefix of the handler, which is the handler name if not remapped.
+func HandlerPath(opts *config.OptionConfig, name, subPath string) string {
+	prefix, exist := opts.HandlerPathPrefixes[name]
+	if !exist {
+		prefix = name
+	}
+	return joinPath(opts.PathPrefix, prefix, subPath)
+}
+
+func validateHandlerNames(opts *config.OptionConfig) error {
+	for _, handler := range opts.Handlers {
+		name := strings.TrimPrefix(handler, "-")
+		if name == "*" {
+			continue
+		}
+		if _, exist := restHandlerInits[name]; !exist {
+			return fmt.Errorf("unknown handler %s, should be one of %v", name, RegisteredHandlers())
+		}
+	}
+	for name := range opts.HandlerPathPrefixes {
+		if _, exist := restHandlerInits[name]; !exist {
+			return fmt.Errorf("unknown handler %s with path prefix, should be one of %v", name, RegisteredHandlers())
+		}
+	}
+	return nil
+}
\ No newline at end of file
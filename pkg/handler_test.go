@@ -19,3 +19,38 @@ func TestDuplicateHandler(t *testing.T) {
 	RegisterHandlerInit("exist", tmpInit)
 	RegisterHandlerInit("exist", tmpInit)
 }
+
+func TestIsHandlerEnabled(t *testing.T) {
+	for _, c := range []struct {
+		handlers []string
+		enabled  bool
+	}{
+		{[]string{"*"}, true},
+		{[]string{"foo"}, true},
+		{[]string{"bar"}, false},
+		{[]string{"*", "-foo"}, false},
+		{[]string{"-foo", "*"}, false},
+		{[]string{}, false},
+	} {
+		if enabled := IsHandlerEnabled("foo", c.handlers); enabled != c.enabled {
+			t.Fatalf("expecting foo enabled %v by %v, got %v", c.enabled, c.handlers, enabled)
+		}
+	}
+}
+
+func TestHandlerPath(t *testing.T) {
+	opts := &config.OptionConfig{
+		HandlerPathPrefixes: map[string]string{"foo": "/filter/", "root": "/"},
+		PathPrefix:          "/lpv/",
+	}
+
+	if path := HandlerPath(opts, "foo", "/a"); path != "/lpv/filter/a" {
+		t.Fatalf("unexpected remapped path %s", path)
+	}
+	if path := HandlerPath(opts, "bar", ""); path != "/lpv/bar" {
+		t.Fatalf("unexpected default path %s", path)
+	}
+	if path := HandlerPath(opts, "root", "a"); path != "/lpv/a" {
+		t.Fatalf("unexpected path under root %s", path)
+	}
+}
@@ -1,6 +1,7 @@
 package health
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/golang/glog"
@@ -11,13 +12,18 @@ import (
 
 func init() {
 	pkg.RegisterHandlerInit("health", NewHealthChecker)
+	pkg.RegisterHandlerInit("healthz", NewHealthChecker)
+	pkg.RegisterHandlerInit("readyz", NewReadinessChecker)
 }
 
 type HealthChecker struct {
+	state *config.State
 }
 
 func NewHealthChecker(cfg *config.Config) (pkg.Handler, error) {
-	return &HealthChecker{}, nil
+	return &HealthChecker{
+		state: cfg.State,
+	}, nil
 }
 
 func (h *HealthChecker) RestInfos() []pkg.RestInfo {
@@ -30,7 +36,16 @@ func (h *HealthChecker) RestInfos() []pkg.RestInfo {
 	}
 }
 
+// health checks are too frequent to log, and probes carry no credential
+func (h *HealthChecker) SkipMiddlewares() []string {
+	return []string{pkg.AccessLogMiddleware, pkg.AuthMiddleware}
+}
+
 func (h *HealthChecker) health(w http.ResponseWriter, r *http.Request) {
 	glog.V(2).Infof("Handle health check")
 	w.Write([]byte("OK"))
+
+	if h.state != nil && h.state.LeaderElection() {
+		fmt.Fprintf(w, "\nleading: %v\nleader: %s", h.state.Leading(), h.state.Leader())
+	}
 }
\ No newline at end of file
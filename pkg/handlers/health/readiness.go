@@ -0,0 +1,77 @@
+package health
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/golang/glog"
+	clientset "k8s.io/client-go/kubernetes"
+
+	"github.com/wu8685/lpv-res-predicate/pkg"
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+)
+
+// ReadinessChecker reports ready only when the informer caches are synced,
+// the API server is reachable and the server is not shutting down.
+type ReadinessChecker struct {
+	state  *config.State
+	client clientset.Interface
+}
+
+func NewReadinessChecker(cfg *config.Config) (pkg.Handler, error) {
+	return &ReadinessChecker{
+		state:  cfg.State,
+		client: cfg.Client,
+	}, nil
+}
+
+func (h *ReadinessChecker) RestInfos() []pkg.RestInfo {
+	return []pkg.RestInfo{
+		{
+			"/",
+			[]string{"GET"},
+			h.ready,
+		},
+	}
+}
+
+func (h *ReadinessChecker) SkipMiddlewares() []string {
+	return []string{pkg.AccessLogMiddleware, pkg.AuthMiddleware}
+}
+
+func (h *ReadinessChecker) ready(w http.ResponseWriter, r *http.Request) {
+	glog.V(2).Infof("Handle readiness check")
+
+	buf := &bytes.Buffer{}
+	ready := true
+	check := func(name string, err error) {
+		if err != nil {
+			ready = false
+			fmt.Fprintf(buf, "[-]%s failed: %s\n", name, err)
+			return
+		}
+		fmt.Fprintf(buf, "[+]%s ok\n", name)
+	}
+
+	var syncErr error
+	if !h.state.Synced() {
+		syncErr = fmt.Errorf("informer caches are not synced yet")
+	}
+	check("informer-sync", syncErr)
+
+	_, apiErr := h.client.Discovery().ServerVersion()
+	check("apiserver", apiErr)
+
+	var shutdownErr error
+	if h.state.ShuttingDown() {
+		shutdownErr = fmt.Errorf("server is shutting down")
+	}
+	check("shutdown", shutdownErr)
+
+	if !ready {
+		glog.V(1).Infof("Not ready:\n%s", buf.String())
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(buf.Bytes())
+}
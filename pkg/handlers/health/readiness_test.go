@@ -0,0 +1,66 @@
+package health
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+)
+
+func TestReadiness(t *testing.T) {
+	apiserver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"major": "1", "minor": "12"}`))
+	}))
+	defer apiserver.Close()
+
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: apiserver.URL})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	cfg := &config.Config{
+		Client: client,
+		State:  &config.State{},
+	}
+	handler, err := NewReadinessChecker(cfg)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	checker := handler.(*ReadinessChecker)
+
+	w := httptest.NewRecorder()
+	checker.ready(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected not ready before caches are synced, got %d: %s", w.Code, w.Body.String())
+	}
+
+	cfg.State.SetSynced()
+	w = httptest.NewRecorder()
+	checker.ready(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected ready, got %d: %s", w.Code, w.Body.String())
+	}
+
+	cfg.State.SetShuttingDown()
+	w = httptest.NewRecorder()
+	checker.ready(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected not ready when shutting down, got %d: %s", w.Code, w.Body.String())
+	}
+
+	cfg.State = &config.State{}
+	cfg.State.SetSynced()
+	handler, _ = NewReadinessChecker(cfg)
+	checker = handler.(*ReadinessChecker)
+	apiserver.Close()
+	w = httptest.NewRecorder()
+	checker.ready(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected not ready when apiserver is unreachable, got %d: %s", w.Code, w.Body.String())
+	}
+}
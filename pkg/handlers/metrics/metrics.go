@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/wu8685/lpv-res-predicate/pkg"
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+)
+
+func init() {
+	pkg.RegisterHandlerInit("metrics", NewMetricsHandler)
+}
+
+// MetricsHandler exposes the metrics in the Prometheus format.
+type MetricsHandler struct {
+	handler http.Handler
+}
+
+func NewMetricsHandler(cfg *config.Config) (pkg.Handler, error) {
+	return &MetricsHandler{
+		handler: prometheus.Handler(),
+	}, nil
+}
+
+func (h *MetricsHandler) RestInfos() []pkg.RestInfo {
+	return []pkg.RestInfo{
+		{
+			"/",
+			[]string{"GET"},
+			h.handler.ServeHTTP,
+		},
+	}
+}
+
+// scraping is too frequent to log
+func (h *MetricsHandler) SkipMiddlewares() []string {
+	return []string{pkg.AccessLogMiddleware}
+}
@@ -0,0 +1,263 @@
+package predicate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+)
+
+// AnnotateFormats are the formats the results of Annotate are written in.
+var AnnotateFormats = []string{"diff", "json"}
+
+// annotateConflictRetries is how many times the update of a PV modified concurrently is retried on the latest one.
+const annotateConflictRetries = 5
+
+// PVSelector selects the local PVs matching all of the criteria given.
+type PVSelector struct {
+	// the labels of the PV, all if nil
+	Labels labels.Selector
+	// the StorageClass of the PV, any if empty
+	StorageClass string
+	// the name of the node whose local PVs are selected, any if empty
+	Node string
+	// the pattern of the PV name, in the syntax of path.Match, any if empty
+	NamePattern string
+}
+
+// ReservationChange is how the reservation annotations of the selected PVs are changed.
+type ReservationChange struct {
+	// the quantity to set the reserved cpu to, nil to keep it or empty to remove it
+	Cpu *string
+	// the quantity to set the reserved memory to, nil to keep it or empty to remove it
+	Mem *string
+	// whether to change an annotation already set to another value, otherwise the PV is left unchanged with an error
+	Overwrite bool
+}
+
+func (c ReservationChange) validate() error {
+	if c.Cpu == nil && c.Mem == nil {
+		return fmt.Errorf("neither the reserved cpu nor memory is changed")
+	}
+	for _, value := range []*string{c.Cpu, c.Mem} {
+		if value == nil || len(*value) == 0 {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(*value)
+		if err != nil {
+			return fmt.Errorf("invalid quantity %q: %w", *value, err)
+		}
+		if quantity.Sign() < 0 {
+			return fmt.Errorf("quantity %s should not be negative", *value)
+		}
+	}
+	return nil
+}
+
+// AnnotationChange is an annotation of a PV changed from Old to New, either of which is empty if it is not set.
+type AnnotationChange struct {
+	Key string `json:"key"`
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+// PVAnnotation is the result of changing the annotations of a selected PV.
+type PVAnnotation struct {
+	PV      string             `json:"pv"`
+	Changes []AnnotationChange `json:"changes,omitempty"`
+	// whether the changes are updated, false on dry run or on error
+	Applied bool   `json:"applied"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Annotate changes the reservation annotations of the PVs selected in the cluster made of the objects,
+// through the API server of the client in the config if not on dry run.
+// The objects should be the full ones listed from the API server, so that no field is lost on update.
+func Annotate(cfg *config.Config, objects []runtime.Object, selector PVSelector, change ReservationChange, dryRun bool) ([]PVAnnotation, error) {
+	accessor, err := newMemoryAccessor(objects)
+	if err != nil {
+		return nil, err
+	}
+	accessor.cfg = cfg
+	return annotate(cfg.Options, accessor, selector, change, dryRun)
+}
+
+// annotate returns the results of the selected PVs in the order of their names.
+// A PV failing to be updated is reported in its result, without stopping the others.
+func annotate(options *config.OptionConfig, accessor resourceAccessor, selector PVSelector, change ReservationChange, dryRun bool) ([]PVAnnotation, error) {
+	if err := change.validate(); err != nil {
+		return nil, err
+	}
+	pvs, err := selector.selectPVs(accessor)
+	if err != nil {
+		return nil, err
+	}
+	return updateAnnotations(accessor, pvs, dryRun, func(pv *v1.PersistentVolume) (*v1.PersistentVolume, []AnnotationChange, error) {
+		return change.apply(options, pv)
+	}), nil
+}
+
+// updateAnnotations updates the PVs with the annotations changed by apply, which is applied again on the latest PV on conflict.
+func updateAnnotations(accessor resourceAccessor, pvs []*v1.PersistentVolume, dryRun bool,
+	apply func(pv *v1.PersistentVolume) (*v1.PersistentVolume, []AnnotationChange, error)) []PVAnnotation {
+	results := make([]PVAnnotation, 0, len(pvs))
+	for _, pv := range pvs {
+		result := PVAnnotation{PV: pv.Name}
+		for attempt := 0; ; attempt++ {
+			updated, changes, err := apply(pv)
+			result.Changes = changes
+			if err != nil {
+				result.Error = err.Error()
+				break
+			}
+			if len(changes) == 0 || dryRun {
+				break
+			}
+
+			_, err = accessor.UpdatePersistentVolume(updated)
+			if errors.Is(err, ErrConflict) && attempt < annotateConflictRetries {
+				// apply the changes again on the latest PV
+				if pv, err = accessor.GetPersistentVolume(pv.Name); err == nil {
+					continue
+				}
+			}
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Applied = true
+			}
+			break
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (s PVSelector) selectPVs(accessor resourceAccessor) ([]*v1.PersistentVolume, error) {
+	var pvs []*v1.PersistentVolume
+	var err error
+	if len(s.Node) > 0 {
+		if _, err := accessor.GetNode(s.Node); err != nil {
+			return nil, err
+		}
+		pvs, err = accessor.GetLocalPersistentVolumesOnNode(s.Node)
+	} else {
+		pvs, err = accessor.GetAllPersistentVolume()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	selected := []*v1.PersistentVolume{}
+	for _, pv := range pvs {
+		// the reservation on a PV which is not local is ignored
+		if pv.Spec.Local == nil {
+			continue
+		}
+		if s.Labels != nil && !s.Labels.Matches(labels.Set(pv.Labels)) {
+			continue
+		}
+		if len(s.StorageClass) > 0 && pv.Spec.StorageClassName != s.StorageClass {
+			continue
+		}
+		if len(s.NamePattern) > 0 {
+			matched, err := path.Match(s.NamePattern, pv.Name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid name pattern %q: %w", s.NamePattern, err)
+			}
+			if !matched {
+				continue
+			}
+		}
+		selected = append(selected, pv)
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].Name < selected[j].Name })
+	return selected, nil
+}
+
+// apply returns a copy of the PV with the changed annotations, or an error if an annotation is set to another value without overwriting.
+// The aliases of the keys are removed along with the keys, and the aliases present on the PV are set along with the keys,
+// so that the reservation read through the aliases is changed as well.
+func (c ReservationChange) apply(options *config.OptionConfig, pv *v1.PersistentVolume) (*v1.PersistentVolume, []AnnotationChange, error) {
+	updated := pv.DeepCopy()
+	changes := []AnnotationChange{}
+	for _, r := range []struct {
+		key     string
+		aliases []string
+		value   *string
+	}{
+		{options.ReservedCpuAnnoKey, options.ReservedCpuAnnoKeyAliases, c.Cpu},
+		{options.ReservedMemAnnoKey, options.ReservedMemAnnoKeyAliases, c.Mem},
+	} {
+		if r.value == nil {
+			continue
+		}
+		for i, key := range append([]string{r.key}, r.aliases...) {
+			old, exist := updated.Annotations[key]
+			if len(*r.value) == 0 {
+				if exist {
+					changes = append(changes, AnnotationChange{Key: key, Old: old})
+					delete(updated.Annotations, key)
+				}
+				continue
+			}
+			// an alias absent is not set
+			if (i > 0 && !exist) || (exist && old == *r.value) {
+				continue
+			}
+			if exist && !c.Overwrite {
+				return nil, nil, fmt.Errorf("annotation %s is already set to %q, not overwritten", key, old)
+			}
+			if updated.Annotations == nil {
+				updated.Annotations = map[string]string{}
+			}
+			updated.Annotations[key] = *r.value
+			changes = append(changes, AnnotationChange{Key: key, Old: old, New: *r.value})
+		}
+	}
+	return updated, changes, nil
+}
+
+// WriteAnnotations writes the results in one of AnnotateFormats.
+func WriteAnnotations(w io.Writer, results []PVAnnotation, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	case "diff":
+		for _, result := range results {
+			status := "annotated"
+			if len(result.Error) > 0 {
+				status = "failed: " + result.Error
+			} else if len(result.Changes) == 0 {
+				status = "unchanged"
+			} else if !result.Applied {
+				status = "annotated (dry run)"
+			}
+			if _, err := fmt.Fprintf(w, "persistentvolume/%s %s\n", result.PV, status); err != nil {
+				return err
+			}
+			for _, change := range result.Changes {
+				if len(change.Old) > 0 {
+					fmt.Fprintf(w, "-  %s: %q\n", change.Key, change.Old)
+				}
+				if len(change.New) > 0 {
+					fmt.Fprintf(w, "+  %s: %q\n", change.Key, change.New)
+				}
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown format %s, should be one of %v", format, AnnotateFormats)
+	}
+}
@@ -0,0 +1,216 @@
+package predicate
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+)
+
+func TestAnnotate(t *testing.T) {
+	node1 := buildNode(t, "node1", "8", "16Gi")
+	node2 := buildNode(t, "node2", "8", "16Gi")
+	cpu := "1"
+	pv1 := buildPV("ssd-1", &node1.Name, &cpu, nil)
+	pv1.Labels = map[string]string{"tier": "ssd"}
+	pv2 := buildPV("ssd-2", &node2.Name, nil, nil)
+	pv2.Labels = map[string]string{"tier": "ssd"}
+	pv2.Spec.StorageClassName = "local"
+	hdd := buildPV("hdd-1", &node1.Name, nil, nil)
+	nonLocal := buildPV("ssd-nfs", nil, nil, nil)
+	objects := []runtime.Object{node1, node2, pv1, pv2, hdd, nonLocal}
+	cfg := &config.Config{Options: opts}
+
+	two, empty := "2", ""
+	selectors := []struct {
+		selector PVSelector
+		expected []string
+	}{
+		{PVSelector{}, []string{"hdd-1", "ssd-1", "ssd-2"}},
+		{PVSelector{Labels: labels.SelectorFromSet(labels.Set{"tier": "ssd"})}, []string{"ssd-1", "ssd-2"}},
+		{PVSelector{StorageClass: "local"}, []string{"ssd-2"}},
+		{PVSelector{Node: node1.Name}, []string{"hdd-1", "ssd-1"}},
+		{PVSelector{NamePattern: "ssd-*"}, []string{"ssd-1", "ssd-2"}},
+	}
+	for _, s := range selectors {
+		results, err := Annotate(cfg, objects, s.selector, ReservationChange{Cpu: &two}, true)
+		if err != nil {
+			t.Fatalf("unexpected err selecting %+v: %s", s.selector, err)
+		}
+		names := []string{}
+		for _, result := range results {
+			names = append(names, result.PV)
+		}
+		if !reflect.DeepEqual(names, s.expected) {
+			t.Fatalf("expecting %v selected by %+v, got %v", s.expected, s.selector, names)
+		}
+	}
+	if _, err := Annotate(cfg, objects, PVSelector{Node: "node3"}, ReservationChange{Cpu: &two}, true); err == nil {
+		t.Fatalf("expecting err of unknown node")
+	}
+	for _, change := range []ReservationChange{{}, {Cpu: &two, Mem: &[]string{"1 Gi"}[0]}} {
+		if _, err := Annotate(cfg, objects, PVSelector{}, change, true); err == nil {
+			t.Fatalf("expecting err of invalid change %+v", change)
+		}
+	}
+
+	// an annotation set to another value is not overwritten by default
+	accessor, err := newMemoryAccessor(objects)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	results, err := annotate(opts, accessor, PVSelector{NamePattern: "ssd-?"}, ReservationChange{Cpu: &two}, false)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(results[0].Error) == 0 || results[0].Applied || !results[1].Applied {
+		t.Fatalf("expecting ssd-1 skipped and ssd-2 annotated, got %+v", results)
+	}
+	results, err = annotate(opts, accessor, PVSelector{NamePattern: "ssd-?"}, ReservationChange{Cpu: &two, Mem: &empty, Overwrite: true}, false)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	expected := []PVAnnotation{
+		{PV: "ssd-1", Changes: []AnnotationChange{{Key: CPU_KEY, Old: "1", New: "2"}}, Applied: true},
+		{PV: "ssd-2", Changes: []AnnotationChange{}},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("expecting %+v, got %+v", expected, results)
+	}
+	if pv, _ := accessor.GetPersistentVolume("ssd-1"); pv.Annotations[CPU_KEY] != "2" || pv1.Annotations[CPU_KEY] != "1" {
+		t.Fatalf("expecting a copy of ssd-1 updated, got %v", pv.Annotations)
+	}
+
+	out := &bytes.Buffer{}
+	if err := WriteAnnotations(out, results, "diff"); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	diff := "persistentvolume/ssd-1 annotated\n" +
+		"-  " + CPU_KEY + ": \"1\"\n" +
+		"+  " + CPU_KEY + ": \"2\"\n" +
+		"persistentvolume/ssd-2 unchanged\n"
+	if out.String() != diff {
+		t.Fatalf("expecting diff %q, got %q", diff, out.String())
+	}
+}
+
+func TestAnnotateAliases(t *testing.T) {
+	node := buildNode(t, "node1", "8", "16Gi")
+	migrating := buildPV("migrating", &node.Name, nil, nil)
+	migrating.Annotations = map[string]string{"old-cpu": "1", "old-mem": "1Gi"}
+	migrated := buildPV("migrated", &node.Name, nil, nil)
+	migrated.Annotations = map[string]string{CPU_KEY: "2", "old-cpu": "2"}
+	plain := buildPV("plain", &node.Name, nil, nil)
+
+	options := &config.OptionConfig{
+		ReservedCpuAnnoKey:        CPU_KEY,
+		ReservedCpuAnnoKeyAliases: []string{"old-cpu"},
+		ReservedMemAnnoKey:        MEM_KEY,
+		ReservedMemAnnoKeyAliases: []string{"old-mem"},
+	}
+	accessor, err := newMemoryAccessor([]runtime.Object{node, migrating, migrated, plain})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	// an alias set to another value is not overwritten by default
+	two, three, empty := "2", "3", ""
+	results, err := annotate(options, accessor, PVSelector{}, ReservationChange{Cpu: &two}, true)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	expected := []PVAnnotation{
+		{PV: "migrated", Changes: []AnnotationChange{}},
+		{PV: "migrating", Error: `annotation old-cpu is already set to "1", not overwritten`},
+		{PV: "plain", Changes: []AnnotationChange{{Key: CPU_KEY, New: "2"}}},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("expecting %+v, got %+v", expected, results)
+	}
+
+	// the aliases present are overwritten along with the key
+	results, err = annotate(options, accessor, PVSelector{}, ReservationChange{Cpu: &three, Overwrite: true}, false)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	expected = []PVAnnotation{
+		{PV: "migrated", Changes: []AnnotationChange{{Key: CPU_KEY, Old: "2", New: "3"}, {Key: "old-cpu", Old: "2", New: "3"}}, Applied: true},
+		{PV: "migrating", Changes: []AnnotationChange{{Key: CPU_KEY, New: "3"}, {Key: "old-cpu", Old: "1", New: "3"}}, Applied: true},
+		{PV: "plain", Changes: []AnnotationChange{{Key: CPU_KEY, New: "3"}}, Applied: true},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("expecting %+v, got %+v", expected, results)
+	}
+
+	// the aliases are removed along with the key, so that the reservation is not read through them
+	results, err = annotate(options, accessor, PVSelector{NamePattern: "migrating"}, ReservationChange{Cpu: &empty, Mem: &empty}, false)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	changes := []AnnotationChange{{Key: CPU_KEY, Old: "3"}, {Key: "old-cpu", Old: "3"}, {Key: "old-mem", Old: "1Gi"}}
+	if len(results) != 1 || !reflect.DeepEqual(results[0].Changes, changes) {
+		t.Fatalf("expecting changes %+v, got %+v", changes, results)
+	}
+	pv, _ := accessor.GetPersistentVolume("migrating")
+	if considered, _ := considerReserveResource(pv, options); considered {
+		t.Fatalf("expecting no reservation left, got %v", pv.Annotations)
+	}
+}
+
+func TestAnnotateConflict(t *testing.T) {
+	node := buildNode(t, "node1", "8", "16Gi")
+	pv := buildPV("pv1", &node.Name, nil, nil)
+	pv.ResourceVersion = "1"
+	// modified concurrently by another writer
+	latest := pv.DeepCopy()
+	latest.ResourceVersion = "2"
+	latest.Labels = map[string]string{"owner": "other"}
+
+	puts := []*v1.PersistentVolume{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case "GET":
+			json.NewEncoder(w).Encode(latest)
+		case "PUT":
+			put := &v1.PersistentVolume{}
+			json.NewDecoder(r.Body).Decode(put)
+			puts = append(puts, put)
+			if put.ResourceVersion != latest.ResourceVersion {
+				w.WriteHeader(http.StatusConflict)
+				json.NewEncoder(w).Encode(apierrors.NewConflict(v1.Resource("persistentvolumes"), put.Name, nil).Status())
+				return
+			}
+			put.ResourceVersion = "3"
+			json.NewEncoder(w).Encode(put)
+		}
+	}))
+	defer server.Close()
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL, QPS: -1})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	cpu := "2"
+	results, err := Annotate(&config.Config{Options: opts, Client: client}, []runtime.Object{node, pv}, PVSelector{}, ReservationChange{Cpu: &cpu}, false)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(results) != 1 || !results[0].Applied {
+		t.Fatalf("expecting pv1 annotated after retry, got %+v", results)
+	}
+	if len(puts) != 2 || puts[1].Labels["owner"] != "other" || puts[1].Annotations[CPU_KEY] != "2" {
+		t.Fatalf("expecting the change applied again on the latest pv1, got %d updates", len(puts))
+	}
+}
@@ -0,0 +1,281 @@
+package predicate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/kubernetes/pkg/scheduler/api"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+	"github.com/wu8685/lpv-res-predicate/pkg/informers"
+)
+
+const benchNamespace = "bench"
+
+// syntheticCluster has the same number of pods and reserved local PVs on each node.
+// Half of the PVs are bound to claims mounted by the pods on the node, the others are unbound.
+type syntheticCluster struct {
+	nodes []*v1.Node
+	pods  []*v1.Pod
+	pvs   []*v1.PersistentVolume
+	pvcs  []*v1.PersistentVolumeClaim
+
+	nodeNames []string
+	// pods to schedule: one without volume, one with a bound claim and one with an unbound claim
+	incoming []*v1.Pod
+}
+
+func newSyntheticCluster(b testing.TB, nodeCount, podsPerNode, pvsPerNode int) *syntheticCluster {
+	c := &syntheticCluster{}
+	cpu, mem := "1", "1G"
+	for i := 0; i < nodeCount; i++ {
+		node := buildNode(b, fmt.Sprintf("node-%d", i), "64", "256G")
+		c.nodes = append(c.nodes, node)
+		c.nodeNames = append(c.nodeNames, node.Name)
+
+		claims := []string{}
+		for j := 0; j < pvsPerNode; j++ {
+			pv := buildPV(fmt.Sprintf("pv-%d-%d", i, j), &node.Name, &cpu, &mem)
+			if j%2 == 0 {
+				pvc := buildPVC(benchNamespace, fmt.Sprintf("pvc-%d-%d", i, j))
+				bind(pv, pvc)
+				c.pvcs = append(c.pvcs, pvc)
+				claims = append(claims, pvc.Name)
+			}
+			c.pvs = append(c.pvs, pv)
+		}
+
+		for j := 0; j < podsPerNode; j++ {
+			var pod *v1.Pod
+			if j < len(claims) {
+				pod = buildPod(b, benchNamespace, fmt.Sprintf("pod-%d-%d", i, j), []string{claims[j]}, []string{"500m"}, []string{"512Mi"})
+			} else {
+				pod = buildPod(b, benchNamespace, fmt.Sprintf("pod-%d-%d", i, j), []string{}, []string{"100m"}, []string{"128Mi"})
+			}
+			bindNode(pod, node.Name)
+			c.pods = append(c.pods, pod)
+		}
+	}
+
+	unbound := buildPVC(benchNamespace, "pvc-unbound")
+	c.pvcs = append(c.pvcs, unbound)
+	c.incoming = []*v1.Pod{
+		buildPod(b, benchNamespace, "incoming-plain", []string{}, []string{"2"}, []string{"4G"}),
+		buildPod(b, benchNamespace, "incoming-bound", []string{c.pvcs[0].Name}, []string{"500m"}, []string{"512Mi"}),
+		buildPod(b, benchNamespace, "incoming-unbound", []string{unbound.Name}, []string{"500m"}, []string{"512Mi"}),
+	}
+	for _, pod := range c.incoming {
+		pod.UID = types.UID(pod.Name)
+		pod.ResourceVersion = "1"
+	}
+	return c
+}
+
+// fakeAPIServer serves the lists of the cluster, and holds the watches until stopped.
+type fakeAPIServer struct {
+	lists  map[string]runtime.Object
+	stopCh <-chan struct{}
+}
+
+func (s *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	list, exist := s.lists[r.URL.Path]
+	if !exist {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Query().Get("watch") == "true" {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		select {
+		case <-s.stopCh:
+		case <-r.Context().Done():
+		}
+		return
+	}
+	json.NewEncoder(w).Encode(list)
+}
+
+// newBenchConfig returns the config whose informers are synced with the cluster served by a fake API server.
+func newBenchConfig(b *testing.B, cluster *syntheticCluster, options *config.OptionConfig) (*config.Config, <-chan struct{}) {
+	stopCh := make(chan struct{})
+	apiserver := &fakeAPIServer{
+		lists: map[string]runtime.Object{
+			"/api/v1/nodes":                  nodeList(cluster.nodes),
+			"/api/v1/pods":                   podList(cluster.pods),
+			"/api/v1/persistentvolumes":      pvList(cluster.pvs),
+			"/api/v1/persistentvolumeclaims": pvcList(cluster.pvcs),
+		},
+		stopCh: stopCh,
+	}
+	server := httptest.NewServer(apiserver)
+	b.Cleanup(server.Close)
+	b.Cleanup(func() { close(stopCh) })
+
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL, QPS: -1})
+	if err != nil {
+		b.Fatalf("unexpected err: %s", err)
+	}
+	cfg := &config.Config{
+		Client:          client,
+		InformerFactory: informers.NewInformerFactory(client, 0),
+		Options:         options,
+	}
+	return cfg, stopCh
+}
+
+func startBenchInformers(b *testing.B, cfg *config.Config, stopCh <-chan struct{}) {
+	cfg.InformerFactory.Start(stopCh)
+	for informer, synced := range cfg.InformerFactory.WaitForCacheSync(stopCh) {
+		if !synced {
+			b.Fatalf("fail to sync informer %v", informer)
+		}
+	}
+}
+
+func nodeList(nodes []*v1.Node) *v1.NodeList {
+	list := &v1.NodeList{}
+	list.ResourceVersion = "1"
+	for _, node := range nodes {
+		list.Items = append(list.Items, *node)
+	}
+	return list
+}
+
+func podList(pods []*v1.Pod) *v1.PodList {
+	list := &v1.PodList{}
+	list.ResourceVersion = "1"
+	for _, pod := range pods {
+		list.Items = append(list.Items, *pod)
+	}
+	return list
+}
+
+func pvList(pvs []*v1.PersistentVolume) *v1.PersistentVolumeList {
+	list := &v1.PersistentVolumeList{}
+	list.ResourceVersion = "1"
+	for _, pv := range pvs {
+		list.Items = append(list.Items, *pv)
+	}
+	return list
+}
+
+func pvcList(pvcs []*v1.PersistentVolumeClaim) *v1.PersistentVolumeClaimList {
+	list := &v1.PersistentVolumeClaimList{}
+	list.ResourceVersion = "1"
+	for _, pvc := range pvcs {
+		list.Items = append(list.Items, *pvc)
+	}
+	return list
+}
+
+var benchClusters = []struct {
+	nodes       int
+	podsPerNode int
+	pvsPerNode  int
+}{
+	{1000, 10, 4},
+	{5000, 10, 4},
+}
+
+func benchOptions() *config.OptionConfig {
+	options := *opts
+	options.ConsiderUnboundLocalPV = true
+	options.FilterParallelism = 16
+	options.FilterFailurePolicy = FilterFailurePolicyFailRequest
+	return &options
+}
+
+// BenchmarkFilter measures the /filter calls through the informers, with and without the reservation ledger and the decision cache.
+func BenchmarkFilter(b *testing.B) {
+	for _, size := range benchClusters {
+		for _, mode := range []struct{ withLedger, withCache bool }{{true, true}, {true, false}, {false, false}} {
+			withLedger := mode.withLedger
+			name := fmt.Sprintf("nodes=%d/pods=%d/ledger=%v/cache=%v", size.nodes, size.nodes*size.podsPerNode, withLedger, mode.withCache)
+			b.Run(name, func(b *testing.B) {
+				cluster := newSyntheticCluster(b, size.nodes, size.podsPerNode, size.pvsPerNode)
+				options := benchOptions()
+				if mode.withCache {
+					options.FilterCacheTTL = time.Hour
+				}
+				cfg, stopCh := newBenchConfig(b, cluster, options)
+				handler, err := newReloadableHandler(cfg)
+				if err != nil {
+					b.Fatalf("unexpected err: %s", err)
+				}
+				startBenchInformers(b, cfg, stopCh)
+				if withLedger {
+					go handler.Run(stopCh)
+					for handler.ledger.Snapshot() == nil {
+						time.Sleep(10 * time.Millisecond)
+					}
+				}
+
+				bodies := [][]byte{}
+				for _, pod := range cluster.incoming {
+					body, err := json.Marshal(&api.ExtenderArgs{Pod: pod, NodeNames: &cluster.nodeNames})
+					if err != nil {
+						b.Fatalf("unexpected err: %s", err)
+					}
+					bodies = append(bodies, body)
+					assertFilterResponse(b, filter(handler, body))
+				}
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					filter(handler, bodies[i%len(bodies)])
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkLedgerResync measures a full recompute of the reservation ledger.
+func BenchmarkLedgerResync(b *testing.B) {
+	for _, size := range benchClusters {
+		b.Run(fmt.Sprintf("nodes=%d/pods=%d", size.nodes, size.nodes*size.podsPerNode), func(b *testing.B) {
+			cluster := newSyntheticCluster(b, size.nodes, size.podsPerNode, size.pvsPerNode)
+			cfg, stopCh := newBenchConfig(b, cluster, benchOptions())
+			ledger, err := sharedReservationLedger(cfg)
+			if err != nil {
+				b.Fatalf("unexpected err: %s", err)
+			}
+			startBenchInformers(b, cfg, stopCh)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				ledger.resync()
+			}
+		})
+	}
+}
+
+func filter(handler *reloadableHandler, body []byte) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/lpvReservedResource", bytes.NewReader(body))
+	handler.RestInfos()[0].Handler(w, r)
+	return w
+}
+
+func assertFilterResponse(b *testing.B, w *httptest.ResponseRecorder) {
+	result := &FilterResult{}
+	if err := json.NewDecoder(w.Body).Decode(result); err != nil {
+		b.Fatalf("unexpected err: %s", err)
+	}
+	if len(result.Error) > 0 || result.NodeNames == nil || len(*result.NodeNames) == 0 {
+		b.Fatalf("unexpected filter result: %v", result)
+	}
+}
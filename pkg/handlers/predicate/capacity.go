@@ -0,0 +1,238 @@
+package predicate
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/wu8685/lpv-res-predicate/pkg"
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+)
+
+func init() {
+	pkg.RegisterHandlerInit("capacity", NewCapacityHandler)
+}
+
+// CapacityFormats are the formats a capacity report is written in.
+var CapacityFormats = []string{"table", "json", "csv"}
+
+// PodShape is the requests of the pods counted by a capacity report.
+type PodShape struct {
+	Cpu resource.Quantity
+	Mem resource.Quantity
+}
+
+// ParsePodShape requires both cpu and memory to be positive, so that the pods fitting on a node are bounded.
+func ParsePodShape(cpu, mem string) (PodShape, error) {
+	shape := PodShape{}
+	var err error
+	if shape.Cpu, err = resource.ParseQuantity(cpu); err != nil {
+		return shape, fmt.Errorf("invalid cpu %q: %w", cpu, err)
+	}
+	if shape.Mem, err = resource.ParseQuantity(mem); err != nil {
+		return shape, fmt.Errorf("invalid memory %q: %w", mem, err)
+	}
+	if shape.Cpu.Sign() <= 0 || shape.Mem.Sign() <= 0 {
+		return shape, fmt.Errorf("cpu %s and memory %s should be greater than 0", cpu, mem)
+	}
+	return shape, nil
+}
+
+// NodeHeadroom is how many more pods of a shape fit on a node.
+// The pods with and without a reserved local PV take resources from separate pools, so that they add up.
+type NodeHeadroom struct {
+	Node string `json:"node"`
+	// the pods mounting a reserved local PV on the node, fitting in the reservation left on the PVs
+	PodsWithPV int64 `json:"podsWithPV"`
+	// the pods without reserved local PV, fitting in the resources left after the reservation
+	PodsWithoutPV int64 `json:"podsWithoutPV"`
+
+	NodeReservation
+}
+
+// CapacityReport is the headroom of the nodes in the order of their names.
+type CapacityReport struct {
+	Nodes              []NodeHeadroom `json:"nodes"`
+	TotalPodsWithPV    int64          `json:"totalPodsWithPV"`
+	TotalPodsWithoutPV int64          `json:"totalPodsWithoutPV"`
+}
+
+// Capacity reports the headroom of the nodes selected in the cluster made of the objects, without an API server.
+func Capacity(options *config.OptionConfig, objects []runtime.Object, selector labels.Selector, shape PodShape) (*CapacityReport, error) {
+	accessor, err := newMemoryAccessor(objects)
+	if err != nil {
+		return nil, err
+	}
+	handler := &PredicateHandler{cfg: options, accessor: accessor}
+	return handler.capacityReport(selector, shape)
+}
+
+func (h *PredicateHandler) capacityReport(selector labels.Selector, shape PodShape) (*CapacityReport, error) {
+	nodes, err := h.accessor.GetAllNodes()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+
+	snapshot := h.ledgerSnapshot()
+	report := &CapacityReport{Nodes: []NodeHeadroom{}}
+	for _, node := range nodes {
+		if !selector.Matches(labels.Set(node.Labels)) {
+			continue
+		}
+		ledger, err := h.nodeLedger(snapshot, node)
+		if err != nil {
+			return nil, fmt.Errorf("fail to compute reservation of node %s: %w", node.Name, err)
+		}
+
+		headroom := NodeHeadroom{
+			Node:            node.Name,
+			PodsWithoutPV:   podsFitting(ledger.UnreservedCpu, true, ledger.UnreservedMem, true, shape),
+			NodeReservation: ledger.NodeReservation,
+		}
+		// the same as the predicate, a pod mounting a PV is only checked against the reservation left on the PV
+		for _, reservations := range []map[string]*pvReservation{ledger.PVs, ledger.UnboundPVs} {
+			for _, reservation := range reservations {
+				if reservation.Skip {
+					continue
+				}
+				headroom.PodsWithPV += podsFitting(reservation.RemainingCpu, reservation.ConfiguredCpu, reservation.RemainingMem, reservation.ConfiguredMem, shape)
+			}
+		}
+
+		report.Nodes = append(report.Nodes, headroom)
+		report.TotalPodsWithPV += headroom.PodsWithPV
+		report.TotalPodsWithoutPV += headroom.PodsWithoutPV
+	}
+	return report, nil
+}
+
+// podsFitting returns how many pods of the shape fit in the resources limited by the configured ones.
+func podsFitting(cpu resource.Quantity, limitCpu bool, mem resource.Quantity, limitMem bool, shape PodShape) int64 {
+	count := int64(-1)
+	if limitCpu {
+		count = cpu.MilliValue() / shape.Cpu.MilliValue()
+	}
+	if limitMem {
+		if fitting := mem.Value() / shape.Mem.Value(); count < 0 || fitting < count {
+			count = fitting
+		}
+	}
+	if count < 0 {
+		return 0
+	}
+	return count
+}
+
+// WriteCapacityReport writes the report in one of CapacityFormats.
+func WriteCapacityReport(w io.Writer, report *CapacityReport, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"node", "podsWithPV", "podsWithoutPV", "reservedCpu", "reservedMem", "unreservedCpu", "unreservedMem"})
+		for _, node := range report.Nodes {
+			writer.Write([]string{node.Node, strconv.FormatInt(node.PodsWithPV, 10), strconv.FormatInt(node.PodsWithoutPV, 10),
+				node.ReservedCpu.String(), node.ReservedMem.String(), node.UnreservedCpu.String(), node.UnreservedMem.String()})
+		}
+		writer.Flush()
+		return writer.Error()
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "NODE\tPODS-WITH-PV\tPODS-WITHOUT-PV\tRESERVED-CPU\tRESERVED-MEM\tUNRESERVED-CPU\tUNRESERVED-MEM")
+		for _, node := range report.Nodes {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t%s\n", node.Node, node.PodsWithPV, node.PodsWithoutPV,
+				node.ReservedCpu.String(), node.ReservedMem.String(), node.UnreservedCpu.String(), node.UnreservedMem.String())
+		}
+		fmt.Fprintf(tw, "TOTAL\t%d\t%d\t\t\t\t\n", report.TotalPodsWithPV, report.TotalPodsWithoutPV)
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown format %s, should be one of %v", format, CapacityFormats)
+	}
+}
+
+var capacityContentTypes = map[string]string{
+	"table": "text/plain; charset=utf-8",
+	"json":  "application/json",
+	"csv":   "text/csv",
+}
+
+// CapacityHandler serves the capacity report of the nodes with the current options.
+type CapacityHandler struct {
+	*reloadableHandler
+}
+
+func NewCapacityHandler(cfg *config.Config) (pkg.Handler, error) {
+	handler, err := newReloadableHandler(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &CapacityHandler{
+		reloadableHandler: handler,
+	}, nil
+}
+
+func (h *CapacityHandler) RestInfos() []pkg.RestInfo {
+	return []pkg.RestInfo{
+		{
+			"/",
+			[]string{"GET"},
+			h.capacity,
+		},
+	}
+}
+
+// capacity reports the headroom for the pod shape given by the query parameters 'cpu' and 'memory',
+// of the nodes selected by 'selector', in the 'output' format, json by default.
+func (h *CapacityHandler) capacity(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	shape, err := ParsePodShape(query.Get("cpu"), query.Get("memory"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	selector, err := labels.Parse(query.Get("selector"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid selector: %s", err), http.StatusBadRequest)
+		return
+	}
+	format := query.Get("output")
+	if len(format) == 0 {
+		format = "json"
+	}
+	contentType, known := capacityContentTypes[format]
+	if !known {
+		http.Error(w, fmt.Sprintf("unknown output %s, should be one of %v", format, CapacityFormats), http.StatusBadRequest)
+		return
+	}
+
+	handler := h.handler()
+	if !handler.accessor.HasSynced() {
+		http.Error(w, "resource caches are not synced yet", http.StatusServiceUnavailable)
+		return
+	}
+	report, err := handler.capacityReport(selector, shape)
+	if err != nil {
+		glog.Errorf("Fail to report capacity: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if err := WriteCapacityReport(w, report, format); err != nil {
+		glog.Errorf("Fail to write capacity report: %s", err)
+	}
+}
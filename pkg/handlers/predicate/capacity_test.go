@@ -0,0 +1,85 @@
+package predicate
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestCapacityReport(t *testing.T) {
+	accessor := &MockAccessor{}
+	node1 := buildNode(t, "node1", "8", "16Gi")
+	node2 := buildNode(t, "node2", "4", "4Gi")
+	accessor.Nodes = []*v1.Node{node2, node1}
+
+	cpu, mem := "4", "8Gi"
+	pv := buildPV("pv1", &node1.Name, &cpu, &mem)
+	accessor.PVs = []*v1.PersistentVolume{pv}
+	pvc := buildPVC("test", "pvc1")
+	accessor.PVCs = map[string][]*v1.PersistentVolumeClaim{pvc.Namespace: {pvc}}
+	bind(pv, pvc)
+
+	mounting := buildPod(t, "test", "mounting", []string{pvc.Name}, []string{"1"}, []string{"2Gi"})
+	bindNode(mounting, node1.Name)
+	accessor.AddPod(mounting)
+	plain := buildPod(t, "test", "plain", []string{}, []string{"1"}, []string{"1Gi"})
+	bindNode(plain, node1.Name)
+	accessor.AddPod(plain)
+
+	shape, err := ParsePodShape("1", "2Gi")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	handler := &PredicateHandler{cfg: opts, accessor: accessor}
+	report, err := handler.capacityReport(labels.Everything(), shape)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(report.Nodes) != 2 || report.Nodes[0].Node != "node1" || report.Nodes[1].Node != "node2" {
+		t.Fatalf("expecting nodes in order of names, got %v", report.Nodes)
+	}
+	// 3 cpu and 6Gi left in the reservation of pv1, 3 cpu and 7Gi left after the reservation
+	if node := report.Nodes[0]; node.PodsWithPV != 3 || node.PodsWithoutPV != 3 {
+		t.Fatalf("unexpected headroom of node1: %v", node)
+	}
+	assertQuantity(t, "unreserved memory", report.Nodes[0].UnreservedMem, "7Gi")
+	// limited by memory
+	if node := report.Nodes[1]; node.PodsWithPV != 0 || node.PodsWithoutPV != 2 {
+		t.Fatalf("unexpected headroom of node2: %v", node)
+	}
+	if report.TotalPodsWithPV != 3 || report.TotalPodsWithoutPV != 5 {
+		t.Fatalf("unexpected total headroom: %d, %d", report.TotalPodsWithPV, report.TotalPodsWithoutPV)
+	}
+
+	out := &bytes.Buffer{}
+	if err := WriteCapacityReport(out, report, "csv"); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	expected := "node,podsWithPV,podsWithoutPV,reservedCpu,reservedMem,unreservedCpu,unreservedMem\n" +
+		"node1,3,3,3,6Gi,3,7Gi\n" +
+		"node2,0,2,0,0,4,4Gi\n"
+	if out.String() != expected {
+		t.Fatalf("expecting csv %q, got %q", expected, out.String())
+	}
+
+	// served with the current options
+	capacityHandler := &CapacityHandler{reloadableHandler: &reloadableHandler{}}
+	capacityHandler.current.Store(handler)
+	w := httptest.NewRecorder()
+	capacityHandler.capacity(w, httptest.NewRequest("GET", "/capacity?cpu=1&memory=2Gi&selector=nodeName%3Dnode2&output=table", nil))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "node1") || !strings.Contains(w.Body.String(), "node2") {
+		t.Fatalf("expecting the table of node2, got %d: %s", w.Code, w.Body.String())
+	}
+	for _, query := range []string{"cpu=1", "cpu=0&memory=1Gi", "cpu=1&memory=1Gi&output=xml", "cpu=1&memory=1Gi&selector=a%3D%3D%3D"} {
+		w := httptest.NewRecorder()
+		capacityHandler.capacity(w, httptest.NewRequest("GET", "/capacity?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("expecting bad request of %s, got %d", query, w.Code)
+		}
+	}
+}
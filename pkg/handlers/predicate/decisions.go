@@ -0,0 +1,210 @@
+package predicate
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/api/core/v1"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+	"github.com/wu8685/lpv-res-predicate/pkg/metrics"
+)
+
+// decisionCache memoizes the decisions of pods on nodes, so that the scheduler retrying a pending pod
+// against largely the same nodes costs almost nothing.
+//
+// A decision is keyed by the pod UID and resource version and the resource versions of its claims,
+// and is valid until it expires, or until the node, its local PVs or the pods mounting them change.
+// The changes are delivered by the events marking the nodes dirty in the reservation ledger, which bump
+// the generation of the nodes. A decision made against the ledger of a node is also valid only while the
+// ledger snapshot keeps the same ledger of the node, since the ledger is recomputed after the events.
+type decisionCache struct {
+	lock sync.RWMutex
+	// the options the decisions are made with
+	options *config.OptionConfig
+	pods    map[string]*podDecisions
+	// bumped by the changes of each node, and of all the nodes by the epoch
+	generations map[string]uint64
+	epoch       uint64
+	lastSweep   time.Time
+}
+
+type podDecisions struct {
+	expires time.Time
+	nodes   map[string]*cachedDecision
+}
+
+type cachedDecision struct {
+	generation uint64
+	// the ledger of the node the decision is made against, nil if computed on the fly
+	ledger *nodeLedger
+	fit    bool
+	reason string
+}
+
+// decisionLookup is the state of the nodes read before predicating, which the decisions are stored with.
+type decisionLookup struct {
+	key         string
+	generations []uint64
+}
+
+func newDecisionCache() *decisionCache {
+	return &decisionCache{
+		pods:        map[string]*podDecisions{},
+		generations: map[string]uint64{},
+	}
+}
+
+// decisionKey returns false if the pod has no UID, which is not sent by the scheduler.
+// The claims not created yet are also keyed, so that the decisions are not used once they are created.
+func decisionKey(pod *v1.Pod, claims []*v1.PersistentVolumeClaim) (string, bool) {
+	if len(pod.UID) == 0 {
+		return "", false
+	}
+	claimVersions := make(map[string]string, len(claims))
+	for _, claim := range claims {
+		claimVersions[claim.Name] = "@" + claim.ResourceVersion
+	}
+
+	key := strings.Builder{}
+	key.WriteString(string(pod.UID))
+	key.WriteString("/")
+	key.WriteString(pod.ResourceVersion)
+	for _, volume := range getPvcVolumeSources(pod.Spec.Volumes) {
+		claimName := volume.VolumeSource.PersistentVolumeClaim.ClaimName
+		key.WriteString("/")
+		key.WriteString(claimName)
+		key.WriteString(claimVersions[claimName])
+	}
+	return key.String(), true
+}
+
+// invalidate drops the decisions on the nodes.
+func (c *decisionCache) invalidate(nodeNames ...string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, nodeName := range nodeNames {
+		c.generations[nodeName]++
+	}
+}
+
+// reset drops all the decisions once the options are reloaded. The handlers with other options no longer look up decisions.
+func (c *decisionCache) reset(options *config.OptionConfig) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.options = options
+	c.pods = map[string]*podDecisions{}
+	c.epoch++
+}
+
+func (c *decisionCache) generation(nodeName string) uint64 {
+	return c.epoch + c.generations[nodeName]
+}
+
+// lookup fills the results of the nodes with valid decisions, and returns the state to store the others with.
+// It returns nil if the decisions of the pod are not cached.
+func (c *decisionCache) lookup(options *config.OptionConfig, snapshot *filterSnapshot, pod *v1.Pod, nodeNames []string, results []nodeResult) *decisionLookup {
+	if snapshot.claimsErr != nil {
+		return nil
+	}
+	key, cacheable := decisionKey(pod, snapshot.claims)
+	if !cacheable {
+		return nil
+	}
+
+	lookup := &decisionLookup{
+		key:         key,
+		generations: make([]uint64, len(nodeNames)),
+	}
+	hits := 0
+	now := time.Now()
+
+	c.lock.RLock()
+	if c.options != options {
+		c.lock.RUnlock()
+		return nil
+	}
+	decisions, exist := c.pods[key]
+	if exist && now.After(decisions.expires) {
+		exist = false
+	}
+	for i, nodeName := range nodeNames {
+		lookup.generations[i] = c.generation(nodeName)
+		if !exist {
+			continue
+		}
+		decision, cached := decisions.nodes[nodeName]
+		if !cached || decision.generation != lookup.generations[i] || decision.ledger != snapshot.nodeLedger(nodeName) {
+			continue
+		}
+		results[i] = nodeResult{predicated: true, fit: decision.fit, reason: decision.reason}
+		hits++
+	}
+	c.lock.RUnlock()
+
+	metrics.FilterCacheLookups.WithLabelValues("hit").Add(float64(hits))
+	metrics.FilterCacheLookups.WithLabelValues("miss").Add(float64(len(nodeNames) - hits))
+	return lookup
+}
+
+// store caches the decisions of the nodes predicated without internal error.
+func (c *decisionCache) store(lookup *decisionLookup, snapshot *filterSnapshot, nodeNames []string, results []nodeResult, ttl time.Duration) {
+	if lookup == nil {
+		return
+	}
+	now := time.Now()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.sweep(now, ttl)
+	decisions, exist := c.pods[lookup.key]
+	if !exist || now.After(decisions.expires) {
+		decisions = &podDecisions{
+			expires: now.Add(ttl),
+			nodes:   make(map[string]*cachedDecision, len(nodeNames)),
+		}
+		c.pods[lookup.key] = decisions
+	}
+	for i, nodeName := range nodeNames {
+		result := results[i]
+		if !result.predicated || result.err != nil {
+			continue
+		}
+		decisions.nodes[nodeName] = &cachedDecision{
+			generation: lookup.generations[i],
+			ledger:     snapshot.nodeLedger(nodeName),
+			fit:        result.fit,
+			reason:     result.reason,
+		}
+	}
+}
+
+// sweep drops the expired decisions at most once per ttl, such as the ones of the pods scheduled or updated since.
+func (c *decisionCache) sweep(now time.Time, ttl time.Duration) {
+	if now.Sub(c.lastSweep) < ttl {
+		return
+	}
+	c.lastSweep = now
+	for key, decisions := range c.pods {
+		if now.After(decisions.expires) {
+			delete(c.pods, key)
+		}
+	}
+}
+
+// lookupDecisions looks up the decisions if the cache is enabled, see decisionCache.lookup.
+func (h *PredicateHandler) lookupDecisions(snapshot *filterSnapshot, pod *v1.Pod, nodeNames []string, results []nodeResult) *decisionLookup {
+	if h.decisions == nil || h.cfg.FilterCacheTTL <= 0 {
+		return nil
+	}
+	return h.decisions.lookup(h.cfg, snapshot, pod, nodeNames, results)
+}
+
+func (h *PredicateHandler) storeDecisions(lookup *decisionLookup, snapshot *filterSnapshot, nodeNames []string, results []nodeResult) {
+	if lookup == nil {
+		return
+	}
+	h.decisions.store(lookup, snapshot, nodeNames, results, h.cfg.FilterCacheTTL)
+}
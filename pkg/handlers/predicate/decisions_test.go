@@ -0,0 +1,120 @@
+package predicate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestDecisionCache(t *testing.T) {
+	accessor := &MockAccessor{}
+	node1 := buildNode(t, "node1", "8", "10G")
+	node2 := buildNode(t, "node2", "8", "10G")
+	accessor.Nodes = []*v1.Node{node1, node2}
+	cpu := "4"
+	accessor.PVs = []*v1.PersistentVolume{buildPV("pv1", &node1.Name, &cpu, nil)}
+	nodeNames := []string{node1.Name, node2.Name}
+
+	cacheOpts := *opts
+	cacheOpts.FilterCacheTTL = time.Minute
+	ledger := newLedger(accessor, &cacheOpts)
+	ledger.resync()
+	decisions := newDecisionCache()
+	ledger.addListener(decisions.invalidate)
+	decisions.reset(&cacheOpts)
+	handler := &PredicateHandler{cfg: &cacheOpts, accessor: accessor, ledger: ledger, decisions: decisions}
+
+	pod := buildPod(t, "test", "pod1", []string{}, []string{"3"}, []string{"1G"})
+	pod.UID = types.UID("uid1")
+	pod.ResourceVersion = "1"
+	assertPredicated(t, handler, nodeNames, pod, []string{"node1", "node2"})
+	assertCached(t, handler, nodeNames, pod, []string{"node1", "node2"})
+
+	// another version of the pod is not cached
+	updated := pod.DeepCopy()
+	updated.ResourceVersion = "2"
+	assertCached(t, handler, nodeNames, updated, []string{})
+
+	// a pod added on node1 invalidates the decision on it
+	consumer := buildPod(t, "test", "pod2", []string{}, []string{"6"}, []string{"1G"})
+	bindNode(consumer, node1.Name)
+	accessor.AddPod(consumer)
+	ledger.podHandler().OnAdd(consumer)
+	assertCached(t, handler, nodeNames, pod, []string{"node2"})
+
+	// the decision made against the ledger not recomputed yet is not used after it is recomputed
+	assertPredicated(t, handler, nodeNames, pod, []string{"node1", "node2"})
+	assertCached(t, handler, nodeNames, pod, []string{"node1", "node2"})
+	ledger.update()
+	assertCached(t, handler, nodeNames, pod, []string{"node2"})
+	assertPredicated(t, handler, nodeNames, pod, []string{"node2"})
+	assertCached(t, handler, nodeNames, pod, []string{"node1", "node2"})
+
+	// the claim created after the decisions are made invalidates them
+	claimed := buildPod(t, "test", "pod3", []string{"pvc1"}, []string{"3"}, []string{"1G"})
+	claimed.UID = types.UID("uid3")
+	assertPredicated(t, handler, nodeNames, claimed, []string{"node2"})
+	assertCached(t, handler, nodeNames, claimed, []string{"node1", "node2"})
+	accessor.PVCs = map[string][]*v1.PersistentVolumeClaim{"test": {buildPVC("test", "pvc1")}}
+	assertCached(t, handler, nodeNames, claimed, []string{})
+
+	// the decisions are dropped once the options are reloaded
+	reloaded := cacheOpts
+	decisions.reset(&reloaded)
+	assertCached(t, handler, nodeNames, pod, []string{})
+	handler = &PredicateHandler{cfg: &reloaded, accessor: accessor, ledger: ledger, decisions: decisions}
+	assertPredicated(t, handler, nodeNames, pod, []string{"node2"})
+	assertCached(t, handler, nodeNames, pod, []string{"node1", "node2"})
+
+	// the decisions expire
+	reloaded.FilterCacheTTL = time.Millisecond
+	decisions.reset(&reloaded)
+	assertPredicated(t, handler, nodeNames, pod, []string{"node2"})
+	time.Sleep(10 * time.Millisecond)
+	assertCached(t, handler, nodeNames, pod, []string{})
+
+	// a pod without UID is not cached
+	reloaded.FilterCacheTTL = time.Minute
+	anonymous := buildPod(t, "test", "pod4", []string{}, []string{"1"}, []string{"1G"})
+	assertPredicated(t, handler, nodeNames, anonymous, []string{"node1", "node2"})
+	if lookup := handler.lookupDecisions(handler.takeSnapshot(anonymous), anonymous, nodeNames, make([]nodeResult, len(nodeNames))); lookup != nil {
+		t.Fatalf("expecting no decision cached for the pod without UID")
+	}
+}
+
+func assertPredicated(t *testing.T, handler *PredicateHandler, nodeNames []string, pod *v1.Pod, expected []string) {
+	t.Helper()
+	result, _, err := handler.predicate(context.Background(), nodeNames, pod)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	assertNodes(t, "fit", *result.NodeNames, expected)
+}
+
+func assertCached(t *testing.T, handler *PredicateHandler, nodeNames []string, pod *v1.Pod, expected []string) {
+	t.Helper()
+	results := make([]nodeResult, len(nodeNames))
+	handler.lookupDecisions(handler.takeSnapshot(pod), pod, nodeNames, results)
+	cached := []string{}
+	for i, result := range results {
+		if result.predicated {
+			cached = append(cached, nodeNames[i])
+		}
+	}
+	assertNodes(t, "cached", cached, expected)
+}
+
+func assertNodes(t *testing.T, name string, actual, expected []string) {
+	t.Helper()
+	if len(actual) != len(expected) {
+		t.Fatalf("expecting %s nodes %v, got %v", name, expected, actual)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Fatalf("expecting %s nodes %v, got %v", name, expected, actual)
+		}
+	}
+}
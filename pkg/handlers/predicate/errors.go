@@ -0,0 +1,71 @@
+package predicate
+
+import (
+	"errors"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// the kinds of errors returned by resourceAccessor, matched by errors.Is
+var (
+	// the object does not exist in the informer cache or the API server
+	ErrNotFound = errors.New("not found")
+	// the informer cache of the object kind is not synced yet
+	ErrNotSynced = errors.New("cache not synced")
+	// the request to the API server or the informer cache fails
+	ErrAPIFailure = errors.New("API failure")
+	// the object to update is modified since it was read
+	ErrConflict = errors.New("conflict")
+)
+
+// ResourceError is returned by resourceAccessor with the object kind and key, and is one of the kinds of errors.
+type ResourceError struct {
+	// one of ErrNotFound, ErrNotSynced, ErrAPIFailure and ErrConflict
+	Reason error
+	Kind   string
+	// namespace/name of a namespaced object, name of a cluster scoped one, or empty for a list
+	Key string
+	// the underlying error, if any
+	Err error
+}
+
+func (e *ResourceError) Error() string {
+	object := e.Kind
+	if len(e.Key) > 0 {
+		object = fmt.Sprintf("%s %s", e.Kind, e.Key)
+	}
+	if e.Err == nil {
+		return fmt.Sprintf("%s: %s", object, e.Reason)
+	}
+	return fmt.Sprintf("%s: %s: %s", object, e.Reason, e.Err)
+}
+
+// Unwrap returns the underlying error, while the kind is matched by Is,
+// so that errors.Is matches both since Go 1.13.
+func (e *ResourceError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ResourceError) Is(target error) bool {
+	return target == e.Reason
+}
+
+func newNotFoundError(kind, key string) error {
+	return &ResourceError{Reason: ErrNotFound, Kind: kind, Key: key}
+}
+
+func newNotSyncedError(kind, key string) error {
+	return &ResourceError{Reason: ErrNotSynced, Kind: kind, Key: key}
+}
+
+// newResourceError classifies an error from a lister or the client.
+func newResourceError(kind, key string, err error) error {
+	if apierrors.IsNotFound(err) {
+		return &ResourceError{Reason: ErrNotFound, Kind: kind, Key: key}
+	}
+	if apierrors.IsConflict(err) {
+		return &ResourceError{Reason: ErrConflict, Kind: kind, Key: key, Err: err}
+	}
+	return &ResourceError{Reason: ErrAPIFailure, Kind: kind, Key: key, Err: err}
+}
@@ -0,0 +1,75 @@
+package predicate
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang/glog"
+	"k8s.io/kubernetes/pkg/scheduler/api"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/metrics"
+)
+
+// policies answering a node failing to be predicated because of an internal error,
+// such as a missing node or PVC in the informer caches
+const (
+	// fails the whole filter call, so that the pod can not be scheduled in this round
+	FilterFailurePolicyFailRequest = "fail-request"
+	// answers the node as failed with the error as the reason
+	FilterFailurePolicyFailNode = "fail-node"
+	// answers the node as fit
+	FilterFailurePolicyPassNode = "pass-node"
+)
+
+// the reasons of the node errors counted by the metrics, by the kind of the ResourceError
+var nodeErrorReasons = map[error]string{
+	ErrNotFound:   "not-found",
+	ErrNotSynced:  "not-synced",
+	ErrAPIFailure: "api-failure",
+	ErrConflict:   "conflict",
+}
+
+// FilterResult is the ExtenderFilterResult with the internal errors of the nodes answered by the failure policy.
+// kube-scheduler ignores NodeErrors, which is for troubleshooting.
+type FilterResult struct {
+	*api.ExtenderFilterResult
+
+	NodeErrors map[string]string `json:",omitempty"`
+}
+
+func (h *PredicateHandler) failurePolicy() string {
+	if len(h.cfg.FilterFailurePolicy) == 0 {
+		return FilterFailurePolicyFailRequest
+	}
+	return h.cfg.FilterFailurePolicy
+}
+
+// nodeErrorResult answers a node with the failure policy, or returns the error failing the whole filter call.
+// A cache not synced yet fails the node under every policy, since passing it may admit the pod onto reserved resources,
+// and the scheduler retries the pod once the cache is synced.
+func (h *PredicateHandler) nodeErrorResult(err error) (bool, string, error) {
+	reason, kind := "internal", ""
+	resourceErr := &ResourceError{}
+	if errors.As(err, &resourceErr) {
+		reason, kind = nodeErrorReasons[resourceErr.Reason], resourceErr.Kind
+	}
+
+	if errors.Is(err, ErrNotSynced) {
+		metrics.FilterNodeErrors.WithLabelValues(FilterFailurePolicyFailNode, reason, kind).Inc()
+		glog.Warningf("%s, answer the node as failed to retry", err)
+		return false, fmt.Sprintf("cache of %s is not synced yet, retry later", kind), nil
+	}
+
+	policy := h.failurePolicy()
+	metrics.FilterNodeErrors.WithLabelValues(policy, reason, kind).Inc()
+	switch policy {
+	case FilterFailurePolicyFailNode:
+		glog.Errorf("%s, answer the node as failed", err)
+		return false, err.Error(), nil
+	case FilterFailurePolicyPassNode:
+		glog.Errorf("%s, answer the node as fit", err)
+		return true, err.Error(), nil
+	default:
+		return false, "", err
+	}
+}
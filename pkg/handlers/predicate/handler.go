@@ -1,8 +1,11 @@
 package predicate
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/glog"
@@ -13,14 +16,10 @@ import (
 	"github.com/wu8685/lpv-res-predicate/pkg"
 	"github.com/wu8685/lpv-res-predicate/pkg/config"
 	"github.com/wu8685/lpv-res-predicate/pkg/handlers"
+	"github.com/wu8685/lpv-res-predicate/pkg/metrics"
 )
 
 var (
-	EmptyFilterResult = &api.ExtenderFilterResult{
-		NodeNames:   &[]string{},
-		FailedNodes: map[string]string{},
-	}
-
 	EmptyPods = []*v1.Pod{}
 )
 
@@ -31,27 +30,117 @@ func init() {
 type PredicateHandler struct {
 	cfg      *config.OptionConfig
 	accessor resourceAccessor
+	// nil to compute the reservation of each node on the fly
+	ledger *reservationLedger
+	// nil to predicate each node on every filter call
+	decisions *decisionCache
 }
 
 func NewPredicateHandler(cfg *config.Config) (pkg.Handler, error) {
-	handler := &PredicateHandler{
-		cfg:      cfg.Options,
-		accessor: NewResourceAccessor(cfg),
+	handler, err := newReloadableHandler(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Options.FilterRecordFile) > 0 {
+		recorder, err := newFilterRecorder(cfg.Options.FilterRecordFile, cfg.Options.FilterRecordMaxBytes, cfg.Options.FilterRecordMaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		handler.recorder = recorder
+	}
+	return handler, nil
+}
+
+// reloadableHandler serves with the PredicateHandler built with the current options.
+// The PredicateHandler is replaced as a whole once the options are reloaded,
+// so that each request sees consistent options.
+type reloadableHandler struct {
+	accessor resourceAccessor
+	ledger    *reservationLedger
+	decisions *decisionCache
+	current   atomic.Value
+
+	// limits the in-flight filter calls, nil if not limited
+	inFlight chan struct{}
+	// records the filter calls, nil if not recorded
+	recorder *filterRecorder
+}
+
+func newReloadableHandler(cfg *config.Config) (*reloadableHandler, error) {
+	accessor, err := sharedResourceAccessor(cfg)
+	if err != nil {
+		return nil, err
 	}
+	ledger, err := sharedReservationLedger(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	handler := &reloadableHandler{
+		accessor: accessor,
+		ledger:    ledger,
+		decisions: newDecisionCache(),
+	}
+	// the events marking the nodes dirty in the ledger invalidate the decisions on them
+	handler.ledger.addListener(handler.decisions.invalidate)
+	if cfg.Options.FilterMaxInFlight > 0 {
+		handler.inFlight = make(chan struct{}, cfg.Options.FilterMaxInFlight)
+	}
+	handler.Reload(cfg.Options)
 	return handler, nil
 }
 
-func (h *PredicateHandler) RestInfos() []pkg.RestInfo {
+func (h *reloadableHandler) Reload(options *config.OptionConfig) {
+	h.ledger.Reload(options)
+	h.current.Store(&PredicateHandler{
+		cfg:       options,
+		accessor:  h.accessor,
+		ledger:    h.ledger,
+		decisions: h.decisions,
+	})
+	h.decisions.reset(options)
+}
+
+// Run maintains the reservation ledger, and writes the filter records if recorded.
+func (h *reloadableHandler) Run(stopCh <-chan struct{}) {
+	if h.recorder != nil {
+		go h.recorder.Run(stopCh)
+	}
+	h.ledger.Run(stopCh)
+}
+
+func (h *reloadableHandler) handler() *PredicateHandler {
+	return h.current.Load().(*PredicateHandler)
+}
+
+func (h *reloadableHandler) RestInfos() []pkg.RestInfo {
 	return []pkg.RestInfo{
 		{
 			"/lpvReservedResource",
 			[]string{"POST"},
-			h.handle,
+			func(w http.ResponseWriter, r *http.Request) {
+				h.handler().handle(w, r, h.inFlight, h.recorder)
+			},
 		},
 	}
 }
 
-func (h *PredicateHandler) handle(w http.ResponseWriter, r *http.Request) {
+func (h *reloadableHandler) NodeReservation(node *v1.Node) (*NodeReservation, error) {
+	return h.handler().NodeReservation(node)
+}
+
+func (h *PredicateHandler) handle(w http.ResponseWriter, r *http.Request, inFlight chan struct{}, recorder *filterRecorder) {
+	startTime := time.Now()
+	defer func() {
+		metrics.FilterDuration.Observe(time.Now().Sub(startTime).Seconds())
+	}()
+
+	if !h.accessor.HasSynced() {
+		glog.Errorf("Fail to predicate before resource caches are synced")
+		h.responseErr(w, fmt.Errorf("resource caches are not synced yet"))
+		return
+	}
+
 	body := &api.ExtenderArgs{}
 	if err := handlers.ReadRequestBody(r, body); err != nil {
 		glog.Errorf("Fail to read request body: %s", err)
@@ -59,13 +148,17 @@ func (h *PredicateHandler) handle(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ctx, cancel := h.filterContext(r.Context())
+	defer cancel()
+
 	nodeNames, nodeMap, hasNode := getNodeNames(body)
-	result, err := h.predicate(nodeNames, body.Pod)
+	result, snapshot, err := h.predicateInFlight(ctx, inFlight, nodeNames, body.Pod)
 	if err != nil {
 		glog.Errorf("Fail to predicate pod %s on nodes %v: %s", body.Pod.Name, nodeNames, err)
 		h.responseErr(w, err)
+		recorder.record(h, body, nodeNames, &api.ExtenderFilterResult{Error: err.Error()}, snapshot)
 	} else {
-		glog.V(1).Infof("Predicate pod %s on nodes %v, fit nodes: %v", body.Pod.Name, nodeNames, result.NodeNames)
+		glog.V(1).Infof("Predicate pod %s on nodes %v, fit nodes: %v", body.Pod.Name, nodeNames, *result.NodeNames)
 		if hasNode {
 			nodeList := body.Nodes
 			nodeList.Items = make([]v1.Node, len(*result.NodeNames))
@@ -74,11 +167,33 @@ func (h *PredicateHandler) handle(w http.ResponseWriter, r *http.Request) {
 			}
 			result.Nodes = nodeList
 		}
+		metrics.FilterCalls.WithLabelValues("success").Inc()
 		handlers.WriteResponse(w, 200, result)
+		recorder.record(h, body, nodeNames, result.ExtenderFilterResult, snapshot)
 	}
 }
 
-func (h *PredicateHandler) predicate(NodeNames []string, pod *v1.Pod) (*api.ExtenderFilterResult, error) {
+// predicateInFlight waits for a slot of the in-flight filter calls until the deadline.
+func (h *PredicateHandler) predicateInFlight(ctx context.Context, inFlight chan struct{}, nodeNames []string, pod *v1.Pod) (*FilterResult, *filterSnapshot, error) {
+	if inFlight == nil {
+		return h.predicate(ctx, nodeNames, pod)
+	}
+
+	select {
+	case inFlight <- struct{}{}:
+		defer func() { <-inFlight }()
+		return h.predicate(ctx, nodeNames, pod)
+	case <-ctx.Done():
+		result, err := h.timeoutResult(pod.Name, []string{}, map[string]string{}, nodeNames, fmt.Errorf("too many in-flight filter calls: %s", ctx.Err()))
+		if err != nil {
+			return nil, nil, err
+		}
+		return &FilterResult{ExtenderFilterResult: result}, nil, nil
+	}
+}
+
+// predicate returns the snapshot the nodes are predicated against as well, nil if there is no node.
+func (h *PredicateHandler) predicate(ctx context.Context, NodeNames []string, pod *v1.Pod) (*FilterResult, *filterSnapshot, error) {
 	glog.V(0).Infof("Start predicating pod %s", pod.Name)
 
 	if glog.V(1) {
@@ -88,182 +203,236 @@ func (h *PredicateHandler) predicate(NodeNames []string, pod *v1.Pod) (*api.Exte
 		}()
 	}
 
+	fitNodeNames := []string{}
+	failedNodesMap := map[string]string{}
+	nodeErrors := map[string]string{}
 	if len(NodeNames) == 0 {
-		return EmptyFilterResult, nil
+		return &FilterResult{
+			ExtenderFilterResult: &api.ExtenderFilterResult{
+				NodeNames:   &fitNodeNames,
+				FailedNodes: failedNodesMap,
+			},
+		}, nil, nil
 	}
 
-	fitNodeNames := []string{}
-	failedNodesMap := map[string]string{}
-	for _, nodeName := range NodeNames {
-		node, err := h.accessor.GetNode(nodeName)
-		if err != nil {
-			return nil, fmt.Errorf("fail to get node %s from informer: %s", nodeName, err)
+	// all the nodes are predicated against the same snapshot, each writing only its own result
+	snapshot := h.takeSnapshot(pod)
+	results := make([]nodeResult, len(NodeNames))
+	// only the nodes without a valid decision cached are predicated
+	lookup := h.lookupDecisions(snapshot, pod, NodeNames, results)
+	misses := make([]int, 0, len(NodeNames))
+	for i := range results {
+		if !results[i].predicated {
+			misses = append(misses, i)
+		}
+	}
+	missNodeNames := make([]string, len(misses))
+	for piece, i := range misses {
+		missNodeNames[piece] = NodeNames[i]
+	}
+	h.snapshotNodes(ctx, snapshot, missNodeNames)
+	// snapshot.nodes is only read from here on
+	parallelize(h.cfg.FilterParallelism, len(misses), func(piece int) {
+		// give up the remaining nodes once the scheduler gives up waiting
+		if ctx.Err() != nil {
+			return
+		}
+		i := misses[piece]
+		defer recoverNodeResult(&results[i])
+		results[i] = h.predicateNodeInSnapshot(snapshot, NodeNames[i], pod)
+	})
+	h.storeDecisions(lookup, snapshot, NodeNames, results)
+
+	// the results are merged in the order of the nodes, so that they do not depend on the parallelism
+	remaining := []string{}
+	for i, nodeName := range NodeNames {
+		result := results[i]
+		if !result.predicated {
+			remaining = append(remaining, nodeName)
+			continue
 		}
 
-		if fit, reason, err := h.predicateOneNode(node, pod); err != nil {
-			return nil, fmt.Errorf("fail to predicate pod %s on node %s: %s", pod.Name, nodeName, err)
-		} else if fit {
+		fit, reason := result.fit, result.reason
+		if result.err != nil {
+			var err error
+			if fit, reason, err = h.nodeErrorResult(result.err); err != nil {
+				return nil, snapshot, err
+			}
+			nodeErrors[nodeName] = reason
+		}
+
+		if fit {
 			fitNodeNames = append(fitNodeNames, nodeName)
 		} else {
 			failedNodesMap[nodeName] = reason
 		}
 	}
 
-	return &api.ExtenderFilterResult{
-		NodeNames:   &fitNodeNames,
-		FailedNodes: failedNodesMap,
-	}, nil
+	if len(remaining) > 0 {
+		result, err := h.timeoutResult(pod.Name, fitNodeNames, failedNodesMap, remaining, ctx.Err())
+		if err != nil {
+			return nil, snapshot, err
+		}
+		return &FilterResult{ExtenderFilterResult: result, NodeErrors: nodeErrors}, snapshot, nil
+	}
+
+	return &FilterResult{
+		ExtenderFilterResult: &api.ExtenderFilterResult{
+			NodeNames:   &fitNodeNames,
+			FailedNodes: failedNodesMap,
+		},
+		NodeErrors: nodeErrors,
+	}, snapshot, nil
 }
 
-func (h *PredicateHandler) predicateOneNode(node *v1.Node, pod *v1.Pod) (bool, string, error) {
-	pvs, unboundPvs, err := h.getReservedResourceLocalPVOnNode(node)
+func (h *PredicateHandler) predicateNodeInSnapshot(snapshot *filterSnapshot, nodeName string, pod *v1.Pod) nodeResult {
+	node, err := h.snapshotNode(snapshot, nodeName)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		// the node is deleted after the scheduler snapshots it, which is not an internal error
+		glog.V(1).Infof("Node %s to predicate pod %s is not found", nodeName, pod.Name)
+		return nodeResult{predicated: true, reason: "node is not found"}
+	case err != nil:
+		// ErrNotSynced fails the node to retry, and the others are answered by the failure policy
+		return nodeResult{predicated: true, err: fmt.Errorf("fail to get node %s from informer: %w", nodeName, err)}
+	}
+
+	fit, reason, err := h.predicateOneNodeInSnapshot(snapshot, node, pod)
 	if err != nil {
-		return false, "", err
+		return nodeResult{predicated: true, err: fmt.Errorf("fail to predicate pod %s on node %s: %w", pod.Name, nodeName, err)}
 	}
+	return nodeResult{predicated: true, fit: fit, reason: reason}
+}
 
-	podPVs, err := h.localPersistentVolumeOnPodOnNode(pod, pvs, unboundPvs)
+// predicateOneNode predicates the pod on the node against a snapshot taken now.
+func (h *PredicateHandler) predicateOneNode(node *v1.Node, pod *v1.Pod) (bool, string, error) {
+	return h.predicateOneNodeInSnapshot(h.takeSnapshot(pod), node, pod)
+}
+
+func (h *PredicateHandler) predicateOneNodeInSnapshot(snapshot *filterSnapshot, node *v1.Node, pod *v1.Pod) (bool, string, error) {
+	ledger, err := h.snapshotNodeLedger(snapshot, node)
 	if err != nil {
 		return false, "", err
 	}
 
+	if snapshot.claimsErr != nil {
+		return false, "", snapshot.claimsErr
+	}
+	podPVs := h.localPersistentVolumeOnPodOnNode(pod, snapshot.claims, pvsOfReservations(ledger.PVs), pvsOfReservations(ledger.UnboundPVs))
+
 	// if the pod uses local PVs with reserved resource, predicate with the reserved resource on each local PV
 	// or predicate with the node remained resources after reserving resources for all of the local PVs
 	if len(podPVs) > 0 {
 		for _, pv := range podPVs {
-			remainedPVCpu, configedCpu, remainedPVMem, configedMem, canSkip, err := h.remainReservedResources(pv, node.Name)
-			if canSkip {
+			reservation := ledger.reservation(pv.Name)
+			if reservation == nil || reservation.Skip {
 				continue
 			}
 
-			if err != nil {
-				return false, "", err
-			}
-
-			if configedCpu {
-				if _, enough := subPodCpuRequest(remainedPVCpu, pod); !enough {
+			if reservation.ConfiguredCpu {
+				if _, enough := subPodCpuRequest(reservation.RemainingCpu.DeepCopy(), pod); !enough {
 					return false, fmt.Sprintf("reserved cpu of local persistent volume %s is not enough", pv.Name), nil
 				}
 			}
 
-			if configedMem {
-				if _, enough := subPodMemRequest(remainedPVMem, pod); !enough {
+			if reservation.ConfiguredMem {
+				if _, enough := subPodMemRequest(reservation.RemainingMem.DeepCopy(), pod); !enough {
 					return false, fmt.Sprintf("reserved memory of local persistent volume %s is not enough", pv.Name), nil
 				}
 			}
 		}
 	} else {
 		// consider all kinds of node resources
-		availableNodeCpu, availableNodeMem, err := h.availableResource(node)
-		if err != nil {
-			return false, "", err
-		}
-
-		if h.cfg.ConsiderUnboundLocalPV {
-			for name, unboundPv := range unboundPvs {
-				pvs[name] = unboundPv
-			}
-		}
-
-		for _, pv := range pvs {
-			remainedPVCpu, configedCpu, remainedPVMem, configedMem, canSkip, err := h.remainReservedResources(pv, node.Name)
-			if canSkip {
-				continue
-			}
-
-			if err != nil {
-				return false, "", err
-			}
-
-			if configedCpu {
-				availableNodeCpu.Sub(remainedPVCpu)
-			}
-			if configedMem {
-				availableNodeMem.Sub(remainedPVMem)
-			}
-		}
-
-		if _, cpuEnough := subPodCpuRequest(*availableNodeCpu, pod); !cpuEnough {
+		if _, cpuEnough := subPodCpuRequest(ledger.UnreservedCpu.DeepCopy(), pod); !cpuEnough {
 			return false, "cpu not enough after reserving for local persistent volume", nil
 		}
-		if _, memEnough := subPodMemRequest(*availableNodeMem, pod); !memEnough {
+		if _, memEnough := subPodMemRequest(ledger.UnreservedMem.DeepCopy(), pod); !memEnough {
 			return false, "memory not enough after reserving for local persistent volume", nil
 		}
 	}
 	return true, "", nil
 }
 
-func (h *PredicateHandler) getReservedResourceLocalPVOnNode(node *v1.Node) (map[string]*v1.PersistentVolume, map[string]*v1.PersistentVolume, error) {
-	pvs, err := h.accessor.GetAllPersistentVolume()
-	if err != nil {
-		return nil, nil, err
-	}
-
+func (h *PredicateHandler) getReservedResourceLocalPVOnNode(pvs []*v1.PersistentVolume) (map[string]*v1.PersistentVolume, map[string]*v1.PersistentVolume) {
 	pvsOnNode := map[string]*v1.PersistentVolume{}
 	unboundPvsOnNode := map[string]*v1.PersistentVolume{}
 	for _, pv := range pvs {
 		// skip PVs with no reserved resources or PVs running out of reserved resources
-		consider, bound := considerReserveResource(pv, h.cfg.ReservedCpuAnnoKey, h.cfg.ReservedMemAnnoKey)
+		consider, bound := considerReserveResource(pv, h.cfg)
 		if !consider {
 			continue
 		}
 
-		if pv.Spec.NodeAffinity == nil || pv.Spec.NodeAffinity.Required == nil || pv.Spec.NodeAffinity.Required.NodeSelectorTerms == nil {
-			glog.V(0).Infof("Local persistent volume has reserved resource, but has malformed NodeAffinity")
-			continue
-		}
-		if nodeMatchesNodeSelectorTerms(node, pv.Spec.NodeAffinity.Required.NodeSelectorTerms) {
-			if bound {
-				pvsOnNode[pv.Name] = pv
-			} else {
-				unboundPvsOnNode[pv.Name] = pv
-			}
+		if bound {
+			pvsOnNode[pv.Name] = pv
+		} else {
+			unboundPvsOnNode[pv.Name] = pv
 		}
 	}
-	return pvsOnNode, unboundPvsOnNode, nil
+	return pvsOnNode, unboundPvsOnNode
 }
 
 func (h *PredicateHandler) getPodsOnPVOnNode(pvName string, node string) ([]*v1.Pod, error) {
 	pv, err := h.accessor.GetPersistentVolume(pvName)
-	if err != nil {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		// the pv is deleted, so that no pod is using it
 		return EmptyPods, nil
+	case err != nil:
+		// ErrNotSynced or ErrAPIFailure, the pods using the pv are unknown instead of none, which would free its reservation
+		return EmptyPods, err
 	}
 
 	// no pvc binding to this pv
-	if pv.Status.Phase != v1.VolumeBound {
+	if pv.Status.Phase != v1.VolumeBound || pv.Spec.ClaimRef == nil {
 		return EmptyPods, nil
 	}
 
 	claimRef := pv.Spec.ClaimRef
-	nsPods, err := h.accessor.GetPodsInNamespace(claimRef.Namespace)
+	mountPods, err := h.accessor.GetPodsUsingClaim(claimRef.Namespace, claimRef.Name)
 	if err != nil {
 		return EmptyPods, err
 	}
 
 	podsOnNode := []*v1.Pod{}
-	for _, pod := range nsPods {
+	for _, pod := range mountPods {
 		if pod.Spec.NodeName == node {
 			podsOnNode = append(podsOnNode, pod)
 		}
 	}
-	return getMountPods(podsOnNode, claimRef.Name)
+	return podsOnNode, nil
 }
 
-func (h *PredicateHandler) localPersistentVolumeOnPodOnNode(pod *v1.Pod,
-					localPVOnNode map[string]*v1.PersistentVolume,
-					unboundLocalPVOnNode map[string]*v1.PersistentVolume) (map[string]*v1.PersistentVolume, error) {
+// podClaims returns the PVCs of the pod volumes, skipping the ones not created yet.
+func (h *PredicateHandler) podClaims(pod *v1.Pod) ([]*v1.PersistentVolumeClaim, error) {
 	volumes := getPvcVolumeSources(pod.Spec.Volumes)
+	claims := make([]*v1.PersistentVolumeClaim, 0, len(volumes))
+	for _, v := range volumes {
+		pvc, err := h.accessor.GetPersistentVolumeClaim(pod.Namespace, v.VolumeSource.PersistentVolumeClaim.ClaimName)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			// the pod is not schedulable until the pvc is created, which is checked by the scheduler itself
+			glog.V(1).Infof("Skip volume %s of pod %s/%s: %s", v.Name, pod.Namespace, pod.Name, err)
+			continue
+		case err != nil:
+			// ErrNotSynced or ErrAPIFailure, the local PVs the pod uses are unknown, which fails every node by the error
+			return nil, err
+		}
+		claims = append(claims, pvc)
+	}
+	return claims, nil
+}
+
+func (h *PredicateHandler) localPersistentVolumeOnPodOnNode(pod *v1.Pod, claims []*v1.PersistentVolumeClaim,
+					localPVOnNode map[string]*v1.PersistentVolume,
+					unboundLocalPVOnNode map[string]*v1.PersistentVolume) map[string]*v1.PersistentVolume {
 	pvs := map[string]*v1.PersistentVolume{}
 	unboundPVs := []*v1.PersistentVolume{}
 	for _, unboundPV := range unboundLocalPVOnNode {
 		unboundPVs = append(unboundPVs, unboundPV)
 	}
 
-	for _, v := range volumes {
-		pvc, err := h.accessor.GetPersistentVolumeClaim(pod.Namespace, v.VolumeSource.PersistentVolumeClaim.ClaimName)
-		if err != nil {
-			return nil, err
-		}
-
+	for _, pvc := range claims {
 		// no need to check fully binding by annotation pv.kubernetes.io/bind-completed here
 		if len(pvc.Spec.VolumeName) > 0 {
 			// bound pvc
@@ -274,7 +443,7 @@ func (h *PredicateHandler) localPersistentVolumeOnPodOnNode(pod *v1.Pod,
 			// unbound pvc
 			unboundPVs, err := findMatchingVolume(pvc, unboundPVs,nil, nil,false)
 			if err != nil {
-				glog.Errorf("Fail to find unbound local pv for volume %s of pod %s", v.Name, pod.Name)
+				glog.Errorf("Fail to find unbound local pv for claim %s of pod %s", pvc.Name, pod.Name)
 				continue
 			}
 			for _, unboundPV := range unboundPVs {
@@ -282,38 +451,29 @@ func (h *PredicateHandler) localPersistentVolumeOnPodOnNode(pod *v1.Pod,
 			}
 		}
 	}
-	return pvs, nil
+	return pvs
 }
 
-// returns the available resource on the node
-func (h *PredicateHandler) availableResource(node *v1.Node) (*resource.Quantity, *resource.Quantity, error) {
-	pods, err := h.accessor.GetAllPods()
-	if err != nil {
-		return nil, nil, fmt.Errorf("fail to get pod when calculate availabel resource of node %s: %s", node.Name, err)
-	}
-
+// returns the available resource on the node with the pods on it
+func availableResource(node *v1.Node, pods []*v1.Pod) (*resource.Quantity, *resource.Quantity) {
 	cpuResource := node.Status.Allocatable.Cpu().DeepCopy()
 	memResource := node.Status.Allocatable.Memory().DeepCopy()
 	for _, pod := range pods {
-		if pod.Spec.NodeName != node.Name {
-			continue
-		}
-
 		cpuResource, _ = subPodCpuRequest(cpuResource, pod)
 		memResource, _ = subPodMemRequest(memResource, pod)
 	}
-	return &cpuResource, &memResource, nil
+	return &cpuResource, &memResource
 }
 
 func (h *PredicateHandler) getReservedResource(pv *v1.PersistentVolume) (resource.Quantity, bool, resource.Quantity, bool, error) {
-	reservedCpu, hasCpu, err := getResevedResource(pv, h.cfg.ReservedCpuAnnoKey)
+	reservedCpu, hasCpu, err := getResevedResource(pv, h.cfg.ReservedCpuAnnoKey, h.cfg.ReservedCpuAnnoKeyAliases)
 	if err != nil {
 		// malformat cpu value
 		glog.V(0).Infof("Malformat reserved cpu annotation value %v: %s", pv.Annotations, err)
 		return reservedCpu, false, ZeroQuantity, false, err
 	}
 
-	reservedMem, hasMem, err := getResevedResource(pv, h.cfg.ReservedMemAnnoKey)
+	reservedMem, hasMem, err := getResevedResource(pv, h.cfg.ReservedMemAnnoKey, h.cfg.ReservedMemAnnoKeyAliases)
 	if err != nil {
 		// malformat memory value
 		glog.V(0).Infof("Malformat reserved memory annotation value %v: %s", pv.Annotations, err)
@@ -361,5 +521,6 @@ func (h *PredicateHandler) remainReservedResources(pv *v1.PersistentVolume, node
 func (h *PredicateHandler) responseErr(w http.ResponseWriter, err error) {
 	result := &api.ExtenderFilterResult{}
 	result.Error = err.Error()
+	metrics.FilterCalls.WithLabelValues("error").Inc()
 	handlers.WriteResponse(w, 200, result)
 }
@@ -0,0 +1,78 @@
+package predicate
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+)
+
+// handlerSync tracks whether an event handler has processed the objects listed by its informer on start.
+// The informer is synced once the objects are in its store, while they are delivered to the handlers asynchronously,
+// so the handler is synced only once it has processed every object in the store at the time the informer is synced.
+type handlerSync struct {
+	lock sync.Mutex
+
+	informerSynced cache.InformerSynced
+	store          cache.Store
+
+	// the keys processed before the informer is synced
+	processed sets.String
+	// the keys in the store when the informer is synced, not processed yet, nil before the informer is synced
+	pending sets.String
+}
+
+func newHandlerSync(informer cache.SharedIndexInformer) *handlerSync {
+	return &handlerSync{
+		informerSynced: informer.HasSynced,
+		store:          informer.GetStore(),
+		processed:      sets.NewString(),
+	}
+}
+
+// wrap returns the handler marking each object processed after the handler returns.
+func (s *handlerSync) wrap(handler cache.ResourceEventHandler) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			handler.OnAdd(obj)
+			s.process(obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			handler.OnUpdate(oldObj, newObj)
+			s.process(newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			handler.OnDelete(obj)
+			s.process(obj)
+		},
+	}
+}
+
+func (s *handlerSync) process(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.pending == nil {
+		s.processed.Insert(key)
+	} else {
+		s.pending.Delete(key)
+	}
+}
+
+func (s *handlerSync) HasSynced() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.pending == nil {
+		if !s.informerSynced() {
+			return false
+		}
+		s.pending = sets.NewString(s.store.ListKeys()...).Difference(s.processed)
+		s.processed = nil
+	}
+	return s.pending.Len() == 0
+}
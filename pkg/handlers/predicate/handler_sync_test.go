@@ -0,0 +1,64 @@
+package predicate
+
+import (
+	"errors"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestHandlerSync(t *testing.T) {
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	informerSynced := false
+	pvSync := &handlerSync{
+		informerSynced: func() bool { return informerSynced },
+		store:          store,
+		processed:      sets.NewString(),
+	}
+	accessor := &ResourceAccessor{
+		localPVs:        newLocalPVIndex(),
+		pvIndexSynced:   pvSync.HasSynced,
+		nodeIndexSynced: alwaysSynced,
+	}
+	handler := pvSync.wrap(accessor.localPVs.pvHandler())
+
+	node1 := buildNode(t, "node1", "8", "10G")
+	accessor.localPVs.updateNode(node1)
+	cpu := "1"
+	pv1 := buildPV("pv1", &node1.Name, &cpu, nil)
+	pv2 := buildPV("pv2", &node1.Name, &cpu, nil)
+	pv3 := buildPV("pv3", &node1.Name, &cpu, nil)
+	store.Add(pv1)
+	store.Add(pv2)
+	if _, err := accessor.GetLocalPersistentVolumesOnNode("node1"); !errors.Is(err, ErrNotSynced) {
+		t.Fatalf("expecting not synced before the informer is synced, got %v", err)
+	}
+
+	// the informer is synced with pv1 and pv2 listed, while the handler has only processed pv1
+	handler.OnAdd(pv1)
+	informerSynced = true
+	if _, err := accessor.GetLocalPersistentVolumesOnNode("node1"); !errors.Is(err, ErrNotSynced) {
+		t.Fatalf("expecting not synced before the handler processes pv2, got %v", err)
+	}
+
+	// the objects added after the informer is synced are not waited for
+	store.Add(pv3)
+	handler.OnAdd(pv2)
+	pvs, err := accessor.GetLocalPersistentVolumesOnNode("node1")
+	if err != nil || len(pvs) != 2 {
+		t.Fatalf("expecting pv1 and pv2 once the handler processes the listed objects, got %v, %v", pvs, err)
+	}
+
+	// a listed object deleted before processed is processed by its deletion
+	store = cache.NewStore(cache.MetaNamespaceKeyFunc)
+	store.Add(pv1)
+	pvSync = &handlerSync{informerSynced: alwaysSynced, store: store, processed: sets.NewString()}
+	if pvSync.HasSynced() {
+		t.Fatal("expecting not synced before the handler processes pv1")
+	}
+	pvSync.wrap(accessor.localPVs.pvHandler()).OnDelete(cache.DeletedFinalStateUnknown{Key: "pv1", Obj: pv1})
+	if !pvSync.HasSynced() {
+		t.Fatal("expecting synced once the handler processes the deletion of pv1")
+	}
+}
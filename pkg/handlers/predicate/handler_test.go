@@ -1,12 +1,20 @@
 package predicate
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
 	"testing"
 
+	dto "github.com/prometheus/client_model/go"
 	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 
 	"github.com/wu8685/lpv-res-predicate/pkg/config"
+	"github.com/wu8685/lpv-res-predicate/pkg/metrics"
 )
 
 const (
@@ -49,7 +57,7 @@ func TestPredicateWithMultiNodes(t *testing.T) {
 	accessor.PVCs[pvc.Namespace] = []*v1.PersistentVolumeClaim{ pvc }
 	bind(pv, pvc)
 
-	handler := &PredicateHandler{opts, accessor}
+	handler := &PredicateHandler{cfg: opts, accessor: accessor}
 
 	pod1 := buildPod(t, "test", "pod1", []string{pvc.Name}, []string{"2"}, []string{"2G"})
 	assert(t).Unfit(handler.predicateOneNode(node1, pod1))
@@ -106,7 +114,7 @@ func TestPredicateWithMultiPodsOnDifferentNodes(t *testing.T) {
 	accessor.PVCs[pvc.Namespace] = []*v1.PersistentVolumeClaim{ pvc }
 	bind(pv, pvc)
 
-	handler := &PredicateHandler{opts, accessor}
+	handler := &PredicateHandler{cfg: opts, accessor: accessor}
 
 	pod1 := buildPod(t, "test", "pod1", []string{pvc.Name}, []string{"2"}, []string{"1G"})
 	assert(t).Fit(handler.predicateOneNode(node1, pod1))
@@ -153,7 +161,7 @@ func TestPredicateWithUnboundPV(t *testing.T) {
 	accessor.PVCs[pvc.Namespace] = []*v1.PersistentVolumeClaim{ pvc }
 
 	opts.ConsiderUnboundLocalPV = true
-	handler := &PredicateHandler{opts, accessor}
+	handler := &PredicateHandler{cfg: opts, accessor: accessor}
 
 	pod1 := buildPod(t, "test", "pod1", []string{pvc.Name}, []string{"2"}, []string{"3G"})
 	assert(t).Unfit(handler.predicateOneNode(node1, pod1))
@@ -208,7 +216,406 @@ func TestPredicateWithUnboundPV(t *testing.T) {
 	assert(t).Unfit(handler.predicateOneNode(node1, pod5))
 }
 
-func buildNode(t *testing.T, name string, cpu, mem string) *v1.Node {
+func TestNodeReservation(t *testing.T) {
+	accessor := &MockAccessor{}
+
+	// node
+	node1 := buildNode(t, "node1", "8", "10G")
+	accessor.Nodes = []*v1.Node {
+		node1,
+	}
+
+	// pv
+	cpu := "4"
+	mem := "4G"
+	pv := buildPV("pv1", &node1.Name, &cpu, &mem)
+	accessor.PVs = []*v1.PersistentVolume {
+		pv,
+	}
+
+	// pvc
+	pvc := buildPVC("test", "pvc1")
+	accessor.PVCs = map[string][]*v1.PersistentVolumeClaim {}
+	accessor.PVCs[pvc.Namespace] = []*v1.PersistentVolumeClaim{ pvc }
+	bind(pv, pvc)
+
+	handler := &PredicateHandler{cfg: opts, accessor: accessor}
+
+	// pod1 takes part of the reservation, pod2 takes the node resources
+	pod1 := buildPod(t, "test", "pod1", []string{pvc.Name}, []string{"1"}, []string{"1G"})
+	bindNode(pod1, node1.Name)
+	accessor.AddPod(pod1)
+	pod2 := buildPod(t, "test", "pod2", []string{}, []string{"2"}, []string{"2G"})
+	bindNode(pod2, node1.Name)
+	accessor.AddPod(pod2)
+
+	reservation, err := handler.NodeReservation(node1)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	assertQuantity(t, "reserved cpu", reservation.ReservedCpu, "3")
+	assertQuantity(t, "reserved memory", reservation.ReservedMem, "3G")
+	assertQuantity(t, "unreserved cpu", reservation.UnreservedCpu, "2")
+	assertQuantity(t, "unreserved memory", reservation.UnreservedMem, "4G")
+}
+
+func TestPredicateTimeout(t *testing.T) {
+	accessor := &MockAccessor{}
+	accessor.Nodes = []*v1.Node{
+		buildNode(t, "node1", "8", "10G"),
+		buildNode(t, "node2", "8", "10G"),
+	}
+	pod := buildPod(t, "test", "pod1", []string{}, []string{"1"}, []string{"1G"})
+	nodeNames := []string{"node1", "node2"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	timeoutOpts := *opts
+	handler := &PredicateHandler{cfg: &timeoutOpts, accessor: accessor}
+
+	timeoutOpts.FilterTimeoutPolicy = FilterTimeoutPolicyError
+	if _, _, err := handler.predicate(ctx, nodeNames, pod); err == nil {
+		t.Fatal("expecting error after the deadline")
+	}
+
+	timeoutOpts.FilterTimeoutPolicy = FilterTimeoutPolicyPassAll
+	result, _, err := handler.predicate(ctx, nodeNames, pod)
+	if err != nil || len(*result.NodeNames) != 2 {
+		t.Fatalf("expecting all nodes passed, got %v, %v", result, err)
+	}
+
+	timeoutOpts.FilterTimeoutPolicy = FilterTimeoutPolicyFailAll
+	result, _, err = handler.predicate(ctx, nodeNames, pod)
+	if err != nil || len(*result.NodeNames) != 0 || len(result.FailedNodes) != 2 {
+		t.Fatalf("expecting all nodes failed, got %v, %v", result, err)
+	}
+
+	// waiting for a slot of the in-flight filter calls also honors the deadline
+	inFlight := make(chan struct{}, 1)
+	inFlight <- struct{}{}
+	result, _, err = handler.predicateInFlight(ctx, inFlight, nodeNames, pod)
+	if err != nil || len(result.FailedNodes) != 2 {
+		t.Fatalf("expecting all nodes failed without a slot, got %v, %v", result, err)
+	}
+
+	<-inFlight
+	result, _, err = handler.predicateInFlight(context.Background(), inFlight, nodeNames, pod)
+	if err != nil || len(*result.NodeNames) != 2 || len(inFlight) != 0 {
+		t.Fatalf("expecting all nodes fit with the slot released, got %v, %v", result, err)
+	}
+}
+
+// failingAccessor fails to get the nodes in Failing.
+type failingAccessor struct {
+	*MockAccessor
+	Failing map[string]error
+}
+
+func (a *failingAccessor) GetNode(name string) (*v1.Node, error) {
+	if err, exist := a.Failing[name]; exist {
+		return nil, err
+	}
+	return a.MockAccessor.GetNode(name)
+}
+
+func TestPredicateFailurePolicy(t *testing.T) {
+	accessor := &failingAccessor{
+		MockAccessor: &MockAccessor{},
+		Failing: map[string]error{
+			"node2": newResourceError("node", "node2", fmt.Errorf("connection refused")),
+		},
+	}
+	accessor.Nodes = []*v1.Node{
+		buildNode(t, "node1", "8", "10G"),
+		buildNode(t, "node2", "8", "10G"),
+	}
+	pod := buildPod(t, "test", "pod1", []string{}, []string{"1"}, []string{"1G"})
+	nodeNames := []string{"node1", "node2"}
+
+	failureOpts := *opts
+	handler := &PredicateHandler{cfg: &failureOpts, accessor: accessor}
+
+	if _, _, err := handler.predicate(context.Background(), nodeNames, pod); err == nil {
+		t.Fatal("expecting error failing the request by default")
+	}
+
+	failureOpts.FilterFailurePolicy = FilterFailurePolicyFailNode
+	result, _, err := handler.predicate(context.Background(), nodeNames, pod)
+	if err != nil || len(*result.NodeNames) != 1 || len(result.FailedNodes) != 1 || len(result.NodeErrors) != 1 {
+		t.Fatalf("expecting node2 failed, got %v, %v", result, err)
+	}
+
+	failureOpts.FilterFailurePolicy = FilterFailurePolicyPassNode
+	result, _, err = handler.predicate(context.Background(), nodeNames, pod)
+	if err != nil || len(*result.NodeNames) != 2 || len(result.FailedNodes) != 0 || len(result.NodeErrors) != 1 {
+		t.Fatalf("expecting node2 passed, got %v, %v", result, err)
+	}
+
+	// the errors are responded beside the fields of ExtenderFilterResult
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	response := map[string]interface{}{}
+	json.Unmarshal(data, &response)
+	if _, exist := response["NodeErrors"]; !exist {
+		t.Fatalf("expecting NodeErrors in response %s", data)
+	}
+	if _, exist := response["NodeNames"]; !exist {
+		t.Fatalf("expecting NodeNames in response %s", data)
+	}
+}
+
+func TestPredicateNotSynced(t *testing.T) {
+	accessor := &failingAccessor{
+		MockAccessor: &MockAccessor{},
+		Failing: map[string]error{
+			"node2": newNotSyncedError("node", "node2"),
+		},
+	}
+	accessor.Nodes = []*v1.Node{
+		buildNode(t, "node1", "8", "10G"),
+		buildNode(t, "node2", "8", "10G"),
+	}
+	pod := buildPod(t, "test", "pod1", []string{}, []string{"1"}, []string{"1G"})
+	nodeNames := []string{"node1", "node2"}
+
+	nodeErrors := func(policy, reason, kind string) float64 {
+		metric := &dto.Metric{}
+		metrics.FilterNodeErrors.WithLabelValues(policy, reason, kind).Write(metric)
+		return metric.GetCounter().GetValue()
+	}
+	before := nodeErrors(FilterFailurePolicyFailNode, "not-synced", "node")
+
+	// a cache not synced fails the node to retry under every policy, instead of failing the request or passing the node
+	failureOpts := *opts
+	handler := &PredicateHandler{cfg: &failureOpts, accessor: accessor}
+	for _, policy := range []string{FilterFailurePolicyFailRequest, FilterFailurePolicyFailNode, FilterFailurePolicyPassNode} {
+		failureOpts.FilterFailurePolicy = policy
+		result, _, err := handler.predicate(context.Background(), nodeNames, pod)
+		if err != nil {
+			t.Fatalf("unexpected err with policy %s: %s", policy, err)
+		}
+		if len(*result.NodeNames) != 1 || result.FailedNodes["node2"] != "cache of node is not synced yet, retry later" || len(result.NodeErrors) != 1 {
+			t.Fatalf("expecting node2 failed to retry with policy %s, got %v", policy, result)
+		}
+	}
+	if counted := nodeErrors(FilterFailurePolicyFailNode, "not-synced", "node") - before; counted != 3 {
+		t.Fatalf("expecting 3 not synced node errors counted, got %v", counted)
+	}
+
+	// the other errors are counted by their reason and kind
+	before = nodeErrors(FilterFailurePolicyPassNode, "api-failure", "node")
+	accessor.Failing["node2"] = newResourceError("node", "node2", fmt.Errorf("connection refused"))
+	if _, _, err := handler.predicate(context.Background(), nodeNames, pod); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if counted := nodeErrors(FilterFailurePolicyPassNode, "api-failure", "node") - before; counted != 1 {
+		t.Fatalf("expecting 1 API failure counted, got %v", counted)
+	}
+}
+
+func TestPredicateMissingObjects(t *testing.T) {
+	accessor := &MockAccessor{}
+	accessor.Nodes = []*v1.Node{
+		buildNode(t, "node1", "8", "10G"),
+	}
+	// the pvc is not created yet
+	pod := buildPod(t, "test", "pod1", []string{"pvc1"}, []string{"1"}, []string{"1G"})
+	handler := &PredicateHandler{cfg: opts, accessor: accessor}
+
+	// node2 is deleted, which is failed without applying the failure policy
+	result, _, err := handler.predicate(context.Background(), []string{"node1", "node2"}, pod)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(*result.NodeNames) != 1 || len(result.FailedNodes) != 1 || len(result.NodeErrors) != 0 {
+		t.Fatalf("expecting node1 fit and node2 failed, got %v", result)
+	}
+
+	// a deleted pv is mounted by no pod
+	pods, err := handler.getPodsOnPVOnNode("pv1", "node1")
+	if err != nil || len(pods) != 0 {
+		t.Fatalf("expecting no pod on a deleted pv, got %v, %v", pods, err)
+	}
+}
+
+func TestPredicateParallel(t *testing.T) {
+	accessor := &failingAccessor{
+		MockAccessor: &MockAccessor{},
+		Failing:      map[string]error{},
+	}
+	nodeNames := []string{}
+	for i := 0; i < 50; i++ {
+		node := buildNode(t, fmt.Sprintf("node%d", i), "8", "10G")
+		nodeNames = append(nodeNames, node.Name)
+		switch i % 5 {
+		case 1:
+			// not found
+			continue
+		case 2:
+			// missed by the ledger and failing to get
+			accessor.Failing[node.Name] = newResourceError("node", node.Name, fmt.Errorf("connection refused"))
+			continue
+		case 3:
+			cpu := "6"
+			accessor.PVs = append(accessor.PVs, buildPV(fmt.Sprintf("pv%d", i), &node.Name, &cpu, nil))
+		}
+		accessor.Nodes = append(accessor.Nodes, node)
+	}
+	pod := buildPod(t, "test", "pod1", []string{}, []string{"4"}, []string{"1G"})
+
+	parallelOpts := *opts
+	parallelOpts.FilterFailurePolicy = FilterFailurePolicyFailNode
+	ledger := newLedger(accessor, &parallelOpts)
+	ledger.resync()
+
+	// the ledger is updated meanwhile, without changing the state
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go func() {
+		for {
+			select {
+			case <-stopCh:
+				return
+			default:
+				ledger.markDirty(nodeNames[0], nodeNames[3])
+				ledger.update()
+			}
+		}
+	}()
+
+	var expected *FilterResult
+	for _, parallelism := range []int{1, 4, 64} {
+		parallelOpts.FilterParallelism = parallelism
+		handler := &PredicateHandler{cfg: &parallelOpts, accessor: accessor, ledger: ledger}
+		result, _, err := handler.predicate(context.Background(), nodeNames, pod)
+		if err != nil {
+			t.Fatalf("unexpected err: %s", err)
+		}
+		if len(*result.NodeNames) != 20 || len(result.FailedNodes) != 30 || len(result.NodeErrors) != 10 {
+			t.Fatalf("unexpected result with parallelism %d: %v", parallelism, result)
+		}
+		if expected == nil {
+			expected = result
+		} else if !reflect.DeepEqual(expected, result) {
+			t.Fatalf("expecting the same result regardless of parallelism, got %v and %v", expected, result)
+		}
+	}
+
+	// the results of no node are not shared
+	handler := &PredicateHandler{cfg: &parallelOpts, accessor: accessor}
+	result, _, _ := handler.predicate(context.Background(), nil, pod)
+	*result.NodeNames = append(*result.NodeNames, "node0")
+	result.FailedNodes["node1"] = "modified"
+	if result, _, _ = handler.predicate(context.Background(), nil, pod); len(*result.NodeNames) != 0 || len(result.FailedNodes) != 0 {
+		t.Fatalf("expecting empty result, got %v", result)
+	}
+}
+
+func TestSnapshotNodes(t *testing.T) {
+	node := buildNode(t, "node1", "8", "10G")
+	cpu := "6"
+	accessor := &MockAccessor{
+		Nodes: []*v1.Node{node},
+		PVs:   []*v1.PersistentVolume{buildPV("pv1", &node.Name, &cpu, nil)},
+	}
+	pod := buildPod(t, "test", "pod1", []string{}, []string{"4"}, []string{"1G"})
+	// without the ledger, the nodes are computed when the snapshot is taken
+	handler := &PredicateHandler{cfg: opts, accessor: accessor}
+	snapshot := handler.takeSnapshot(pod)
+	handler.snapshotNodes(context.Background(), snapshot, []string{node.Name, "node2"})
+
+	// the changes after the snapshot is taken are not seen
+	accessor.PVs = nil
+	accessor.Nodes = append(accessor.Nodes, buildNode(t, "node2", "8", "10G"))
+	if result := handler.predicateNodeInSnapshot(snapshot, node.Name, pod); result.fit || result.err != nil {
+		t.Fatalf("expecting node1 unfit in the snapshot, got %+v", result)
+	}
+	if result := handler.predicateNodeInSnapshot(snapshot, "node2", pod); result.reason != "node is not found" {
+		t.Fatalf("expecting node2 not found in the snapshot, got %+v", result)
+	}
+	assert(t).Fit(handler.predicateOneNode(node, pod))
+
+	// the computed nodes are published as a new map, leaving the one read by the predicate phase untouched
+	nodes := snapshot.nodes
+	handler.snapshotNodes(context.Background(), snapshot, []string{node.Name, "node2", "node3"})
+	if len(nodes) != 2 {
+		t.Fatalf("expecting the published nodes untouched, got %v", nodes)
+	}
+	if len(snapshot.nodes) != 3 || snapshot.nodes["node2"] != nodes["node2"] {
+		t.Fatalf("expecting node3 computed and the others kept, got %v", snapshot.nodes)
+	}
+
+	// the nodes are computed in parallel
+	parallelOpts := *opts
+	parallelOpts.FilterParallelism = 4
+	handler = &PredicateHandler{cfg: &parallelOpts, accessor: accessor}
+	snapshot = handler.takeSnapshot(pod)
+	handler.snapshotNodes(context.Background(), snapshot, []string{node.Name, "node2", "node3", node.Name})
+	if len(snapshot.nodes) != 3 || snapshot.nodes["node2"].nodeErr != nil || snapshot.nodes["node3"].nodeErr == nil {
+		t.Fatalf("expecting 3 nodes computed, got %v", snapshot.nodes)
+	}
+
+	// nothing is computed once the call is given up
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	snapshot = handler.takeSnapshot(pod)
+	handler.snapshotNodes(ctx, snapshot, []string{node.Name})
+	if len(snapshot.nodes) != 0 {
+		t.Fatalf("expecting no node computed, got %v", snapshot.nodes)
+	}
+}
+
+func TestParallelize(t *testing.T) {
+	for _, workers := range []int{0, 1, 3, 100} {
+		done := make([]int, 10)
+		parallelize(workers, len(done), func(i int) {
+			done[i]++
+		})
+		for i := range done {
+			if done[i] != 1 {
+				t.Fatalf("expecting each piece done once with %d workers, got %v", workers, done)
+			}
+		}
+	}
+}
+
+func TestResourceError(t *testing.T) {
+	notFound := newResourceError("node", "node1", apierrors.NewNotFound(v1.Resource("nodes"), "node1"))
+	if !errors.Is(notFound, ErrNotFound) || errors.Is(notFound, ErrAPIFailure) {
+		t.Fatalf("expecting not found error, got %s", notFound)
+	}
+	conflict := newResourceError("persistent volume", "pv1", apierrors.NewConflict(v1.Resource("persistentvolumes"), "pv1", fmt.Errorf("modified")))
+	if !errors.Is(conflict, ErrConflict) || errors.Is(conflict, ErrAPIFailure) {
+		t.Fatalf("expecting conflict error, got %s", conflict)
+	}
+
+	cause := fmt.Errorf("connection refused")
+	failure := fmt.Errorf("fail to predicate: %w", newResourceError("persistent volume claim", "ns/pvc1", cause))
+	if !errors.Is(failure, ErrAPIFailure) || !errors.Is(failure, cause) {
+		t.Fatalf("expecting API failure wrapping the cause, got %s", failure)
+	}
+
+	resourceErr := &ResourceError{}
+	if !errors.As(failure, &resourceErr) || resourceErr.Kind != "persistent volume claim" || resourceErr.Key != "ns/pvc1" {
+		t.Fatalf("expecting the kind and key of the object, got %#v", resourceErr)
+	}
+
+	if notSynced := newNotSyncedError("pod", ""); !errors.Is(notSynced, ErrNotSynced) || notSynced.Error() != "pod: cache not synced" {
+		t.Fatalf("unexpected not synced error %s", notSynced)
+	}
+}
+
+func assertQuantity(t *testing.T, name string, actual resource.Quantity, expected string) {
+	if actual.Cmp(resource.MustParse(expected)) != 0 {
+		t.Fatalf("expected %s %s, got %s", name, expected, actual.String())
+	}
+}
+
+func buildNode(t testing.TB, name string, cpu, mem string) *v1.Node {
 	node := &v1.Node{}
 	node.Name = name
 
@@ -298,7 +705,7 @@ func bind(pv *v1.PersistentVolume, pvc *v1.PersistentVolumeClaim) {
 	pvc.Status.Phase = v1.ClaimBound
 }
 
-func buildPod(t *testing.T, namespace, name string, pvcs []string, cpu, mem []string) *v1.Pod {
+func buildPod(t testing.TB, namespace, name string, pvcs []string, cpu, mem []string) *v1.Pod {
 	if len(cpu) != len(mem) {
 		t.Fatal()
 	}
@@ -368,13 +775,29 @@ func (a *MockAccessor) GetPodsInNamespace(namespace string) ([]*v1.Pod, error) {
 	return a.Pods[namespace], nil
 }
 
+func (a *MockAccessor) GetPodsOnNode(nodeName string) ([]*v1.Pod, error) {
+	pods := []*v1.Pod{}
+	for _, podsInNS := range a.Pods {
+		for _, pod := range podsInNS {
+			if pod.Spec.NodeName == nodeName {
+				pods = append(pods, pod)
+			}
+		}
+	}
+	return pods, nil
+}
+
+func (a *MockAccessor) GetPodsUsingClaim(namespace, claimName string) ([]*v1.Pod, error) {
+	return getMountPods(a.Pods[namespace], claimName)
+}
+
 func (a *MockAccessor) GetPersistentVolume(name string) (*v1.PersistentVolume, error) {
 	for _, pv := range a.PVs {
 		if pv.Name == name {
 			return pv, nil
 		}
 	}
-	return nil, nil
+	return nil, newNotFoundError("persistent volume", name)
 }
 
 func (a *MockAccessor) GetAllPersistentVolume() ([]*v1.PersistentVolume, error) {
@@ -385,18 +808,24 @@ func (a *MockAccessor) GetAllPersistentVolume() ([]*v1.PersistentVolume, error)
 	return pvs, nil
 }
 
-func (a *MockAccessor) GetPersistentVolumeClaim(namespace, name string) (*v1.PersistentVolumeClaim, error) {
-	pvcInNS, exist := a.PVCs[namespace]
-	if !exist {
-		return nil, nil
+func (a *MockAccessor) GetLocalPersistentVolumesOnNode(nodeName string) ([]*v1.PersistentVolume, error) {
+	index := newLocalPVIndex()
+	for _, node := range a.Nodes {
+		index.updateNode(node)
+	}
+	for _, pv := range a.PVs {
+		index.updatePV(pv)
 	}
+	return index.PVsOnNode(nodeName), nil
+}
 
-	for _, pvc := range pvcInNS {
+func (a *MockAccessor) GetPersistentVolumeClaim(namespace, name string) (*v1.PersistentVolumeClaim, error) {
+	for _, pvc := range a.PVCs[namespace] {
 		if pvc.Name == name {
 			return pvc, nil
 		}
 	}
-	return nil, nil
+	return nil, newNotFoundError("persistent volume claim", namespace+"/"+name)
 }
 
 func (a *MockAccessor) GetNode(name string) (*v1.Node, error) {
@@ -405,13 +834,21 @@ func (a *MockAccessor) GetNode(name string) (*v1.Node, error) {
 			return node, nil
 		}
 	}
-	return nil, nil
+	return nil, newNotFoundError("node", name)
+}
+
+func (a *MockAccessor) GetAllNodes() ([]*v1.Node, error) {
+	return a.Nodes, nil
 }
 
 func (a *MockAccessor) UpdatePersistentVolume(volume *v1.PersistentVolume) (*v1.PersistentVolume, error) {
 	return volume, nil
 }
 
+func (a *MockAccessor) HasSynced() bool {
+	return true
+}
+
 func (a *MockAccessor) AddPod(pod *v1.Pod) {
 	if a.Pods == nil {
 		a.Pods = map[string][]*v1.Pod{}
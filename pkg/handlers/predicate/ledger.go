@@ -0,0 +1,555 @@
+package predicate
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+	"github.com/wu8685/lpv-res-predicate/pkg/metrics"
+)
+
+// pvReservation is the reservation of a local PV on a node.
+type pvReservation struct {
+	PV    *v1.PersistentVolume
+	Bound bool
+
+	ConfiguredCpu bool
+	ConfiguredMem bool
+	// requests of the pods mounting the PV on the node
+	ConsumedCpu resource.Quantity
+	ConsumedMem resource.Quantity
+	// the reservation left for the pods mounting the PV, shared by the readers of the snapshot and never mutated
+	RemainingCpu resource.Quantity
+	RemainingMem resource.Quantity
+
+	// the PV is not considered, because its reservation is malformed or runs out
+	Skip bool
+}
+
+// nodeLedger is the reservation of the local PVs on a node, computed with the same logic as the predicate.
+type nodeLedger struct {
+	Node *v1.Node
+
+	// the reserved local PVs bound on the node
+	PVs map[string]*pvReservation
+	// the unbound ones, only if --consider-unbound-local-pv is set
+	UnboundPVs map[string]*pvReservation
+
+	NodeReservation
+
+	// the local PVs and the pods on the node the ledger is computed from, read by the filter recorder
+	LocalPVs []*v1.PersistentVolume
+	Pods     []*v1.Pod
+}
+
+// reservation returns nil if the PV is not a reserved local PV on the node.
+func (l *nodeLedger) reservation(pvName string) *pvReservation {
+	if reservation, exist := l.PVs[pvName]; exist {
+		return reservation
+	}
+	return l.UnboundPVs[pvName]
+}
+
+func (l *nodeLedger) equal(other *nodeLedger) bool {
+	if l.ReservedCpu.Cmp(other.ReservedCpu) != 0 || l.ReservedMem.Cmp(other.ReservedMem) != 0 ||
+		l.UnreservedCpu.Cmp(other.UnreservedCpu) != 0 || l.UnreservedMem.Cmp(other.UnreservedMem) != 0 {
+		return false
+	}
+	return pvReservationsEqual(l.PVs, other.PVs) && pvReservationsEqual(l.UnboundPVs, other.UnboundPVs)
+}
+
+func pvReservationsEqual(a, b map[string]*pvReservation) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, ra := range a {
+		rb, exist := b[name]
+		if !exist {
+			return false
+		}
+		if ra.Skip != rb.Skip || ra.Bound != rb.Bound || ra.ConfiguredCpu != rb.ConfiguredCpu || ra.ConfiguredMem != rb.ConfiguredMem ||
+			ra.RemainingCpu.Cmp(rb.RemainingCpu) != 0 || ra.RemainingMem.Cmp(rb.RemainingMem) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func pvsOfReservations(reservations map[string]*pvReservation) map[string]*v1.PersistentVolume {
+	pvs := make(map[string]*v1.PersistentVolume, len(reservations))
+	for name, reservation := range reservations {
+		pvs[name] = reservation.PV
+	}
+	return pvs
+}
+
+// computeNodeLedger computes the reservation of each reserved local PV on the node and the node remainder.
+func (h *PredicateHandler) computeNodeLedger(node *v1.Node) (*nodeLedger, error) {
+	localPVs, err := h.accessor.GetLocalPersistentVolumesOnNode(node.Name)
+	if err != nil {
+		return nil, err
+	}
+	pods, err := h.accessor.GetPodsOnNode(node.Name)
+	if err != nil {
+		return nil, fmt.Errorf("fail to get pod when calculate availabel resource of node %s: %w", node.Name, err)
+	}
+	pvs, unboundPvs := h.getReservedResourceLocalPVOnNode(localPVs)
+
+	ledger := &nodeLedger{
+		Node:       node,
+		PVs:        make(map[string]*pvReservation, len(pvs)),
+		UnboundPVs: map[string]*pvReservation{},
+		LocalPVs:   localPVs,
+		Pods:       pods,
+	}
+	for name, pv := range pvs {
+		if ledger.PVs[name], err = h.pvReservation(pv, node.Name, true); err != nil {
+			return nil, err
+		}
+	}
+	if h.cfg.ConsiderUnboundLocalPV {
+		for name, pv := range unboundPvs {
+			if ledger.UnboundPVs[name], err = h.pvReservation(pv, node.Name, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	availableNodeCpu, availableNodeMem := availableResource(node, pods)
+
+	// resources still reserved by the local PVs are not available for pods without these PVs
+	reservedCpu := ZeroQuantity.DeepCopy()
+	reservedMem := ZeroQuantity.DeepCopy()
+	for _, reservations := range []map[string]*pvReservation{ledger.PVs, ledger.UnboundPVs} {
+		for _, reservation := range reservations {
+			if reservation.Skip {
+				continue
+			}
+			if reservation.ConfiguredCpu {
+				reservedCpu.Add(reservation.RemainingCpu)
+			}
+			if reservation.ConfiguredMem {
+				reservedMem.Add(reservation.RemainingMem)
+			}
+		}
+	}
+	availableNodeCpu.Sub(reservedCpu)
+	availableNodeMem.Sub(reservedMem)
+
+	ledger.NodeReservation = NodeReservation{
+		ReservedCpu:   reservedCpu,
+		ReservedMem:   reservedMem,
+		UnreservedCpu: *availableNodeCpu,
+		UnreservedMem: *availableNodeMem,
+	}
+	return ledger, nil
+}
+
+func (h *PredicateHandler) pvReservation(pv *v1.PersistentVolume, nodeName string, bound bool) (*pvReservation, error) {
+	remainedCpu, configedCpu, remainedMem, configedMem, canSkip, err := h.remainReservedResources(pv, nodeName)
+	if canSkip && err != nil {
+		// malformed reserved resource value
+		return &pvReservation{PV: pv, Bound: bound, Skip: true}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	reservation := &pvReservation{
+		PV:            pv,
+		Bound:         bound,
+		ConfiguredCpu: configedCpu,
+		ConfiguredMem: configedMem,
+		RemainingCpu:  remainedCpu,
+		RemainingMem:  remainedMem,
+		Skip:          canSkip,
+	}
+	reservedCpu, _, reservedMem, _, _ := h.getReservedResource(pv)
+	reservation.ConsumedCpu = reservedCpu.DeepCopy()
+	reservation.ConsumedCpu.Sub(remainedCpu)
+	reservation.ConsumedMem = reservedMem.DeepCopy()
+	reservation.ConsumedMem.Sub(remainedMem)
+	return reservation, nil
+}
+
+// ledgerSnapshot returns the latest snapshot of the ledger, or nil if it is not built yet or computed with other options.
+func (h *PredicateHandler) ledgerSnapshot() *ledgerSnapshot {
+	if h.ledger == nil {
+		return nil
+	}
+	if snapshot := h.ledger.Snapshot(); snapshot != nil && snapshot.matches(h.cfg) {
+		return snapshot
+	}
+	return nil
+}
+
+// nodeLedger returns the ledger of the node from the snapshot, or computes it if the snapshot misses it.
+func (h *PredicateHandler) nodeLedger(snapshot *ledgerSnapshot, node *v1.Node) (*nodeLedger, error) {
+	if snapshot != nil {
+		if ledger, exist := snapshot.nodes[node.Name]; exist {
+			return ledger, nil
+		}
+	}
+	return h.computeNodeLedger(node)
+}
+
+// ledgerSnapshot is immutable once published.
+type ledgerSnapshot struct {
+	// the options the ledgers are computed with
+	options *config.OptionConfig
+	nodes   map[string]*nodeLedger
+	// the nodes of each reserved local PV in the ledgers
+	pvNodes map[string]sets.String
+}
+
+func newLedgerSnapshot(options *config.OptionConfig, nodes map[string]*nodeLedger) *ledgerSnapshot {
+	snapshot := &ledgerSnapshot{
+		options: options,
+		nodes:   nodes,
+		pvNodes: map[string]sets.String{},
+	}
+	for nodeName, ledger := range nodes {
+		for _, reservations := range []map[string]*pvReservation{ledger.PVs, ledger.UnboundPVs} {
+			for pvName := range reservations {
+				if _, exist := snapshot.pvNodes[pvName]; !exist {
+					snapshot.pvNodes[pvName] = sets.NewString()
+				}
+				snapshot.pvNodes[pvName].Insert(nodeName)
+			}
+		}
+	}
+	return snapshot
+}
+
+// matches returns whether the snapshot is computed with the same options affecting the reservation.
+func (s *ledgerSnapshot) matches(options *config.OptionConfig) bool {
+	return s.options.ReservedCpuAnnoKey == options.ReservedCpuAnnoKey &&
+		s.options.ReservedMemAnnoKey == options.ReservedMemAnnoKey &&
+		reflect.DeepEqual(s.options.ReservedCpuAnnoKeyAliases, options.ReservedCpuAnnoKeyAliases) &&
+		reflect.DeepEqual(s.options.ReservedMemAnnoKeyAliases, options.ReservedMemAnnoKeyAliases) &&
+		s.options.ConsiderUnboundLocalPV == options.ConsiderUnboundLocalPV
+}
+
+// reservationLedger maintains the nodeLedger of each node incrementally from the informer events.
+// The events mark the affected nodes dirty, which are recomputed in batch and published as a new snapshot,
+// so that filter calls read a consistent snapshot instead of recomputing the reservation of every PV.
+// A full recompute runs periodically to detect and correct the drift.
+type reservationLedger struct {
+	accessor     resourceAccessor
+	resyncPeriod time.Duration
+
+	lock    sync.Mutex
+	options *config.OptionConfig
+	dirty   sets.String
+	// a full recompute is required, such as after the options are reloaded
+	dirtyAll bool
+	signal   chan struct{}
+	// called with the nodes marked dirty
+	listeners []func(nodeNames ...string)
+
+	// *ledgerSnapshot, nil until the first full recompute
+	snapshot atomic.Value
+	runOnce  sync.Once
+}
+
+var (
+	sharedLedgersLock sync.Mutex
+	sharedLedgers     = map[*config.Config]*reservationLedger{}
+)
+
+// sharedReservationLedger returns the ledger shared by the handlers and controllers of the same config.
+func sharedReservationLedger(cfg *config.Config) (*reservationLedger, error) {
+	sharedLedgersLock.Lock()
+	defer sharedLedgersLock.Unlock()
+
+	if ledger, exist := sharedLedgers[cfg]; exist {
+		return ledger, nil
+	}
+	accessor, err := sharedResourceAccessor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ledger := newReservationLedger(cfg, accessor)
+	sharedLedgers[cfg] = ledger
+	return ledger, nil
+}
+
+func newReservationLedger(cfg *config.Config, accessor *ResourceAccessor) *reservationLedger {
+	ledger := newLedger(accessor, cfg.Options)
+	ledger.resyncPeriod = cfg.Options.LedgerResyncPeriod
+
+	cfg.InformerFactory.Core().V1().Pods().Informer().AddEventHandler(ledger.podHandler())
+	cfg.InformerFactory.Core().V1().PersistentVolumeClaims().Informer().AddEventHandler(ledger.pvcHandler())
+	cfg.InformerFactory.Core().V1().Nodes().Informer().AddEventHandler(ledger.nodeHandler())
+	// PV events are delivered by the index, since the nodes matched by a PV are known only after it is updated
+	accessor.localPVs.addListener(ledger.markDirty)
+	return ledger
+}
+
+func newLedger(accessor resourceAccessor, options *config.OptionConfig) *reservationLedger {
+	return &reservationLedger{
+		accessor: accessor,
+		options:  options,
+		dirty:    sets.NewString(),
+		signal:   make(chan struct{}, 1),
+	}
+}
+
+// Snapshot returns nil before the first full recompute.
+func (l *reservationLedger) Snapshot() *ledgerSnapshot {
+	snapshot, _ := l.snapshot.Load().(*ledgerSnapshot)
+	return snapshot
+}
+
+// Reload recomputes all the nodes if the options affecting the reservation are changed.
+func (l *reservationLedger) Reload(options *config.OptionConfig) {
+	l.lock.Lock()
+	changed := !(&ledgerSnapshot{options: l.options}).matches(options)
+	l.options = options
+	if changed {
+		l.dirtyAll = true
+	}
+	l.lock.Unlock()
+
+	if changed {
+		l.notify()
+	}
+}
+
+// Run builds the ledger and keeps it updated until stopped. It runs only once, even if called by multiple handlers.
+func (l *reservationLedger) Run(stopCh <-chan struct{}) {
+	l.runOnce.Do(func() {
+		l.run(stopCh)
+	})
+}
+
+func (l *reservationLedger) run(stopCh <-chan struct{}) {
+	l.resync()
+
+	var resyncCh <-chan time.Time
+	if l.resyncPeriod > 0 {
+		ticker := time.NewTicker(l.resyncPeriod)
+		defer ticker.Stop()
+		resyncCh = ticker.C
+	}
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-l.signal:
+			l.update()
+		case <-resyncCh:
+			l.resync()
+		}
+	}
+}
+
+// addListener registers a function called with the nodes marked dirty by the events, before they are recomputed.
+// It is not safe to call after the informers are started.
+func (l *reservationLedger) addListener(listener func(nodeNames ...string)) {
+	l.listeners = append(l.listeners, listener)
+}
+
+func (l *reservationLedger) notify() {
+	select {
+	case l.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (l *reservationLedger) markDirty(nodeNames ...string) {
+	l.lock.Lock()
+	l.dirty.Insert(nodeNames...)
+	l.lock.Unlock()
+	for _, listener := range l.listeners {
+		listener(nodeNames...)
+	}
+	l.notify()
+}
+
+// update recomputes the dirty nodes and publishes a new snapshot.
+func (l *reservationLedger) update() {
+	l.lock.Lock()
+	dirty, dirtyAll, options := l.dirty, l.dirtyAll, l.options
+	l.dirty = sets.NewString()
+	l.dirtyAll = false
+	l.lock.Unlock()
+
+	current := l.Snapshot()
+	if dirtyAll || current == nil || !current.matches(options) {
+		l.resync()
+		return
+	}
+	if dirty.Len() == 0 {
+		return
+	}
+
+	calculator := &PredicateHandler{cfg: options, accessor: l.accessor}
+	nodes := make(map[string]*nodeLedger, len(current.nodes))
+	for nodeName, ledger := range current.nodes {
+		nodes[nodeName] = ledger
+	}
+	for nodeName := range dirty {
+		ledger, err := l.compute(calculator, nodeName)
+		if err != nil {
+			// filter calls compute the node on the fly until it is recomputed
+			delete(nodes, nodeName)
+			continue
+		}
+		nodes[nodeName] = ledger
+	}
+
+	l.snapshot.Store(newLedgerSnapshot(options, nodes))
+	glog.V(4).Infof("Update reservation ledger of nodes %v", dirty.List())
+}
+
+// resync recomputes all the nodes, reports the ones drifting from the incremental updates and publishes a new snapshot.
+func (l *reservationLedger) resync() {
+	l.lock.Lock()
+	options := l.options
+	// the full recompute covers the nodes marked dirty so far
+	l.dirty = sets.NewString()
+	l.dirtyAll = false
+	l.lock.Unlock()
+
+	nodeList, err := l.accessor.GetAllNodes()
+	if err != nil {
+		glog.Errorf("Fail to list nodes to recompute reservation ledger: %s", err)
+		return
+	}
+
+	calculator := &PredicateHandler{cfg: options, accessor: l.accessor}
+	nodes := make(map[string]*nodeLedger, len(nodeList))
+	for _, node := range nodeList {
+		ledger, err := calculator.computeNodeLedger(node)
+		if err != nil {
+			glog.Errorf("Fail to compute reservation ledger of node %s: %s", node.Name, err)
+			continue
+		}
+		nodes[node.Name] = ledger
+	}
+
+	if current := l.Snapshot(); current != nil && current.matches(options) {
+		if drifted := driftedNodes(current.nodes, nodes); len(drifted) > 0 {
+			glog.Warningf("Reservation ledger of nodes %v drifts from the full recompute, corrected", drifted)
+			metrics.LedgerDrifts.Add(float64(len(drifted)))
+		}
+	}
+
+	l.snapshot.Store(newLedgerSnapshot(options, nodes))
+	glog.V(2).Infof("Recompute reservation ledger of %d nodes", len(nodes))
+}
+
+// driftedNodes returns the nodes whose ledger differs between the incremental updates and the full recompute.
+func driftedNodes(current, recomputed map[string]*nodeLedger) []string {
+	drifted := sets.NewString()
+	for nodeName, ledger := range recomputed {
+		if old, exist := current[nodeName]; exist && !old.equal(ledger) {
+			drifted.Insert(nodeName)
+		}
+	}
+	for nodeName := range current {
+		if _, exist := recomputed[nodeName]; !exist {
+			drifted.Insert(nodeName)
+		}
+	}
+	return drifted.List()
+}
+
+func (l *reservationLedger) compute(calculator *PredicateHandler, nodeName string) (*nodeLedger, error) {
+	node, err := l.accessor.GetNode(nodeName)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			glog.Errorf("Fail to get node %s to compute reservation ledger: %s", nodeName, err)
+		}
+		return nil, err
+	}
+
+	ledger, err := calculator.computeNodeLedger(node)
+	if err != nil {
+		glog.Errorf("Fail to compute reservation ledger of node %s: %s", nodeName, err)
+		return nil, err
+	}
+	return ledger, nil
+}
+
+func (l *reservationLedger) podHandler() cache.ResourceEventHandler {
+	markPodNode := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		if pod, ok := obj.(*v1.Pod); ok && len(pod.Spec.NodeName) > 0 {
+			l.markDirty(pod.Spec.NodeName)
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: markPodNode,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			markPodNode(oldObj)
+			markPodNode(newObj)
+		},
+		DeleteFunc: markPodNode,
+	}
+}
+
+// pvcHandler marks the nodes of the PV bound by the PVC, since the pods mounting a PV are found by its PVC.
+func (l *reservationLedger) pvcHandler() cache.ResourceEventHandler {
+	markPVNodes := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		pvc, ok := obj.(*v1.PersistentVolumeClaim)
+		if !ok || len(pvc.Spec.VolumeName) == 0 {
+			return
+		}
+		if snapshot := l.Snapshot(); snapshot != nil && snapshot.pvNodes[pvc.Spec.VolumeName].Len() > 0 {
+			l.markDirty(snapshot.pvNodes[pvc.Spec.VolumeName].List()...)
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: markPVNodes,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			markPVNodes(oldObj)
+			markPVNodes(newObj)
+		},
+		DeleteFunc: markPVNodes,
+	}
+}
+
+// nodeHandler marks the nodes changing their allocatable resources. Label changes are delivered by the index.
+func (l *reservationLedger) nodeHandler() cache.ResourceEventHandler {
+	markNode := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		if node, ok := obj.(*v1.Node); ok {
+			l.markDirty(node.Name)
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: markNode,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNode, ok1 := oldObj.(*v1.Node)
+			newNode, ok2 := newObj.(*v1.Node)
+			if !ok1 || !ok2 {
+				return
+			}
+			if oldNode.Status.Allocatable.Cpu().Cmp(*newNode.Status.Allocatable.Cpu()) != 0 ||
+				oldNode.Status.Allocatable.Memory().Cmp(*newNode.Status.Allocatable.Memory()) != 0 {
+				l.markDirty(newNode.Name)
+			}
+		},
+		DeleteFunc: markNode,
+	}
+}
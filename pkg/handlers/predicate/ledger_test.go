@@ -0,0 +1,161 @@
+package predicate
+
+import (
+	"testing"
+
+	"k8s.io/api/core/v1"
+)
+
+func TestReservationLedger(t *testing.T) {
+	accessor := &MockAccessor{}
+
+	node1 := buildNode(t, "node1", "8", "10G")
+	node2 := buildNode(t, "node2", "8", "10G")
+	accessor.Nodes = []*v1.Node{node1, node2}
+
+	cpu := "4"
+	mem := "4G"
+	pv := buildPV("pv1", &node1.Name, &cpu, &mem)
+	accessor.PVs = []*v1.PersistentVolume{pv}
+
+	pvc := buildPVC("test", "pvc1")
+	accessor.PVCs = map[string][]*v1.PersistentVolumeClaim{pvc.Namespace: {pvc}}
+	bind(pv, pvc)
+
+	ledger := newLedger(accessor, opts)
+	ledger.resync()
+	snapshot := ledger.Snapshot()
+	if snapshot == nil || len(snapshot.nodes) != 2 {
+		t.Fatalf("expecting ledgers of 2 nodes, got %v", snapshot)
+	}
+	if nodes := snapshot.pvNodes[pv.Name]; nodes.Len() != 1 || !nodes.Has(node1.Name) {
+		t.Fatalf("expecting pv1 on node1, got %v", nodes)
+	}
+	assertQuantity(t, "reserved cpu", snapshot.nodes[node1.Name].ReservedCpu, "4")
+
+	// the pod mounting the pv marks its node dirty
+	pod1 := buildPod(t, "test", "pod1", []string{pvc.Name}, []string{"1"}, []string{"1G"})
+	bindNode(pod1, node1.Name)
+	accessor.AddPod(pod1)
+	ledger.podHandler().OnAdd(pod1)
+	if !ledger.dirty.Has(node1.Name) || ledger.dirty.Len() != 1 {
+		t.Fatalf("expecting node1 dirty, got %v", ledger.dirty)
+	}
+	ledger.update()
+	if ledger.dirty.Len() != 0 {
+		t.Fatalf("expecting no dirty node after update, got %v", ledger.dirty)
+	}
+
+	node1Ledger := ledger.Snapshot().nodes[node1.Name]
+	reservation := node1Ledger.PVs[pv.Name]
+	assertQuantity(t, "consumed cpu", reservation.ConsumedCpu, "1")
+	assertQuantity(t, "remaining cpu", reservation.RemainingCpu, "3")
+	assertQuantity(t, "remaining memory", reservation.RemainingMem, "3G")
+	assertQuantity(t, "unreserved cpu", node1Ledger.UnreservedCpu, "4")
+	// the previous snapshot is not changed
+	assertQuantity(t, "reserved cpu", snapshot.nodes[node1.Name].ReservedCpu, "4")
+	if ledger.Snapshot().nodes[node2.Name] != snapshot.nodes[node2.Name] {
+		t.Fatalf("expecting ledger of node2 not recomputed")
+	}
+
+	// filter calls read the snapshot
+	handler := &PredicateHandler{cfg: opts, accessor: accessor, ledger: ledger}
+	pod2 := buildPod(t, "test", "pod2", []string{pvc.Name}, []string{"3"}, []string{"1G"})
+	assert(t).Fit(handler.predicateOneNode(node1, pod2))
+	pod3 := buildPod(t, "test", "pod3", []string{}, []string{"5"}, []string{"1G"})
+	assert(t).Unfit(handler.predicateOneNode(node1, pod3))
+
+	// a pod added without event drifts the ledger until the full recompute
+	bindNode(pod2, node1.Name)
+	accessor.AddPod(pod2)
+	assert(t).Fit(handler.predicateOneNode(node1, pod2))
+	if drifted := driftedNodes(ledger.Snapshot().nodes, recomputeNodes(t, handler)); len(drifted) != 1 || drifted[0] != node1.Name {
+		t.Fatalf("expecting node1 drifted, got %v", drifted)
+	}
+	ledger.resync()
+	assert(t).Unfit(handler.predicateOneNode(node1, pod2))
+
+	// a deleted node is removed from the ledger
+	accessor.Nodes = []*v1.Node{node1}
+	ledger.nodeHandler().OnDelete(node2)
+	ledger.update()
+	if _, exist := ledger.Snapshot().nodes[node2.Name]; exist {
+		t.Fatalf("expecting ledger of node2 removed")
+	}
+}
+
+func TestReservationLedgerReload(t *testing.T) {
+	accessor := &MockAccessor{}
+	node := buildNode(t, "node1", "8", "10G")
+	accessor.Nodes = []*v1.Node{node}
+	cpu := "4"
+	accessor.PVs = []*v1.PersistentVolume{buildPV("pv1", &node.Name, &cpu, nil)}
+
+	ledger := newLedger(accessor, opts)
+	ledger.resync()
+
+	// the snapshot computed with other annotation keys is not used
+	reloaded := *opts
+	reloaded.ReservedCpuAnnoKey = "other-cpu"
+	handler := &PredicateHandler{cfg: &reloaded, accessor: accessor, ledger: ledger}
+	reservation, err := handler.NodeReservation(node)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	assertQuantity(t, "reserved cpu", reservation.ReservedCpu, "0")
+
+	ledger.Reload(&reloaded)
+	if !ledger.dirtyAll {
+		t.Fatalf("expecting a full recompute after reload")
+	}
+	ledger.update()
+	if snapshot := ledger.Snapshot(); !snapshot.matches(&reloaded) || len(snapshot.nodes[node.Name].PVs) != 0 {
+		t.Fatalf("expecting ledger recomputed with the reloaded options, got %v", snapshot.nodes[node.Name])
+	}
+}
+
+func TestLocalPVIndexListener(t *testing.T) {
+	index := newLocalPVIndex()
+	notified := []string{}
+	index.addListener(func(nodeNames ...string) {
+		notified = append(notified, nodeNames...)
+	})
+
+	node1 := buildNode(t, "node1", "8", "10G")
+	node2 := buildNode(t, "node2", "8", "10G")
+	index.updateNode(node1)
+	index.updateNode(node2)
+	// status updates are not notified
+	index.updateNode(node2.DeepCopy())
+
+	cpu := "1"
+	pv := buildPV("pv1", &node1.Name, &cpu, nil)
+	index.updatePV(pv)
+	// the nodes matched before and after the update are notified
+	moved := buildPV("pv1", &node2.Name, &cpu, nil)
+	index.updatePV(moved)
+	index.deletePV(moved.Name)
+
+	expected := []string{"node1", "node2", "node1", "node1", "node2", "node2"}
+	if len(notified) != len(expected) {
+		t.Fatalf("expecting notified %v, got %v", expected, notified)
+	}
+	for i := range expected {
+		if notified[i] != expected[i] {
+			t.Fatalf("expecting notified %v, got %v", expected, notified)
+		}
+	}
+}
+
+func recomputeNodes(t *testing.T, handler *PredicateHandler) map[string]*nodeLedger {
+	nodes := map[string]*nodeLedger{}
+	nodeList, _ := handler.accessor.GetAllNodes()
+	for _, node := range nodeList {
+		ledger, err := handler.computeNodeLedger(node)
+		if err != nil {
+			t.Fatalf("unexpected err: %s", err)
+		}
+		nodes[node.Name] = ledger
+	}
+	return nodes
+}
@@ -0,0 +1,239 @@
+package predicate
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	v1helper "k8s.io/kubernetes/pkg/apis/core/v1/helper"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+)
+
+// The checks of the reservation annotations reported by Lint.
+const (
+	// the reservation annotation is not a quantity, or is negative
+	CheckInvalidQuantity = "invalid-quantity"
+	// the reservation annotations of the key and its aliases have different values
+	CheckConflictingKeys = "conflicting-keys"
+	// the reservation annotation is on a PV which is not local, so that it is ignored
+	CheckNonLocalReservation = "non-local-reservation"
+	// the local PV has no NodeAffinity, or it has no term or an invalid requirement
+	CheckMalformedNodeAffinity = "malformed-node-affinity"
+	// the NodeAffinity of the local PV matches no node
+	CheckNoMatchingNode = "no-matching-node"
+	// the reservation of the PV is more than the allocatable of a node it is on
+	CheckReservationExceedsNode = "reservation-exceeds-node"
+	// the reservations of the PVs on the node add up to more than its allocatable
+	CheckNodeOverReserved = "node-over-reserved"
+)
+
+// LintFormats are the formats the findings of Lint are written in.
+var LintFormats = []string{"table", "json"}
+
+// LintFinding is a problem of the reservation found on a PV or a node.
+type LintFinding struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// Lint audits the reservation annotations of the PVs in the cluster made of the objects, without an API server.
+// The findings are in the order of kind, name and check.
+func Lint(options *config.OptionConfig, objects []runtime.Object) ([]LintFinding, error) {
+	accessor, err := newMemoryAccessor(objects)
+	if err != nil {
+		return nil, err
+	}
+	return lint(options, accessor)
+}
+
+// lintReservation is the valid reservation of a local PV.
+type lintReservation struct {
+	cpu, mem resource.Quantity
+}
+
+func lint(options *config.OptionConfig, accessor resourceAccessor) ([]LintFinding, error) {
+	pvs, err := accessor.GetAllPersistentVolume()
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := accessor.GetAllNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	findings := []LintFinding{}
+	pvFinding := func(pv *v1.PersistentVolume, check, format string, args ...interface{}) {
+		findings = append(findings, LintFinding{Kind: "PersistentVolume", Name: pv.Name, Check: check, Message: fmt.Sprintf(format, args...)})
+	}
+
+	reservations := map[string]*lintReservation{}
+	for _, pv := range pvs {
+		reservation := &lintReservation{}
+		reserved := false
+		for _, r := range []struct {
+			key      string
+			aliases  []string
+			quantity *resource.Quantity
+		}{
+			{options.ReservedCpuAnnoKey, options.ReservedCpuAnnoKeyAliases, &reservation.cpu},
+			{options.ReservedMemAnnoKey, options.ReservedMemAnnoKeyAliases, &reservation.mem},
+		} {
+			key, val, exist := reservedAnnotation(pv, r.key, r.aliases)
+			if !exist {
+				continue
+			}
+			reserved = true
+			if conflicting := conflictingAnnotations(pv, r.key, r.aliases); len(conflicting) > 0 {
+				pvFinding(pv, CheckConflictingKeys, "annotations %s have different values, %s=%q is read", strings.Join(conflicting, ", "), key, val)
+			}
+			quantity, err := resource.ParseQuantity(val)
+			if err != nil {
+				pvFinding(pv, CheckInvalidQuantity, "annotation %s=%q is not a quantity: %s", key, val, err)
+				continue
+			}
+			if quantity.Sign() < 0 {
+				pvFinding(pv, CheckInvalidQuantity, "annotation %s=%q is negative", key, val)
+				continue
+			}
+			*r.quantity = quantity
+		}
+
+		if pv.Spec.Local == nil {
+			if reserved {
+				pvFinding(pv, CheckNonLocalReservation, "reservation annotation on a PV which is not local is ignored")
+			}
+			continue
+		}
+		if msg := malformedNodeAffinity(pv); len(msg) > 0 {
+			pvFinding(pv, CheckMalformedNodeAffinity, "%s", msg)
+			continue
+		}
+
+		matched := false
+		for _, node := range nodes {
+			if !nodeMatchesNodeSelectorTerms(node, pv.Spec.NodeAffinity.Required.NodeSelectorTerms) {
+				continue
+			}
+			matched = true
+			if !reserved {
+				continue
+			}
+			cpu, mem := node.Status.Allocatable.Cpu(), node.Status.Allocatable.Memory()
+			if reservation.cpu.Cmp(*cpu) > 0 {
+				pvFinding(pv, CheckReservationExceedsNode, "reserved cpu %s is more than the allocatable %s of node %s", reservation.cpu.String(), cpu.String(), node.Name)
+			}
+			if reservation.mem.Cmp(*mem) > 0 {
+				pvFinding(pv, CheckReservationExceedsNode, "reserved memory %s is more than the allocatable %s of node %s", reservation.mem.String(), mem.String(), node.Name)
+			}
+		}
+		if !matched {
+			pvFinding(pv, CheckNoMatchingNode, "NodeAffinity matches none of the %d nodes", len(nodes))
+		}
+		if reserved {
+			reservations[pv.Name] = reservation
+		}
+	}
+
+	for _, node := range nodes {
+		nodePVs, err := accessor.GetLocalPersistentVolumesOnNode(node.Name)
+		if err != nil {
+			return nil, err
+		}
+		cpu, mem := ZeroQuantity.DeepCopy(), ZeroQuantity.DeepCopy()
+		for _, pv := range nodePVs {
+			if reservation, exist := reservations[pv.Name]; exist {
+				cpu.Add(reservation.cpu)
+				mem.Add(reservation.mem)
+			}
+		}
+		allocatableCpu, allocatableMem := node.Status.Allocatable.Cpu(), node.Status.Allocatable.Memory()
+		if cpu.Cmp(*allocatableCpu) > 0 {
+			findings = append(findings, LintFinding{Kind: "Node", Name: node.Name, Check: CheckNodeOverReserved,
+				Message: fmt.Sprintf("reserved cpu %s of the local PVs is more than the allocatable %s", cpu.String(), allocatableCpu.String())})
+		}
+		if mem.Cmp(*allocatableMem) > 0 {
+			findings = append(findings, LintFinding{Kind: "Node", Name: node.Name, Check: CheckNodeOverReserved,
+				Message: fmt.Sprintf("reserved memory %s of the local PVs is more than the allocatable %s", mem.String(), allocatableMem.String())})
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Kind != findings[j].Kind {
+			return findings[i].Kind < findings[j].Kind
+		}
+		if findings[i].Name != findings[j].Name {
+			return findings[i].Name < findings[j].Name
+		}
+		return findings[i].Check < findings[j].Check
+	})
+	return findings, nil
+}
+
+// conflictingAnnotations returns the annotations of the key and its aliases present on the PV as key=value,
+// if they do not all have the same value.
+func conflictingAnnotations(pv *v1.PersistentVolume, key string, aliases []string) []string {
+	present := []string{}
+	values := sets.NewString()
+	for _, k := range append([]string{key}, aliases...) {
+		if val, exist := pv.Annotations[k]; exist {
+			present = append(present, fmt.Sprintf("%s=%q", k, val))
+			values.Insert(val)
+		}
+	}
+	if values.Len() <= 1 {
+		return nil
+	}
+	return present
+}
+
+// malformedNodeAffinity returns why the NodeAffinity of the local PV can not be matched against nodes, or empty if it can.
+func malformedNodeAffinity(pv *v1.PersistentVolume) string {
+	if pv.Spec.NodeAffinity == nil || pv.Spec.NodeAffinity.Required == nil {
+		return "local PV has no required NodeAffinity"
+	}
+	terms := pv.Spec.NodeAffinity.Required.NodeSelectorTerms
+	if len(terms) == 0 {
+		return "required NodeAffinity has no node selector term"
+	}
+	for i, term := range terms {
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			return fmt.Sprintf("node selector term %d is empty, which matches no node", i)
+		}
+		if _, err := v1helper.NodeSelectorRequirementsAsSelector(term.MatchExpressions); err != nil {
+			return fmt.Sprintf("node selector term %d has invalid matchExpressions: %s", i, err)
+		}
+		if _, err := v1helper.NodeSelectorRequirementsAsFieldSelector(term.MatchFields); err != nil {
+			return fmt.Sprintf("node selector term %d has invalid matchFields: %s", i, err)
+		}
+	}
+	return ""
+}
+
+// WriteLintFindings writes the findings in one of LintFormats.
+func WriteLintFindings(w io.Writer, findings []LintFinding, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(findings)
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "KIND\tNAME\tCHECK\tMESSAGE")
+		for _, finding := range findings {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", finding.Kind, finding.Name, finding.Check, finding.Message)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown format %s, should be one of %v", format, LintFormats)
+	}
+}
@@ -0,0 +1,86 @@
+package predicate
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestLint(t *testing.T) {
+	node1 := buildNode(t, "node1", "4", "8Gi")
+	node2 := buildNode(t, "node2", "4", "8Gi")
+
+	cpu, mem, oneCore := "3", "4Gi", "1 core"
+	// fine alone, but over-reserves node1 together with pv2
+	pv1 := buildPV("pv1", &node1.Name, &cpu, &mem)
+	pv2 := buildPV("pv2", &node1.Name, &cpu, nil)
+	malformed := buildPV("malformed", &node2.Name, &oneCore, nil)
+	nonLocal := buildPV("nonlocal", nil, &cpu, nil)
+	// over-reserves node2 alone
+	big := "16Gi"
+	exceeding := buildPV("exceeding", &node2.Name, nil, &big)
+	noAffinity := buildPV("noaffinity", &node2.Name, &cpu, nil)
+	noAffinity.Spec.NodeAffinity = nil
+	invalidOperator := buildPV("invalidoperator", &node2.Name, &cpu, nil)
+	invalidOperator.Spec.NodeAffinity.Required.NodeSelectorTerms[0].MatchExpressions[0].Operator = "Like"
+	node3 := "node3"
+	orphan := buildPV("orphan", &node3, nil, nil)
+	// no finding on a local PV without reservation or a PV which is neither local nor reserved
+	plain := buildPV("plain", &node2.Name, nil, nil)
+	other := buildPV("other", nil, nil, nil)
+
+	objects := []runtime.Object{node1, node2, pv1, pv2, malformed, nonLocal, exceeding, noAffinity, invalidOperator, orphan, plain, other}
+	findings, err := Lint(opts, objects)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	checks := []string{}
+	for _, finding := range findings {
+		checks = append(checks, finding.Kind+"/"+finding.Name+":"+finding.Check)
+	}
+	expected := []string{
+		"Node/node1:" + CheckNodeOverReserved,
+		"Node/node2:" + CheckNodeOverReserved,
+		"PersistentVolume/exceeding:" + CheckReservationExceedsNode,
+		"PersistentVolume/invalidoperator:" + CheckMalformedNodeAffinity,
+		"PersistentVolume/malformed:" + CheckInvalidQuantity,
+		"PersistentVolume/noaffinity:" + CheckMalformedNodeAffinity,
+		"PersistentVolume/nonlocal:" + CheckNonLocalReservation,
+		"PersistentVolume/orphan:" + CheckNoMatchingNode,
+	}
+	if !reflect.DeepEqual(checks, expected) {
+		t.Fatalf("expecting findings %v, got %v", expected, checks)
+	}
+	if !strings.Contains(findings[0].Message, "reserved cpu 6") {
+		t.Fatalf("expecting the cpu of node1 reserved by both PVs, got %q", findings[0].Message)
+	}
+
+	out := &bytes.Buffer{}
+	if err := WriteLintFindings(out, findings, "table"); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != len(findings)+1 || !strings.HasPrefix(lines[0], "KIND") {
+		t.Fatalf("expecting a header and a line per finding, got %q", out.String())
+	}
+
+	// the values of the key and its aliases differ
+	aliased := *opts
+	aliased.ReservedCpuAnnoKeyAliases = []string{"old-cpu"}
+	pv1.Annotations["old-cpu"] = "2"
+	findings, err = Lint(&aliased, []runtime.Object{node1, pv1})
+	if err != nil || len(findings) != 1 || findings[0].Check != CheckConflictingKeys {
+		t.Fatalf("expecting conflicting keys, got %v, %v", findings, err)
+	}
+	delete(pv1.Annotations, "old-cpu")
+
+	// a clean cluster
+	findings, err = Lint(opts, []runtime.Object{node1, pv1, &v1.ConfigMap{}})
+	if err != nil || len(findings) != 0 {
+		t.Fatalf("expecting no finding, got %v, %v", findings, err)
+	}
+}
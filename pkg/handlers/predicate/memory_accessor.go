@@ -0,0 +1,105 @@
+package predicate
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	listerv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// memoryAccessor reads the objects from memory instead of informers, such as the objects loaded from files,
+// with the same listers and indexes as the ResourceAccessor.
+type memoryAccessor struct {
+	*ResourceAccessor
+	pvStore cache.Indexer
+}
+
+func newMemoryAccessor(objects []runtime.Object) (*memoryAccessor, error) {
+	nodeStore := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	pvStore := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	pvcStore := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	podStore := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+		podNodeNameIndex:     indexPodByNodeName,
+		podClaimIndex:        indexPodByClaim,
+	})
+	synced := func() bool { return true }
+
+	accessor := &memoryAccessor{
+		ResourceAccessor: &ResourceAccessor{
+			nodeLister: listerv1.NewNodeLister(nodeStore),
+			pvLister:   listerv1.NewPersistentVolumeLister(pvStore),
+			pvcLister:  listerv1.NewPersistentVolumeClaimLister(pvcStore),
+			podLister:  listerv1.NewPodLister(podStore),
+			podIndexer: podStore,
+
+			nodeSynced: synced,
+			pvSynced:   synced,
+			pvcSynced:  synced,
+			podSynced:  synced,
+
+			// the index is updated along with the stores below
+			localPVs:        newLocalPVIndex(),
+			pvIndexSynced:   synced,
+			nodeIndexSynced: synced,
+		},
+		pvStore: pvStore,
+	}
+
+	for _, obj := range objects {
+		var err error
+		switch o := obj.(type) {
+		case *v1.Node:
+			err = nodeStore.Add(o)
+			accessor.localPVs.updateNode(o)
+		case *v1.PersistentVolume:
+			err = pvStore.Add(o)
+			accessor.localPVs.updatePV(o)
+		case *v1.PersistentVolumeClaim:
+			err = pvcStore.Add(o)
+		case *v1.Pod:
+			// the same pods as cached by the informers, which are scheduled and not terminated
+			if len(o.Spec.NodeName) == 0 || o.Status.Phase == v1.PodSucceeded || o.Status.Phase == v1.PodFailed {
+				continue
+			}
+			err = podStore.Add(o)
+		default:
+			glog.V(1).Infof("Skip object %T, which is not read by the predicate", obj)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fail to add object %T: %w", obj, err)
+		}
+	}
+	return accessor, nil
+}
+
+// UpdatePersistentVolume updates the PV in memory, after through the API server if the accessor has a client,
+// such as when the objects are listed from it.
+// On conflict, the PV in memory is refreshed from the API server, so that the update can be retried on the latest one.
+func (a *memoryAccessor) UpdatePersistentVolume(volume *v1.PersistentVolume) (*v1.PersistentVolume, error) {
+	if a.cfg != nil && a.cfg.Client != nil {
+		updated, err := a.ResourceAccessor.UpdatePersistentVolume(volume)
+		if errors.Is(err, ErrConflict) {
+			if latest, getErr := a.cfg.Client.CoreV1().PersistentVolumes().Get(volume.Name, metav1.GetOptions{}); getErr != nil {
+				glog.Errorf("Fail to refresh persistent volume %s: %s", volume.Name, getErr)
+			} else if storeErr := a.pvStore.Update(latest); storeErr == nil {
+				a.localPVs.updatePV(latest)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		volume = updated
+	}
+
+	if err := a.pvStore.Update(volume); err != nil {
+		return nil, newResourceError("persistent volume", volume.Name, err)
+	}
+	a.localPVs.updatePV(volume)
+	return volume, nil
+}
@@ -0,0 +1,72 @@
+package predicate
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+)
+
+// MigrateAnnotations copies the reservation annotations of the local PVs in the cluster made of the objects
+// from the aliases of the annotation keys to the keys, through the API server of the client in the config if not on dry run.
+// The aliases are removed if removeAliases, otherwise they are kept for the predicate servers still reading them.
+// A PV whose key and aliases have different values is left unchanged and reported with an error.
+func MigrateAnnotations(cfg *config.Config, objects []runtime.Object, removeAliases, dryRun bool) ([]PVAnnotation, error) {
+	accessor, err := newMemoryAccessor(objects)
+	if err != nil {
+		return nil, err
+	}
+	accessor.cfg = cfg
+	return migrateAnnotations(cfg.Options, accessor, removeAliases, dryRun)
+}
+
+func migrateAnnotations(options *config.OptionConfig, accessor resourceAccessor, removeAliases, dryRun bool) ([]PVAnnotation, error) {
+	if len(options.ReservedCpuAnnoKeyAliases) == 0 && len(options.ReservedMemAnnoKeyAliases) == 0 {
+		return nil, fmt.Errorf("no alias of the reservation annotation keys to migrate from")
+	}
+	pvs, err := PVSelector{}.selectPVs(accessor)
+	if err != nil {
+		return nil, err
+	}
+	return updateAnnotations(accessor, pvs, dryRun, func(pv *v1.PersistentVolume) (*v1.PersistentVolume, []AnnotationChange, error) {
+		return migrateAnnotation(options, pv, removeAliases)
+	}), nil
+}
+
+// migrateAnnotation returns a copy of the PV with the reservation annotations migrated, or an error if they are conflicting.
+func migrateAnnotation(options *config.OptionConfig, pv *v1.PersistentVolume, removeAliases bool) (*v1.PersistentVolume, []AnnotationChange, error) {
+	updated := pv.DeepCopy()
+	changes := []AnnotationChange{}
+	for _, r := range []struct {
+		key     string
+		aliases []string
+	}{
+		{options.ReservedCpuAnnoKey, options.ReservedCpuAnnoKeyAliases},
+		{options.ReservedMemAnnoKey, options.ReservedMemAnnoKeyAliases},
+	} {
+		if conflicting := conflictingAnnotations(pv, r.key, r.aliases); len(conflicting) > 0 {
+			return nil, nil, fmt.Errorf("annotations %s have different values", strings.Join(conflicting, ", "))
+		}
+		_, val, exist := reservedAnnotation(pv, r.key, r.aliases)
+		if !exist {
+			continue
+		}
+		if _, migrated := updated.Annotations[r.key]; !migrated {
+			updated.Annotations[r.key] = val
+			changes = append(changes, AnnotationChange{Key: r.key, New: val})
+		}
+		if !removeAliases {
+			continue
+		}
+		for _, alias := range r.aliases {
+			if old, exist := updated.Annotations[alias]; exist {
+				delete(updated.Annotations, alias)
+				changes = append(changes, AnnotationChange{Key: alias, Old: old})
+			}
+		}
+	}
+	return updated, changes, nil
+}
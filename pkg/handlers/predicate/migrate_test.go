@@ -0,0 +1,63 @@
+package predicate
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+)
+
+func TestMigrateAnnotations(t *testing.T) {
+	node := buildNode(t, "node1", "8", "16Gi")
+	old := buildPV("old", &node.Name, nil, nil)
+	old.Annotations = map[string]string{"reserved-cpu": "1", "reserved-mem": "1Gi"}
+	migrated := buildPV("migrated", &node.Name, nil, nil)
+	migrated.Annotations = map[string]string{"new-cpu": "1", "reserved-cpu": "1"}
+	conflicting := buildPV("conflicting", &node.Name, nil, nil)
+	conflicting.Annotations = map[string]string{"new-cpu": "2", "reserved-cpu": "1"}
+	plain := buildPV("plain", &node.Name, nil, nil)
+
+	options := &config.OptionConfig{
+		ReservedCpuAnnoKey:        "new-cpu",
+		ReservedCpuAnnoKeyAliases: []string{"reserved-cpu"},
+		ReservedMemAnnoKey:        "new-mem",
+		ReservedMemAnnoKeyAliases: []string{"reserved-mem"},
+	}
+	accessor, err := newMemoryAccessor([]runtime.Object{node, old, migrated, conflicting, plain})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	// the old keys are kept by default
+	results, err := migrateAnnotations(options, accessor, false, false)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	expected := []PVAnnotation{
+		{PV: "conflicting", Error: `annotations new-cpu="2", reserved-cpu="1" have different values`},
+		{PV: "migrated", Changes: []AnnotationChange{}},
+		{PV: "old", Changes: []AnnotationChange{{Key: "new-cpu", New: "1"}, {Key: "new-mem", New: "1Gi"}}, Applied: true},
+		{PV: "plain", Changes: []AnnotationChange{}},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("expecting %+v, got %+v", expected, results)
+	}
+
+	results, err = migrateAnnotations(options, accessor, true, false)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if changes := results[2].Changes; !reflect.DeepEqual(changes, []AnnotationChange{{Key: "reserved-cpu", Old: "1"}, {Key: "reserved-mem", Old: "1Gi"}}) {
+		t.Fatalf("expecting the old keys removed, got %+v", changes)
+	}
+	pv, _ := accessor.GetPersistentVolume("old")
+	if !reflect.DeepEqual(pv.Annotations, map[string]string{"new-cpu": "1", "new-mem": "1Gi"}) {
+		t.Fatalf("unexpected annotations migrated %v", pv.Annotations)
+	}
+
+	if _, err := migrateAnnotations(opts, accessor, false, true); err == nil {
+		t.Fatalf("expecting err without alias")
+	}
+}
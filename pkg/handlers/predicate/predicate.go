@@ -8,6 +8,8 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/kubernetes/pkg/scheduler/api"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
 )
 
 var (
@@ -76,7 +78,7 @@ func nodeMatchesNodeSelectorTerms(node *v1.Node, nodeSelectorTerms []v1.NodeSele
 	return v1helper.MatchNodeSelectorTerms(nodeSelectorTerms, labels.Set(node.Labels), fields.Set(nodeFields))
 }
 
-func considerReserveResource(pv *v1.PersistentVolume, reservedCpuAnnoKey, reservedMemAnnoKey string) (bool, bool) {
+func considerReserveResource(pv *v1.PersistentVolume, options *config.OptionConfig) (bool, bool) {
 	bound := pv.Status.Phase == v1.VolumeBound
 	// skip no local PV and Unbound PV
 	if pv.Spec.Local == nil {
@@ -87,8 +89,8 @@ func considerReserveResource(pv *v1.PersistentVolume, reservedCpuAnnoKey, reserv
 	if pv.Annotations == nil || len(pv.Annotations) == 0 {
 		return false, bound
 	}
-	_, cpuExist := pv.Annotations[reservedCpuAnnoKey];
-	_, memExist := pv.Annotations[reservedMemAnnoKey];
+	_, _, cpuExist := reservedAnnotation(pv, options.ReservedCpuAnnoKey, options.ReservedCpuAnnoKeyAliases)
+	_, _, memExist := reservedAnnotation(pv, options.ReservedMemAnnoKey, options.ReservedMemAnnoKeyAliases)
 	if !cpuExist && !memExist {
 		return false, bound
 	}
@@ -96,8 +98,21 @@ func considerReserveResource(pv *v1.PersistentVolume, reservedCpuAnnoKey, reserv
 	return true, bound
 }
 
-func getResevedResource(pv *v1.PersistentVolume, key string) (resource.Quantity, bool, error) {
-	val, exist := pv.Annotations[key]
+// reservedAnnotation returns the key and value of the first annotation present on the PV, of the key followed by its aliases.
+func reservedAnnotation(pv *v1.PersistentVolume, key string, aliases []string) (string, string, bool) {
+	if val, exist := pv.Annotations[key]; exist {
+		return key, val, true
+	}
+	for _, alias := range aliases {
+		if val, exist := pv.Annotations[alias]; exist {
+			return alias, val, true
+		}
+	}
+	return "", "", false
+}
+
+func getResevedResource(pv *v1.PersistentVolume, key string, aliases []string) (resource.Quantity, bool, error) {
+	_, val, exist := reservedAnnotation(pv, key, aliases)
 	if !exist {
 		return ZeroQuantity, exist, nil
 	}
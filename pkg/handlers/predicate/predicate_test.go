@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"k8s.io/api/core/v1"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
 )
 
 func TestGetNilMountPods(t *testing.T) {
@@ -85,7 +87,7 @@ func TestConsiderReserveResource(t *testing.T) {
 	mem := "reservedMem"
 	out := "outOfReserved"
 	consider := func(pv *v1.PersistentVolume) bool {
-		cosider, _ := considerReserveResource(pv, cpu, mem)
+		cosider, _ := considerReserveResource(pv, &config.OptionConfig{ReservedCpuAnnoKey: cpu, ReservedMemAnnoKey: mem})
 		return cosider
 	}
 
@@ -182,3 +184,35 @@ func TestConsiderReserveResource(t *testing.T) {
 		}
 	}
 }
+
+func TestReservedAnnotationAliases(t *testing.T) {
+	options := &config.OptionConfig{
+		ReservedCpuAnnoKey:        "new-cpu",
+		ReservedCpuAnnoKeyAliases: []string{"old-cpu", "older-cpu"},
+		ReservedMemAnnoKey:        "new-mem",
+	}
+	pv := &v1.PersistentVolume{}
+	pv.Spec.Local = &v1.LocalVolumeSource{Path: "/tmp"}
+	pv.Annotations = map[string]string{"older-cpu": "1", "old-mem": "1Gi"}
+
+	// the aliases of cpu are read, but not the key of memory without alias
+	if consider, _ := considerReserveResource(pv, options); !consider {
+		t.Fatal("expected the reservation of an alias considered")
+	}
+	if key, val, _ := reservedAnnotation(pv, options.ReservedCpuAnnoKey, options.ReservedCpuAnnoKeyAliases); key != "older-cpu" || val != "1" {
+		t.Fatalf("unexpected annotation %s=%s", key, val)
+	}
+	if _, exist, _ := getResevedResource(pv, options.ReservedMemAnnoKey, options.ReservedMemAnnoKeyAliases); exist {
+		t.Fatal("unexpected reserved memory")
+	}
+
+	// in priority order
+	pv.Annotations["old-cpu"] = "2"
+	if quantity, _, _ := getResevedResource(pv, options.ReservedCpuAnnoKey, options.ReservedCpuAnnoKeyAliases); quantity.String() != "2" {
+		t.Fatalf("expected the first alias read, got %s", quantity.String())
+	}
+	pv.Annotations["new-cpu"] = "3"
+	if quantity, _, _ := getResevedResource(pv, options.ReservedCpuAnnoKey, options.ReservedCpuAnnoKeyAliases); quantity.String() != "3" {
+		t.Fatalf("expected the key read, got %s", quantity.String())
+	}
+}
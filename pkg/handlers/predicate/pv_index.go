@@ -0,0 +1,221 @@
+package predicate
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+)
+
+// localPVIndex maps each node to the local PVs whose NodeAffinity matches it.
+// It is maintained incrementally on PV and node events, so that looking up the local PVs on a node
+// costs O(PVs on the node), instead of matching every PV against the node.
+type localPVIndex struct {
+	lock sync.RWMutex
+
+	pvs   map[string]*v1.PersistentVolume
+	nodes map[string]*v1.Node
+
+	pvToNodes map[string]sets.String
+	nodeToPVs map[string]sets.String
+
+	// called with the nodes whose local PVs are changed, after the index is updated
+	listeners []func(nodeNames ...string)
+}
+
+func newLocalPVIndex() *localPVIndex {
+	return &localPVIndex{
+		pvs:       map[string]*v1.PersistentVolume{},
+		nodes:     map[string]*v1.Node{},
+		pvToNodes: map[string]sets.String{},
+		nodeToPVs: map[string]sets.String{},
+	}
+}
+
+func (i *localPVIndex) pvHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if pv, ok := obj.(*v1.PersistentVolume); ok {
+				i.updatePV(pv)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if pv, ok := newObj.(*v1.PersistentVolume); ok {
+				i.updatePV(pv)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pv, ok := obj.(*v1.PersistentVolume); ok {
+				i.deletePV(pv.Name)
+			}
+		},
+	}
+}
+
+func (i *localPVIndex) nodeHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if node, ok := obj.(*v1.Node); ok {
+				i.updateNode(node)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if node, ok := newObj.(*v1.Node); ok {
+				i.updateNode(node)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if node, ok := obj.(*v1.Node); ok {
+				i.deleteNode(node.Name)
+			}
+		},
+	}
+}
+
+// addListener must be called before the informers are started.
+func (i *localPVIndex) addListener(listener func(nodeNames ...string)) {
+	i.listeners = append(i.listeners, listener)
+}
+
+func (i *localPVIndex) notify(nodeNames sets.String) {
+	if nodeNames.Len() == 0 {
+		return
+	}
+	for _, listener := range i.listeners {
+		listener(nodeNames.List()...)
+	}
+}
+
+// PVsOnNode returns the local PVs whose NodeAffinity matches the node.
+func (i *localPVIndex) PVsOnNode(nodeName string) []*v1.PersistentVolume {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	pvs := make([]*v1.PersistentVolume, 0, i.nodeToPVs[nodeName].Len())
+	for pvName := range i.nodeToPVs[nodeName] {
+		pvs = append(pvs, i.pvs[pvName])
+	}
+	return pvs
+}
+
+// updatePV matches the PV against all the nodes, only if its NodeAffinity is changed.
+// The nodes matched before or after the update are notified, since the PV itself may be changed.
+func (i *localPVIndex) updatePV(pv *v1.PersistentVolume) {
+	terms := localPVNodeSelectorTerms(pv)
+	if terms == nil {
+		i.deletePV(pv.Name)
+		return
+	}
+
+	i.lock.Lock()
+	changed := sets.NewString(i.pvToNodes[pv.Name].UnsortedList()...)
+	old, exist := i.pvs[pv.Name]
+	i.pvs[pv.Name] = pv
+	if !exist || !reflect.DeepEqual(localPVNodeSelectorTerms(old), terms) {
+		i.unindexPV(pv.Name)
+		for nodeName, node := range i.nodes {
+			if nodeMatchesNodeSelectorTerms(node, terms) {
+				i.index(pv.Name, nodeName)
+			}
+		}
+	}
+	changed.Insert(i.pvToNodes[pv.Name].UnsortedList()...)
+	i.lock.Unlock()
+
+	i.notify(changed)
+}
+
+func (i *localPVIndex) deletePV(pvName string) {
+	i.lock.Lock()
+	changed := sets.NewString(i.pvToNodes[pvName].UnsortedList()...)
+	i.unindexPV(pvName)
+	delete(i.pvs, pvName)
+	i.lock.Unlock()
+
+	i.notify(changed)
+}
+
+// updateNode matches the node against all the local PVs, only if its labels are changed,
+// since nodes are updated frequently by their status.
+func (i *localPVIndex) updateNode(node *v1.Node) {
+	i.lock.Lock()
+	old, exist := i.nodes[node.Name]
+	i.nodes[node.Name] = node
+	if exist && reflect.DeepEqual(old.Labels, node.Labels) {
+		i.lock.Unlock()
+		return
+	}
+
+	i.unindexNode(node.Name)
+	for pvName, pv := range i.pvs {
+		if nodeMatchesNodeSelectorTerms(node, localPVNodeSelectorTerms(pv)) {
+			i.index(pvName, node.Name)
+		}
+	}
+	i.lock.Unlock()
+
+	i.notify(sets.NewString(node.Name))
+}
+
+func (i *localPVIndex) deleteNode(nodeName string) {
+	i.lock.Lock()
+	i.unindexNode(nodeName)
+	delete(i.nodes, nodeName)
+	i.lock.Unlock()
+
+	i.notify(sets.NewString(nodeName))
+}
+
+func (i *localPVIndex) index(pvName, nodeName string) {
+	if _, exist := i.pvToNodes[pvName]; !exist {
+		i.pvToNodes[pvName] = sets.NewString()
+	}
+	i.pvToNodes[pvName].Insert(nodeName)
+
+	if _, exist := i.nodeToPVs[nodeName]; !exist {
+		i.nodeToPVs[nodeName] = sets.NewString()
+	}
+	i.nodeToPVs[nodeName].Insert(pvName)
+}
+
+func (i *localPVIndex) unindexPV(pvName string) {
+	for nodeName := range i.pvToNodes[pvName] {
+		i.nodeToPVs[nodeName].Delete(pvName)
+		if i.nodeToPVs[nodeName].Len() == 0 {
+			delete(i.nodeToPVs, nodeName)
+		}
+	}
+	delete(i.pvToNodes, pvName)
+}
+
+func (i *localPVIndex) unindexNode(nodeName string) {
+	for pvName := range i.nodeToPVs[nodeName] {
+		i.pvToNodes[pvName].Delete(nodeName)
+		if i.pvToNodes[pvName].Len() == 0 {
+			delete(i.pvToNodes, pvName)
+		}
+	}
+	delete(i.nodeToPVs, nodeName)
+}
+
+// localPVNodeSelectorTerms returns nil if the PV is not a local PV with NodeAffinity.
+func localPVNodeSelectorTerms(pv *v1.PersistentVolume) []v1.NodeSelectorTerm {
+	if pv.Spec.Local == nil {
+		return nil
+	}
+
+	if pv.Spec.NodeAffinity == nil || pv.Spec.NodeAffinity.Required == nil || pv.Spec.NodeAffinity.Required.NodeSelectorTerms == nil {
+		glog.V(0).Infof("Local persistent volume %s has malformed NodeAffinity", pv.Name)
+		return nil
+	}
+	return pv.Spec.NodeAffinity.Required.NodeSelectorTerms
+}
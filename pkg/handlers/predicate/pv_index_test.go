@@ -0,0 +1,107 @@
+package predicate
+
+import (
+	"sort"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func pvNamesOnNode(index *localPVIndex, nodeName string) []string {
+	names := []string{}
+	for _, pv := range index.PVsOnNode(nodeName) {
+		names = append(names, pv.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func assertPVsOnNode(t *testing.T, index *localPVIndex, nodeName string, expected ...string) {
+	names := pvNamesOnNode(index, nodeName)
+	if len(names) != len(expected) {
+		t.Fatalf("expecting pvs %v on node %s, got %v", expected, nodeName, names)
+	}
+	for i := range names {
+		if names[i] != expected[i] {
+			t.Fatalf("expecting pvs %v on node %s, got %v", expected, nodeName, names)
+		}
+	}
+}
+
+func TestLocalPVIndex(t *testing.T) {
+	index := newLocalPVIndex()
+	pvHandler := index.pvHandler()
+	nodeHandler := index.nodeHandler()
+
+	node1 := buildNode(t, "node1", "8", "10G")
+	node2 := buildNode(t, "node2", "8", "10G")
+	nodeHandler.OnAdd(node1)
+
+	cpu := "1"
+	pv1 := buildPV("pv1", &node1.Name, &cpu, nil)
+	pv2 := buildPV("pv2", &node2.Name, &cpu, nil)
+	// not a local pv
+	pv3 := buildPV("pv3", nil, &cpu, nil)
+	pvHandler.OnAdd(pv1)
+	pvHandler.OnAdd(pv2)
+	pvHandler.OnAdd(pv3)
+	assertPVsOnNode(t, index, "node1", "pv1")
+	assertPVsOnNode(t, index, "node2")
+
+	// pvs are matched against the nodes added later
+	nodeHandler.OnAdd(node2)
+	assertPVsOnNode(t, index, "node2", "pv2")
+
+	// the node changes its label to the one of node1
+	relabeled := node2.DeepCopy()
+	relabeled.Labels[NODE_LABEL] = "node1"
+	nodeHandler.OnUpdate(node2, relabeled)
+	assertPVsOnNode(t, index, "node2", "pv1")
+
+	// the pv changes its NodeAffinity
+	moved := buildPV("pv1", &node1.Name, &cpu, nil)
+	moved.Spec.NodeAffinity.Required.NodeSelectorTerms[0].MatchExpressions[0].Values = []string{"none"}
+	pvHandler.OnUpdate(pv1, moved)
+	assertPVsOnNode(t, index, "node1")
+	assertPVsOnNode(t, index, "node2")
+
+	pvHandler.OnUpdate(moved, pv1)
+	assertPVsOnNode(t, index, "node1", "pv1")
+
+	// an update keeping the NodeAffinity replaces the pv
+	annotated := pv1.DeepCopy()
+	annotated.Annotations["updated"] = "true"
+	pvHandler.OnUpdate(pv1, annotated)
+	if pvs := index.PVsOnNode("node1"); len(pvs) != 1 || pvs[0].Annotations["updated"] != "true" {
+		t.Fatalf("expecting the updated pv on node1, got %v", pvs)
+	}
+
+	pvHandler.OnDelete(cache.DeletedFinalStateUnknown{Key: "pv1", Obj: annotated})
+	assertPVsOnNode(t, index, "node1")
+	assertPVsOnNode(t, index, "node2")
+
+	pvHandler.OnAdd(pv1)
+	nodeHandler.OnDelete(node1)
+	assertPVsOnNode(t, index, "node1")
+	assertPVsOnNode(t, index, "node2", "pv1")
+	if len(index.pvToNodes["pv1"]) != 1 || len(index.nodeToPVs) != 1 {
+		t.Fatalf("unexpected index %v, %v", index.pvToNodes, index.nodeToPVs)
+	}
+}
+
+func TestLocalPVIndexMalformedNodeAffinity(t *testing.T) {
+	index := newLocalPVIndex()
+	node := buildNode(t, "node1", "8", "10G")
+	index.updateNode(node)
+
+	cpu := "1"
+	pv := buildPV("pv1", &node.Name, &cpu, nil)
+	index.updatePV(pv)
+	assertPVsOnNode(t, index, "node1", "pv1")
+
+	malformed := pv.DeepCopy()
+	malformed.Spec.NodeAffinity = &v1.VolumeNodeAffinity{}
+	index.updatePV(malformed)
+	assertPVsOnNode(t, index, "node1")
+}
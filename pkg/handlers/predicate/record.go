@@ -0,0 +1,430 @@
+package predicate
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/kubernetes/pkg/scheduler/api"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/metrics"
+)
+
+// filterRecordQueueSize is how many records wait to be written, beyond which the records are dropped
+// instead of delaying the filter calls.
+const filterRecordQueueSize = 1024
+
+// FilterRecord is a filter call recorded to be replayed, with the objects the predicate reads for the pod on the nodes.
+// The objects are the ones of the snapshot the nodes are predicated against, collected off the filter call.
+//
+// A record written to a file only carries the objects first seen or changed since the previous records of the file,
+// and the keys of the objects written before but no longer read, such as the deleted pods, in Removed.
+// The first record written to a file carries all its objects and has Reset set, so that the objects each call
+// is predicated against are rebuilt by applying the records of a file in order from it.
+type FilterRecord struct {
+	Time   time.Time                 `json:"time"`
+	Args   *api.ExtenderArgs         `json:"args"`
+	Result *api.ExtenderFilterResult `json:"result"`
+
+	// the sha256 of the kinds, keys and resource versions of all the objects read, to tell whether the state changes
+	Digest                 string                      `json:"digest"`
+	Reset                  bool                        `json:"reset,omitempty"`
+	Nodes                  []*v1.Node                  `json:"nodes,omitempty"`
+	Pods                   []*v1.Pod                   `json:"pods,omitempty"`
+	PersistentVolumes      []*v1.PersistentVolume      `json:"persistentVolumes,omitempty"`
+	PersistentVolumeClaims []*v1.PersistentVolumeClaim `json:"persistentVolumeClaims,omitempty"`
+	Removed                []string                    `json:"removed,omitempty"`
+
+	// the keys of the node and of the pods and local PVs on it of each node of the call, nil if the node is not found,
+	// to tell the objects removed since the previous records
+	nodeKeys map[string][]string
+}
+
+// objects returns the objects of the record, to build the cluster the record is replayed against.
+func (r *FilterRecord) objects() []runtime.Object {
+	objects := make([]runtime.Object, 0, len(r.Nodes)+len(r.Pods)+len(r.PersistentVolumes)+len(r.PersistentVolumeClaims))
+	for _, node := range r.Nodes {
+		objects = append(objects, node)
+	}
+	for _, pod := range r.Pods {
+		objects = append(objects, pod)
+	}
+	for _, pv := range r.PersistentVolumes {
+		objects = append(objects, pv)
+	}
+	for _, pvc := range r.PersistentVolumeClaims {
+		objects = append(objects, pvc)
+	}
+	return objects
+}
+
+func (r *FilterRecord) digest() string {
+	keys := []string{}
+	for _, obj := range r.objects() {
+		key, resourceVersion := recordKey(obj)
+		keys = append(keys, key+"@"+resourceVersion)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, key := range keys {
+		io.WriteString(hash, key)
+		hash.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// recordKey returns the kind and key of a recorded object, such as "Pod/<namespace>/<name>", and its resource version.
+func recordKey(obj runtime.Object) (string, string) {
+	switch obj := obj.(type) {
+	case *v1.Node:
+		return "Node/" + obj.Name, obj.ResourceVersion
+	case *v1.Pod:
+		return "Pod/" + obj.Namespace + "/" + obj.Name, obj.ResourceVersion
+	case *v1.PersistentVolume:
+		return "PersistentVolume/" + obj.Name, obj.ResourceVersion
+	case *v1.PersistentVolumeClaim:
+		return "PersistentVolumeClaim/" + obj.Namespace + "/" + obj.Name, obj.ResourceVersion
+	}
+	return fmt.Sprintf("%T", obj), ""
+}
+
+// claimKeys returns the keys of the claims of the pod volumes.
+func claimKeys(pod *v1.Pod) []string {
+	keys := []string{}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			keys = append(keys, "PersistentVolumeClaim/"+pod.Namespace+"/"+volume.PersistentVolumeClaim.ClaimName)
+		}
+	}
+	return keys
+}
+
+// recordState is the objects by key the records of a file are replayed against.
+type recordState map[string]runtime.Object
+
+// apply rebuilds the state with the objects of the record, from scratch if the record is reset.
+func (s recordState) apply(record *FilterRecord) recordState {
+	if record.Reset {
+		s = recordState{}
+	}
+	for _, key := range record.Removed {
+		delete(s, key)
+	}
+	for _, obj := range record.objects() {
+		key, _ := recordKey(obj)
+		s[key] = obj
+	}
+	return s
+}
+
+func (s recordState) objects() []runtime.Object {
+	objects := make([]runtime.Object, 0, len(s))
+	for _, obj := range s {
+		objects = append(objects, obj)
+	}
+	return objects
+}
+
+// filterCall is a filter call queued to be recorded, which only refers to the snapshot it is predicated against,
+// so that recording costs the filter call nothing but queuing it.
+type filterCall struct {
+	time      time.Time
+	handler   *PredicateHandler
+	args      *api.ExtenderArgs
+	nodeNames []string
+	result    *api.ExtenderFilterResult
+	// nil if the call is answered before the snapshot is taken
+	snapshot *filterSnapshot
+}
+
+// collect records the node, the pods and the local PVs of each node, and the claims of the pod in the snapshot.
+// The nodes the snapshot misses, such as the ones whose decisions are cached before the ledger is built,
+// and all of them without a snapshot are computed from the informer caches now.
+func (c *filterCall) collect() *FilterRecord {
+	record := &FilterRecord{Time: c.time, Args: c.args, Result: c.result, Reset: true, nodeKeys: map[string][]string{}}
+
+	snapshot := &filterSnapshot{}
+	if c.snapshot != nil {
+		// the snapshot is shared with the filter call, snapshotNodes sets a new map to the copy
+		*snapshot = *c.snapshot
+	} else {
+		snapshot = c.handler.takeSnapshot(c.args.Pod)
+	}
+	c.handler.snapshotNodes(context.Background(), snapshot, c.nodeNames)
+
+	record.PersistentVolumeClaims = snapshot.claims
+	pvs := map[string]*v1.PersistentVolume{}
+	for _, nodeName := range c.nodeNames {
+		record.nodeKeys[nodeName] = nil
+		ledger := snapshot.nodeLedger(nodeName)
+		if ledger == nil {
+			entry, exist := snapshot.nodes[nodeName]
+			if !exist || entry.nodeErr != nil {
+				continue
+			}
+			if entry.ledgerErr != nil {
+				record.Nodes = append(record.Nodes, entry.node)
+				record.nodeKeys[nodeName] = []string{"Node/" + nodeName}
+				continue
+			}
+			ledger = entry.ledger
+		}
+		record.Nodes = append(record.Nodes, ledger.Node)
+		record.Pods = append(record.Pods, ledger.Pods...)
+		keys := make([]string, 0, 1+len(ledger.Pods)+len(ledger.LocalPVs))
+		keys = append(keys, "Node/"+nodeName)
+		for _, pod := range ledger.Pods {
+			key, _ := recordKey(pod)
+			keys = append(keys, key)
+		}
+		for _, pv := range ledger.LocalPVs {
+			pvs[pv.Name] = pv
+			keys = append(keys, "PersistentVolume/"+pv.Name)
+		}
+		record.nodeKeys[nodeName] = keys
+	}
+	for _, pv := range pvs {
+		record.PersistentVolumes = append(record.PersistentVolumes, pv)
+	}
+	sort.Slice(record.PersistentVolumes, func(i, j int) bool { return record.PersistentVolumes[i].Name < record.PersistentVolumes[j].Name })
+
+	record.Digest = record.digest()
+	return record
+}
+
+// filterRecorder writes the filter records as JSON lines to a file rotated by size, in background.
+// Once the file would exceed maxBytes, it is renamed with the suffix .1, the older ones shifted up to maxBackups.
+type filterRecorder struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+
+	calls chan *filterCall
+	file  *os.File
+	size  int64
+
+	// the resource versions of the objects written to the file by key, and the keys written of each node,
+	// reset once the file is opened, so that each file is replayed on its own
+	versions map[string]string
+	nodeKeys map[string][]string
+}
+
+func newFilterRecorder(path string, maxBytes int64, maxBackups int) (*filterRecorder, error) {
+	r := &filterRecorder{
+		path:       path,
+		maxBytes:   maxBytes,
+		maxBackups: maxBackups,
+		calls:      make(chan *filterCall, filterRecordQueueSize),
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *filterRecorder) open() error {
+	// the pods of the args may have secrets in their env
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("fail to open filter record file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("fail to stat filter record file: %w", err)
+	}
+	r.file, r.size = file, info.Size()
+	r.versions, r.nodeKeys = nil, nil
+	return nil
+}
+
+// record queues the filter call predicated by the handler against the snapshot, or drops it if the queue is full,
+// without blocking nor reading the informer caches. It is a no-op on a nil recorder.
+func (r *filterRecorder) record(h *PredicateHandler, args *api.ExtenderArgs, nodeNames []string, result *api.ExtenderFilterResult, snapshot *filterSnapshot) {
+	if r == nil {
+		return
+	}
+	call := &filterCall{time: time.Now(), handler: h, args: args, nodeNames: nodeNames, result: result, snapshot: snapshot}
+	select {
+	case r.calls <- call:
+	default:
+		metrics.FilterRecordsDropped.Inc()
+	}
+}
+
+// Run collects the objects of the queued calls and writes their records until stopped,
+// then writes the remaining ones and closes the file.
+func (r *filterRecorder) Run(stopCh <-chan struct{}) {
+	defer r.file.Close()
+	for {
+		select {
+		case call := <-r.calls:
+			r.write(call.collect())
+		case <-stopCh:
+			for {
+				select {
+				case call := <-r.calls:
+					r.write(call.collect())
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// delta returns the record with only the objects not written to the file yet or changed since,
+// and the keys of the objects written before but no longer read by the call in Removed.
+// All the objects are kept for the first record of the file.
+func (r *filterRecorder) delta(record *FilterRecord) *FilterRecord {
+	delta := &FilterRecord{Time: record.Time, Args: record.Args, Result: record.Result, Digest: record.Digest}
+	if r.versions == nil {
+		r.versions, r.nodeKeys = map[string]string{}, map[string][]string{}
+		delta.Reset = true
+	}
+
+	removed := sets.NewString(claimKeys(record.Args.Pod)...)
+	for nodeName, keys := range record.nodeKeys {
+		removed.Insert(r.nodeKeys[nodeName]...)
+		if keys == nil {
+			delete(r.nodeKeys, nodeName)
+		} else {
+			r.nodeKeys[nodeName] = keys
+		}
+	}
+	changed := func(obj runtime.Object) bool {
+		key, resourceVersion := recordKey(obj)
+		removed.Delete(key)
+		if written, exist := r.versions[key]; exist && written == resourceVersion {
+			return false
+		}
+		r.versions[key] = resourceVersion
+		return true
+	}
+	for _, node := range record.Nodes {
+		if changed(node) {
+			delta.Nodes = append(delta.Nodes, node)
+		}
+	}
+	for _, pod := range record.Pods {
+		if changed(pod) {
+			delta.Pods = append(delta.Pods, pod)
+		}
+	}
+	for _, pv := range record.PersistentVolumes {
+		if changed(pv) {
+			delta.PersistentVolumes = append(delta.PersistentVolumes, pv)
+		}
+	}
+	for _, pvc := range record.PersistentVolumeClaims {
+		if changed(pvc) {
+			delta.PersistentVolumeClaims = append(delta.PersistentVolumeClaims, pvc)
+		}
+	}
+	for _, key := range removed.List() {
+		if _, exist := r.versions[key]; exist {
+			delta.Removed = append(delta.Removed, key)
+			delete(r.versions, key)
+		}
+	}
+	return delta
+}
+
+func (r *filterRecorder) write(record *FilterRecord) {
+	data, err := r.encode(record)
+	if err != nil {
+		glog.Errorf("Fail to encode filter record of pod %s: %s", record.Args.Pod.Name, err)
+		return
+	}
+
+	if r.size > 0 && r.size+int64(len(data)) > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			glog.Errorf("Fail to rotate filter record file %s: %s", r.path, err)
+		}
+		// the first record of the new file carries all its objects
+		if data, err = r.encode(record); err != nil {
+			glog.Errorf("Fail to encode filter record of pod %s: %s", record.Args.Pod.Name, err)
+			return
+		}
+	}
+	n, err := r.file.Write(data)
+	r.size += int64(n)
+	if err != nil {
+		glog.Errorf("Fail to write filter record file %s: %s", r.path, err)
+	}
+}
+
+// encode returns the JSON line of the delta of the record.
+func (r *filterRecorder) encode(record *FilterRecord) ([]byte, error) {
+	data, err := json.Marshal(r.delta(record))
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func (r *filterRecorder) rotate() error {
+	if err := r.file.Close(); err != nil {
+		glog.Errorf("Fail to close filter record file %s: %s", r.path, err)
+	}
+	if r.maxBackups > 0 {
+		for i := r.maxBackups - 1; i > 0; i-- {
+			if err := os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+// ReadFilterRecords reads the records of the files in order, such as the rotated files from the oldest one.
+func ReadFilterRecords(paths []string) ([]*FilterRecord, error) {
+	records := []*FilterRecord{}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(file)
+		// the first record of a file has the objects of all its nodes
+		scanner.Buffer(make([]byte, 1024*1024), 1024*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+			record := &FilterRecord{}
+			if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+				file.Close()
+				return nil, fmt.Errorf("fail to decode filter record at %s:%d: %s", path, line, err)
+			}
+			if record.Args == nil || record.Args.Pod == nil {
+				file.Close()
+				return nil, fmt.Errorf("filter record at %s:%d has no pod", path, line)
+			}
+			records = append(records, record)
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("fail to read %s: %s", path, err)
+		}
+	}
+	return records, nil
+}
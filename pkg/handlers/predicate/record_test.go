@@ -0,0 +1,393 @@
+package predicate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/kubernetes/pkg/scheduler/api"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+)
+
+func TestFilterRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filter-record")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	node := buildNode(t, "node1", "4", "10G")
+	accessor, err := newMemoryAccessor([]runtime.Object{node})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	handler := &PredicateHandler{cfg: opts, accessor: accessor}
+
+	// each record exceeds the size, so that the file is rotated on each write, keeping one backup
+	path := filepath.Join(dir, "records.jsonl")
+	recorder, err := newFilterRecorder(path, 1, 1)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	for _, name := range []string{"pod1", "pod2", "pod3"} {
+		pod := buildPod(t, "test", name, []string{}, []string{"1"}, []string{"1G"})
+		args := &api.ExtenderArgs{Pod: pod, NodeNames: &[]string{node.Name}}
+		result, snapshot, err := handler.predicate(context.Background(), *args.NodeNames, pod)
+		if err != nil {
+			t.Fatalf("unexpected err: %s", err)
+		}
+		recorder.record(handler, args, *args.NodeNames, result.ExtenderFilterResult, snapshot)
+	}
+	stopCh := make(chan struct{})
+	close(stopCh)
+	recorder.Run(stopCh)
+
+	if _, err := os.Stat(path + ".2"); !os.IsNotExist(err) {
+		t.Fatalf("expecting no more than one backup, got %v", err)
+	}
+	records, err := ReadFilterRecords([]string{path + ".1", path})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	pods := []string{}
+	for _, record := range records {
+		pods = append(pods, record.Args.Pod.Name)
+		if len(record.Nodes) != 1 || record.Nodes[0].Name != node.Name {
+			t.Fatalf("expecting node %s recorded, got %v", node.Name, record.Nodes)
+		}
+		if record.Digest != records[0].Digest {
+			t.Fatalf("expecting the same digest of the same objects, got %s and %s", record.Digest, records[0].Digest)
+		}
+	}
+	if !reflect.DeepEqual(pods, []string{"pod2", "pod3"}) {
+		t.Fatalf("expecting the records of pod2 and pod3 kept, got %v", pods)
+	}
+
+	// the records read back are replayed against their objects
+	report, err := Replay(opts, records, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(report.Diffs) != 0 {
+		t.Fatalf("expecting the same decisions replayed, got %+v", report.Diffs)
+	}
+}
+
+func TestFilterRecorderDelta(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filter-record")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	node := buildNode(t, "node1", "4", "10G")
+	cpu := "2"
+	pv := buildPV("pv1", &node.Name, &cpu, nil)
+	pv.ResourceVersion = "1"
+	pvc := buildPVC("test", "pvc1")
+	bind(pv, pvc)
+	existing := buildPod(t, "test", "existing", []string{}, []string{"1"}, []string{"1G"})
+	bindNode(existing, node.Name)
+	unreserved := pv.DeepCopy()
+	unreserved.ResourceVersion = "2"
+	delete(unreserved.Annotations, CPU_KEY)
+
+	path := filepath.Join(dir, "records.jsonl")
+	recorder, err := newFilterRecorder(path, 1024*1024, 0)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	// the existing pod leaves no room for the pod until it is deleted
+	for i, objects := range [][]runtime.Object{
+		{node, pv, pvc, existing},
+		{node, pv, pvc, existing},
+		{node, pv, pvc},
+		{node, unreserved, pvc},
+	} {
+		accessor, err := newMemoryAccessor(objects)
+		if err != nil {
+			t.Fatalf("unexpected err: %s", err)
+		}
+		handler := &PredicateHandler{cfg: opts, accessor: accessor}
+		pod := buildPod(t, "test", fmt.Sprintf("pod%d", i), []string{}, []string{"2"}, []string{"1G"})
+		args := &api.ExtenderArgs{Pod: pod, NodeNames: &[]string{node.Name}}
+		result, snapshot, err := handler.predicate(context.Background(), *args.NodeNames, pod)
+		if err != nil {
+			t.Fatalf("unexpected err: %s", err)
+		}
+		recorder.record(handler, args, *args.NodeNames, result.ExtenderFilterResult, snapshot)
+	}
+	stopCh := make(chan struct{})
+	close(stopCh)
+	recorder.Run(stopCh)
+
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("expecting the record file only accessible by the owner, got %v, %v", info, err)
+	}
+	records, err := ReadFilterRecords([]string{path})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("expecting 4 records, got %d", len(records))
+	}
+	if first := records[0]; !first.Reset || len(first.Nodes) != 1 || len(first.Pods) != 1 || len(first.PersistentVolumes) != 1 {
+		t.Fatalf("expecting all the objects in the first record, got %+v", first)
+	}
+	if same := records[1]; same.Reset || len(same.objects()) != 0 || len(same.Removed) != 0 || same.Digest != records[0].Digest {
+		t.Fatalf("expecting no object in the record of the same state, got %+v", same)
+	}
+	if deleted := records[2]; len(deleted.objects()) != 0 || !reflect.DeepEqual(deleted.Removed, []string{"Pod/test/existing"}) {
+		t.Fatalf("expecting the existing pod removed, got %+v", deleted)
+	}
+	if changed := records[3]; len(changed.objects()) != 1 || len(changed.PersistentVolumes) != 1 || changed.PersistentVolumes[0].ResourceVersion != "2" {
+		t.Fatalf("expecting only the changed pv recorded, got %+v", changed)
+	}
+	if len(*records[0].Result.NodeNames) != 0 || len(*records[2].Result.NodeNames) != 1 {
+		t.Fatalf("expecting the pod fit only once the existing pod is deleted, got %+v and %+v", records[0].Result, records[2].Result)
+	}
+
+	// the state of each call is rebuilt from the records before it
+	report, err := Replay(opts, records, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(report.Diffs) != 0 {
+		t.Fatalf("expecting the same decisions replayed, got %+v", report.Diffs)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	node1 := buildNode(t, "node1", "4", "10G")
+	node2 := buildNode(t, "node2", "4", "10G")
+	cpu := "2"
+	pv := buildPV("pv1", &node1.Name, &cpu, nil)
+	pv.ResourceVersion = "1"
+	pvc := buildPVC("test", "pvc1")
+	bind(pv, pvc)
+	objects := []runtime.Object{node1, node2, pv, pvc}
+
+	accessor, err := newMemoryAccessor(objects)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	handler := &PredicateHandler{cfg: opts, accessor: accessor}
+	pod := buildPod(t, "test", "plain", []string{}, []string{"3"}, []string{"1G"})
+	nodeNames := []string{node1.Name, node2.Name}
+	result, snapshot, err := handler.predicate(context.Background(), nodeNames, pod)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	args := &api.ExtenderArgs{Pod: pod, NodeNames: &nodeNames}
+	record := (&filterCall{handler: handler, args: args, nodeNames: nodeNames, result: result.ExtenderFilterResult, snapshot: snapshot}).collect()
+	if len(record.PersistentVolumes) != 1 || record.PersistentVolumes[0].Name != pv.Name {
+		t.Fatalf("expecting pv %s recorded, got %v", pv.Name, record.PersistentVolumes)
+	}
+	records := []*FilterRecord{record}
+
+	report, err := Replay(opts, records, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(report.Diffs) != 0 || report.Records != 1 {
+		t.Fatalf("expecting the same decisions replayed, got %+v", report)
+	}
+
+	// the reservation is not read with another annotation key
+	changed := &config.OptionConfig{ReservedCpuAnnoKey: "other-cpu", ReservedMemAnnoKey: MEM_KEY}
+	report, err = Replay(changed, records, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	expected := []ReplayDiff{{
+		Pod:      "test/plain",
+		Node:     node1.Name,
+		Recorded: "unfit: cpu not enough after reserving for local persistent volume",
+		Replayed: "fit",
+	}}
+	if !reflect.DeepEqual(report.Diffs, expected) {
+		t.Fatalf("expecting %+v, got %+v", expected, report.Diffs)
+	}
+
+	// the reservation is removed in the live state
+	updated := pv.DeepCopy()
+	updated.ResourceVersion = "2"
+	delete(updated.Annotations, CPU_KEY)
+	report, err = Replay(opts, records, []runtime.Object{node1, node2, updated, pvc})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if report.StateChanged != 1 || !reflect.DeepEqual(report.Diffs, expected) {
+		t.Fatalf("expecting the state changed with diffs %+v, got %+v", expected, report)
+	}
+}
+
+// countingAccessor counts the reads of the informer caches.
+type countingAccessor struct {
+	resourceAccessor
+	reads int32
+}
+
+func (a *countingAccessor) read() {
+	atomic.AddInt32(&a.reads, 1)
+}
+
+func (a *countingAccessor) GetAllPods() ([]*v1.Pod, error) {
+	a.read()
+	return a.resourceAccessor.GetAllPods()
+}
+
+func (a *countingAccessor) GetPodsInNamespace(namespace string) ([]*v1.Pod, error) {
+	a.read()
+	return a.resourceAccessor.GetPodsInNamespace(namespace)
+}
+
+func (a *countingAccessor) GetPodsOnNode(nodeName string) ([]*v1.Pod, error) {
+	a.read()
+	return a.resourceAccessor.GetPodsOnNode(nodeName)
+}
+
+func (a *countingAccessor) GetPodsUsingClaim(namespace, claimName string) ([]*v1.Pod, error) {
+	a.read()
+	return a.resourceAccessor.GetPodsUsingClaim(namespace, claimName)
+}
+
+func (a *countingAccessor) GetPersistentVolume(name string) (*v1.PersistentVolume, error) {
+	a.read()
+	return a.resourceAccessor.GetPersistentVolume(name)
+}
+
+func (a *countingAccessor) GetAllPersistentVolume() ([]*v1.PersistentVolume, error) {
+	a.read()
+	return a.resourceAccessor.GetAllPersistentVolume()
+}
+
+func (a *countingAccessor) GetLocalPersistentVolumesOnNode(nodeName string) ([]*v1.PersistentVolume, error) {
+	a.read()
+	return a.resourceAccessor.GetLocalPersistentVolumesOnNode(nodeName)
+}
+
+func (a *countingAccessor) GetPersistentVolumeClaim(namespace, name string) (*v1.PersistentVolumeClaim, error) {
+	a.read()
+	return a.resourceAccessor.GetPersistentVolumeClaim(namespace, name)
+}
+
+func (a *countingAccessor) GetNode(name string) (*v1.Node, error) {
+	a.read()
+	return a.resourceAccessor.GetNode(name)
+}
+
+func (a *countingAccessor) GetAllNodes() ([]*v1.Node, error) {
+	a.read()
+	return a.resourceAccessor.GetAllNodes()
+}
+
+func (a *countingAccessor) HasSynced() bool {
+	return true
+}
+
+func TestRecordWithoutReads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filter-record")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	node1 := buildNode(t, "node1", "4", "10G")
+	node2 := buildNode(t, "node2", "4", "10G")
+	cpu := "2"
+	pv := buildPV("pv1", &node1.Name, &cpu, nil)
+	pvc := buildPVC("test", "pvc1")
+	bind(pv, pvc)
+	memory, err := newMemoryAccessor([]runtime.Object{node1, node2, pv, pvc})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	ledger := newLedger(memory, opts)
+	ledger.resync()
+	accessor := &countingAccessor{resourceAccessor: memory}
+	handler := &PredicateHandler{cfg: opts, accessor: accessor, ledger: ledger}
+
+	pod := buildPod(t, "test", "mounting", []string{pvc.Name}, []string{"3"}, []string{"1G"})
+	body, err := json.Marshal(&api.ExtenderArgs{Pod: pod, NodeNames: &[]string{node1.Name, node2.Name}})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	filter := func(recorder *filterRecorder) int32 {
+		atomic.StoreInt32(&accessor.reads, 0)
+		w := httptest.NewRecorder()
+		handler.handle(w, httptest.NewRequest("POST", "/", bytes.NewReader(body)), nil, recorder)
+		if w.Code != 200 {
+			t.Fatalf("unexpected response %d: %s", w.Code, w.Body.String())
+		}
+		return atomic.LoadInt32(&accessor.reads)
+	}
+
+	recorder, err := newFilterRecorder(filepath.Join(dir, "records.jsonl"), 1024*1024, 0)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if withoutRecorder, withRecorder := filter(nil), filter(recorder); withRecorder != withoutRecorder {
+		t.Fatalf("expecting no read added by recording, got %d reads without recording and %d with", withoutRecorder, withRecorder)
+	}
+
+	// the objects are collected from the snapshot of the call, not from the state changed since
+	updated := pv.DeepCopy()
+	delete(updated.Annotations, CPU_KEY)
+	if _, err := memory.UpdatePersistentVolume(updated); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	atomic.StoreInt32(&accessor.reads, 0)
+	stopCh := make(chan struct{})
+	close(stopCh)
+	recorder.Run(stopCh)
+	if reads := atomic.LoadInt32(&accessor.reads); reads != 0 {
+		t.Fatalf("expecting the objects collected from the snapshot, got %d reads", reads)
+	}
+
+	records, err := ReadFilterRecords([]string{filepath.Join(dir, "records.jsonl")})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(records) != 1 || len(records[0].Nodes) != 2 || len(records[0].PersistentVolumeClaims) != 1 ||
+		len(records[0].PersistentVolumes) != 1 || records[0].PersistentVolumes[0].Annotations[CPU_KEY] != cpu {
+		t.Fatalf("expecting the objects of the snapshot recorded, got %+v", records)
+	}
+	report, err := Replay(opts, records, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(report.Diffs) != 0 {
+		t.Fatalf("expecting the same decisions replayed, got %+v", report.Diffs)
+	}
+}
+
+func TestFilterDecisions(t *testing.T) {
+	nodeNames := []string{"node1", "node2", "node3"}
+	result := &api.ExtenderFilterResult{
+		NodeNames:   &[]string{"node1"},
+		FailedNodes: api.FailedNodesMap{"node2": "reason"},
+	}
+	if decisions := filterDecisions(result, nodeNames); !reflect.DeepEqual(decisions, []string{"fit", "unfit: reason", "none"}) {
+		t.Fatalf("unexpected decisions %v", decisions)
+	}
+	if decisions := filterDecisions(&api.ExtenderFilterResult{Error: "timeout"}, nodeNames[:1]); !reflect.DeepEqual(decisions, []string{"error: timeout"}) {
+		t.Fatalf("unexpected decisions %v", decisions)
+	}
+	nodes := &v1.NodeList{Items: []v1.Node{{}}}
+	nodes.Items[0].Name = "node3"
+	if decisions := filterDecisions(&api.ExtenderFilterResult{Nodes: nodes}, nodeNames); !reflect.DeepEqual(decisions, []string{"none", "none", "fit"}) {
+		t.Fatalf("unexpected decisions %v", decisions)
+	}
+}
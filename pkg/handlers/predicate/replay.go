@@ -0,0 +1,148 @@
+package predicate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/kubernetes/pkg/scheduler/api"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+)
+
+// ReplayFormats are the formats a replay report is written in.
+var ReplayFormats = []string{"table", "json"}
+
+// ReplayDiff is a node whose decision on replay differs from the recorded one.
+// A decision is "fit", "unfit: <reason>" or "error: <error>".
+type ReplayDiff struct {
+	Time     time.Time `json:"time"`
+	Pod      string    `json:"pod"`
+	Node     string    `json:"node"`
+	Recorded string    `json:"recorded"`
+	Replayed string    `json:"replayed"`
+}
+
+// ReplayReport is the decisions differing on replay, in the order of the records and their nodes.
+type ReplayReport struct {
+	Records int `json:"records"`
+	// the records whose objects differ in the live state, on replay against it
+	StateChanged int          `json:"stateChanged"`
+	Diffs        []ReplayDiff `json:"diffs"`
+}
+
+// Replay predicates the recorded filter calls again with the options, and diffs the decisions with the recorded ones.
+// Each call is replayed against the objects rebuilt from the records in order, or against the cluster made of the live objects if not nil.
+func Replay(options *config.OptionConfig, records []*FilterRecord, live []runtime.Object) (*ReplayReport, error) {
+	var liveHandler *PredicateHandler
+	if live != nil {
+		accessor, err := newMemoryAccessor(live)
+		if err != nil {
+			return nil, err
+		}
+		liveHandler = &PredicateHandler{cfg: options, accessor: accessor}
+	}
+
+	report := &ReplayReport{Records: len(records), Diffs: []ReplayDiff{}}
+	// the objects of each record are rebuilt from the records before it
+	state := recordState{}
+	for _, record := range records {
+		state = state.apply(record)
+		handler := liveHandler
+		if handler == nil {
+			accessor, err := newMemoryAccessor(state.objects())
+			if err != nil {
+				return nil, fmt.Errorf("fail to load objects of the record at %s: %w", record.Time, err)
+			}
+			handler = &PredicateHandler{cfg: options, accessor: accessor}
+		}
+
+		pod := record.Args.Pod
+		nodeNames, _, _ := getNodeNames(record.Args)
+		if liveHandler != nil {
+			current := (&filterCall{handler: handler, args: record.Args, nodeNames: nodeNames}).collect()
+			if current.Digest != record.Digest {
+				report.StateChanged++
+			}
+		}
+
+		var replayed *api.ExtenderFilterResult
+		if result, _, err := handler.predicate(context.Background(), nodeNames, pod); err != nil {
+			replayed = &api.ExtenderFilterResult{Error: err.Error()}
+		} else {
+			replayed = result.ExtenderFilterResult
+		}
+
+		recordedDecisions, replayedDecisions := filterDecisions(record.Result, nodeNames), filterDecisions(replayed, nodeNames)
+		for i, nodeName := range nodeNames {
+			if recordedDecisions[i] != replayedDecisions[i] {
+				report.Diffs = append(report.Diffs, ReplayDiff{
+					Time:     record.Time,
+					Pod:      pod.Namespace + "/" + pod.Name,
+					Node:     nodeName,
+					Recorded: recordedDecisions[i],
+					Replayed: replayedDecisions[i],
+				})
+			}
+		}
+	}
+	return report, nil
+}
+
+// filterDecisions returns the decision of each node in the result, or "none" if the result misses the node.
+func filterDecisions(result *api.ExtenderFilterResult, nodeNames []string) []string {
+	decisions := make([]string, len(nodeNames))
+	if result == nil {
+		result = &api.ExtenderFilterResult{}
+	}
+	fit := map[string]bool{}
+	if result.NodeNames != nil {
+		for _, nodeName := range *result.NodeNames {
+			fit[nodeName] = true
+		}
+	} else if result.Nodes != nil {
+		for _, node := range result.Nodes.Items {
+			fit[node.Name] = true
+		}
+	}
+
+	for i, nodeName := range nodeNames {
+		if len(result.Error) > 0 {
+			decisions[i] = "error: " + result.Error
+		} else if fit[nodeName] {
+			decisions[i] = "fit"
+		} else if reason, failed := result.FailedNodes[nodeName]; failed {
+			decisions[i] = "unfit: " + reason
+		} else {
+			decisions[i] = "none"
+		}
+	}
+	return decisions
+}
+
+// WriteReplayReport writes the report in one of ReplayFormats.
+func WriteReplayReport(w io.Writer, report *ReplayReport, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "TIME\tPOD\tNODE\tRECORDED\tREPLAYED")
+		for _, diff := range report.Diffs {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", diff.Time.Format(time.RFC3339), diff.Pod, diff.Node, diff.Recorded, diff.Replayed)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(w, "%d records replayed, %d decisions differ, %d records with changed state\n", report.Records, len(report.Diffs), report.StateChanged)
+		return err
+	default:
+		return fmt.Errorf("unknown format %s, should be one of %v", format, ReplayFormats)
+	}
+}
@@ -0,0 +1,41 @@
+package predicate
+
+import (
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+)
+
+// NodeReservation describes how the allocatable resources of a node are split
+// between the reservation of its local persistent volumes and everything else.
+type NodeReservation struct {
+	// resources still reserved by the local PVs on the node
+	ReservedCpu resource.Quantity `json:"reservedCpu"`
+	ReservedMem resource.Quantity `json:"reservedMem"`
+
+	// resources left for pods using no reserved local PV,
+	// after subtracting requests of running pods and the reservation
+	UnreservedCpu resource.Quantity `json:"unreservedCpu"`
+	UnreservedMem resource.Quantity `json:"unreservedMem"`
+}
+
+// ReservationCalculator computes the reservation of a node with the same logic as the predicate.
+type ReservationCalculator interface {
+	NodeReservation(node *v1.Node) (*NodeReservation, error)
+}
+
+// NewReservationCalculator returns a calculator which also implements pkg.Reloadable.
+func NewReservationCalculator(cfg *config.Config) (ReservationCalculator, error) {
+	return newReloadableHandler(cfg)
+}
+
+func (h *PredicateHandler) NodeReservation(node *v1.Node) (*NodeReservation, error) {
+	ledger, err := h.nodeLedger(h.ledgerSnapshot(), node)
+	if err != nil {
+		return nil, err
+	}
+
+	reservation := ledger.NodeReservation
+	return &reservation, nil
+}
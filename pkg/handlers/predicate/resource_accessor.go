@@ -1,138 +1,272 @@
 package predicate
 
 import (
+	"fmt"
+	"sync"
+
 	"k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	listerv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 
 	"github.com/wu8685/lpv-res-predicate/pkg/config"
 )
 
-type NoExist struct {
-}
-
-func (ne *NoExist) Error() string {
-	return "not exist"
-}
-
 type resourceAccessor interface {
 	GetAllPods() ([]*v1.Pod, error)
 	GetPodsInNamespace(namespace string) ([]*v1.Pod, error)
+	GetPodsOnNode(nodeName string) ([]*v1.Pod, error)
+	// returns the pods mounting the PVC
+	GetPodsUsingClaim(namespace, claimName string) ([]*v1.Pod, error)
 	GetPersistentVolume(name string) (*v1.PersistentVolume, error)
 	GetAllPersistentVolume() ([]*v1.PersistentVolume, error)
+	// returns the local PVs whose NodeAffinity matches the node
+	GetLocalPersistentVolumesOnNode(nodeName string) ([]*v1.PersistentVolume, error)
 	GetPersistentVolumeClaim(namespace, name string) (*v1.PersistentVolumeClaim, error)
 	GetNode(name string) (*v1.Node, error)
+	GetAllNodes() ([]*v1.Node, error)
 
 	UpdatePersistentVolume(volume *v1.PersistentVolume) (*v1.PersistentVolume, error)
+
+	HasSynced() bool
 }
 
+// the indexes of the pod informer
+const (
+	podNodeNameIndex = "nodeName"
+	podClaimIndex    = "claim"
+)
+
+// ResourceAccessor reads objects from the informer caches, returning a *ResourceError on failure.
 type ResourceAccessor struct {
 	cfg        *config.Config
 	nodeLister listerv1.NodeLister
 	pvLister   listerv1.PersistentVolumeLister
 	pvcLister  listerv1.PersistentVolumeClaimLister
 	podLister  listerv1.PodLister
+	podIndexer cache.Indexer
+
+	nodeSynced cache.InformerSynced
+	pvSynced   cache.InformerSynced
+	pvcSynced  cache.InformerSynced
+	podSynced  cache.InformerSynced
+
+	localPVs *localPVIndex
+	// whether the local PV index has processed the PVs and nodes listed on start
+	pvIndexSynced   cache.InformerSynced
+	nodeIndexSynced cache.InformerSynced
 }
 
-func NewResourceAccessor(cfg *config.Config) *ResourceAccessor {
+var (
+	sharedAccessorsLock sync.Mutex
+	sharedAccessors     = map[*config.Config]*ResourceAccessor{}
+)
+
+// sharedResourceAccessor returns the accessor shared by the handlers and controllers of the same config,
+// so that the informer event handlers maintaining the indexes are registered only once.
+func sharedResourceAccessor(cfg *config.Config) (*ResourceAccessor, error) {
+	sharedAccessorsLock.Lock()
+	defer sharedAccessorsLock.Unlock()
+
+	if accessor, exist := sharedAccessors[cfg]; exist {
+		return accessor, nil
+	}
+	accessor, err := NewResourceAccessor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sharedAccessors[cfg] = accessor
+	return accessor, nil
+}
+
+// NewResourceAccessor returns an error if the pod indexers can not be added,
+// e.g. the pod informer is already started.
+func NewResourceAccessor(cfg *config.Config) (*ResourceAccessor, error) {
+	nodeInformer := cfg.InformerFactory.Core().V1().Nodes()
+	pvInformer := cfg.InformerFactory.Core().V1().PersistentVolumes()
+	pvcInformer := cfg.InformerFactory.Core().V1().PersistentVolumeClaims()
+	podInformer := cfg.InformerFactory.Core().V1().Pods()
 	accessor := &ResourceAccessor{
 		cfg:        cfg,
-		nodeLister: cfg.InformerFactory.Core().V1().Nodes().Lister(),
-		pvLister:   cfg.InformerFactory.Core().V1().PersistentVolumes().Lister(),
-		pvcLister:  cfg.InformerFactory.Core().V1().PersistentVolumeClaims().Lister(),
-		podLister:  cfg.InformerFactory.Core().V1().Pods().Lister(),
+		nodeLister: nodeInformer.Lister(),
+		pvLister:   pvInformer.Lister(),
+		pvcLister:  pvcInformer.Lister(),
+		podLister:  podInformer.Lister(),
+		podIndexer: podInformer.Informer().GetIndexer(),
+
+		nodeSynced: nodeInformer.Informer().HasSynced,
+		pvSynced:   pvInformer.Informer().HasSynced,
+		pvcSynced:  pvcInformer.Informer().HasSynced,
+		podSynced:  podInformer.Informer().HasSynced,
+
+		localPVs: newLocalPVIndex(),
 	}
+	// indexers can only be added before the informer is started
+	if err := podInformer.Informer().AddIndexers(cache.Indexers{
+		podNodeNameIndex: indexPodByNodeName,
+		podClaimIndex:    indexPodByClaim,
+	}); err != nil {
+		return nil, fmt.Errorf("fail to add pod indexers: %s", err)
+	}
+	pvIndexSync := newHandlerSync(pvInformer.Informer())
+	nodeIndexSync := newHandlerSync(nodeInformer.Informer())
+	accessor.pvIndexSynced = pvIndexSync.HasSynced
+	accessor.nodeIndexSynced = nodeIndexSync.HasSynced
+	pvInformer.Informer().AddEventHandler(pvIndexSync.wrap(accessor.localPVs.pvHandler()))
+	nodeInformer.Informer().AddEventHandler(nodeIndexSync.wrap(accessor.localPVs.nodeHandler()))
 
-	return accessor
+	return accessor, nil
 }
 
 func (a *ResourceAccessor) GetAllPods() ([]*v1.Pod, error) {
+	if !a.podSynced() {
+		return nil, newNotSyncedError("pod", "")
+	}
+
 	pods, err := a.podLister.List(labels.Everything())
 	if err != nil {
-		return pods, err
+		return nil, newResourceError("pod", "", err)
+	}
+	return pods, nil
+}
+
+func (a *ResourceAccessor) GetPodsInNamespace(namespace string) ([]*v1.Pod, error) {
+	if !a.podSynced() {
+		return nil, newNotSyncedError("pod", namespace+"/")
 	}
 
-	if pods == nil {
-		return pods, &NoExist{}
+	pods, err := a.podLister.Pods(namespace).List(labels.Everything())
+	if err != nil {
+		return nil, newResourceError("pod", namespace+"/", err)
 	}
+	return pods, nil
+}
 
-	return pods, err
+func (a *ResourceAccessor) GetPodsOnNode(nodeName string) ([]*v1.Pod, error) {
+	return a.podsByIndex(podNodeNameIndex, nodeName)
 }
 
-func (a *ResourceAccessor) GetPodsInNamespace(namespace string) ([]*v1.Pod, error) {
-	pod, err := a.podLister.Pods(namespace).List(labels.Everything())
-	if err != nil {
-		return pod, err
+func (a *ResourceAccessor) GetPodsUsingClaim(namespace, claimName string) ([]*v1.Pod, error) {
+	return a.podsByIndex(podClaimIndex, namespace+"/"+claimName)
+}
+
+func (a *ResourceAccessor) podsByIndex(indexName, key string) ([]*v1.Pod, error) {
+	if !a.podSynced() {
+		return nil, newNotSyncedError("pod", key)
 	}
 
-	if pod == nil {
-		return pod, &NoExist{}
+	objs, err := a.podIndexer.ByIndex(indexName, key)
+	if err != nil {
+		return nil, newResourceError("pod", key, err)
 	}
 
-	return pod, err
+	pods := make([]*v1.Pod, 0, len(objs))
+	for _, obj := range objs {
+		pods = append(pods, obj.(*v1.Pod))
+	}
+	return pods, nil
 }
 
 func (a *ResourceAccessor) GetPersistentVolume(name string) (*v1.PersistentVolume, error) {
-	pv, err := a.pvLister.Get(name)
-	if err != nil {
-		return nil, err
+	if !a.pvSynced() {
+		return nil, newNotSyncedError("persistent volume", name)
 	}
 
-	if pv == nil {
-		return pv, &NoExist{}
+	pv, err := a.pvLister.Get(name)
+	if err != nil {
+		return nil, newResourceError("persistent volume", name, err)
 	}
-
 	return pv, nil
 }
 
 func (a *ResourceAccessor) GetAllPersistentVolume() ([]*v1.PersistentVolume, error) {
+	if !a.pvSynced() {
+		return nil, newNotSyncedError("persistent volume", "")
+	}
+
 	pvs, err := a.pvLister.List(labels.Everything())
 	if err != nil {
-		return pvs, err
+		return nil, newResourceError("persistent volume", "", err)
 	}
+	return pvs, nil
+}
 
-	if pvs == nil {
-		return pvs, &NoExist{}
+func (a *ResourceAccessor) GetLocalPersistentVolumesOnNode(nodeName string) ([]*v1.PersistentVolume, error) {
+	// the index lags behind the informer caches until the event handlers process the listed objects,
+	// reading it before that misses the reserved PVs
+	if !a.pvIndexSynced() || !a.nodeIndexSynced() {
+		return nil, newNotSyncedError("local persistent volume", "on node "+nodeName)
 	}
-
-	return pvs, nil
+	return a.localPVs.PVsOnNode(nodeName), nil
 }
 
 func (a *ResourceAccessor) GetPersistentVolumeClaim(namespace, name string) (*v1.PersistentVolumeClaim, error) {
-	pvc, err := a.pvcLister.PersistentVolumeClaims(namespace).Get(name)
-	if err != nil {
-		return pvc, err
+	key := namespace + "/" + name
+	if !a.pvcSynced() {
+		return nil, newNotSyncedError("persistent volume claim", key)
 	}
 
-	if pvc == nil {
-		return nil, &NoExist{}
+	pvc, err := a.pvcLister.PersistentVolumeClaims(namespace).Get(name)
+	if err != nil {
+		return nil, newResourceError("persistent volume claim", key, err)
 	}
-
-	return pvc, err
+	return pvc, nil
 }
 
 func (a *ResourceAccessor) GetNode(name string) (*v1.Node, error) {
+	if !a.nodeSynced() {
+		return nil, newNotSyncedError("node", name)
+	}
+
 	node, err := a.nodeLister.Get(name)
 	if err != nil {
-		return node, err
+		return nil, newResourceError("node", name, err)
 	}
+	return node, nil
+}
 
-	if node == nil {
-		return node, &NoExist{}
+func (a *ResourceAccessor) GetAllNodes() ([]*v1.Node, error) {
+	if !a.nodeSynced() {
+		return nil, newNotSyncedError("node", "")
 	}
 
-	return node, err
+	nodes, err := a.nodeLister.List(labels.Everything())
+	if err != nil {
+		return nil, newResourceError("node", "", err)
+	}
+	return nodes, nil
 }
 
 func (a *ResourceAccessor) UpdatePersistentVolume(volume *v1.PersistentVolume) (*v1.PersistentVolume, error) {
 	pv, err := a.cfg.Client.CoreV1().PersistentVolumes().Update(volume)
 	if err != nil {
-		return pv, err
+		return nil, newResourceError("persistent volume", volume.Name, err)
+	}
+	return pv, nil
+}
+
+func indexPodByNodeName(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok || len(pod.Spec.NodeName) == 0 {
+		return []string{}, nil
+	}
+	return []string{pod.Spec.NodeName}, nil
+}
+
+func indexPodByClaim(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return []string{}, nil
 	}
 
-	if pv == nil {
-		return pv, &NoExist{}
+	keys := []string{}
+	for _, volume := range getPvcVolumeSources(pod.Spec.Volumes) {
+		keys = append(keys, pod.Namespace+"/"+volume.PersistentVolumeClaim.ClaimName)
 	}
+	return keys, nil
+}
 
-	return pv, err
+// HasSynced returns whether the caches of all the listers and the local PV index are synced.
+func (a *ResourceAccessor) HasSynced() bool {
+	return a.nodeSynced() && a.pvSynced() && a.pvcSynced() && a.podSynced() && a.pvIndexSynced() && a.nodeIndexSynced()
 }
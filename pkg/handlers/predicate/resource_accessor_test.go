@@ -0,0 +1,85 @@
+package predicate
+
+import (
+	"errors"
+	"testing"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+	"github.com/wu8685/lpv-res-predicate/pkg/informers"
+)
+
+func alwaysSynced() bool {
+	return true
+}
+
+func TestNewResourceAccessorIndexerConflict(t *testing.T) {
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: "http://127.0.0.1:0"})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	cfg := &config.Config{
+		Client:          client,
+		InformerFactory: informers.NewInformerFactory(client, 0),
+		Options:         opts,
+	}
+
+	if _, err := NewResourceAccessor(cfg); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	// the pod indexers are already added to the shared informer
+	if _, err := NewResourceAccessor(cfg); err == nil {
+		t.Fatalf("expect the err of the conflicting pod indexers")
+	}
+}
+
+func TestPodIndexers(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		podNodeNameIndex: indexPodByNodeName,
+		podClaimIndex:    indexPodByClaim,
+	})
+	accessor := &ResourceAccessor{
+		podIndexer: indexer,
+		podSynced:  alwaysSynced,
+	}
+
+	pod1 := buildPod(t, "ns1", "pod1", []string{"pvc1", "pvc2"}, []string{"1"}, []string{"1G"})
+	bindNode(pod1, "node1")
+	pod2 := buildPod(t, "ns1", "pod2", []string{"pvc1"}, []string{"1"}, []string{"1G"})
+	bindNode(pod2, "node2")
+	// not scheduled yet
+	pod3 := buildPod(t, "ns2", "pod3", []string{"pvc1"}, []string{"1"}, []string{"1G"})
+	for _, pod := range []interface{}{pod1, pod2, pod3} {
+		indexer.Add(pod)
+	}
+
+	for nodeName, expected := range map[string]int{"node1": 1, "node2": 1, "node3": 0, "": 0} {
+		pods, err := accessor.GetPodsOnNode(nodeName)
+		if err != nil || len(pods) != expected {
+			t.Fatalf("expecting %d pods on node %q, got %v, %v", expected, nodeName, pods, err)
+		}
+	}
+
+	for key, expected := range map[[2]string]int{{"ns1", "pvc1"}: 2, {"ns1", "pvc2"}: 1, {"ns2", "pvc1"}: 1, {"ns2", "pvc2"}: 0} {
+		pods, err := accessor.GetPodsUsingClaim(key[0], key[1])
+		if err != nil || len(pods) != expected {
+			t.Fatalf("expecting %d pods using claim %v, got %v, %v", expected, key, pods, err)
+		}
+	}
+
+	// the index is updated with the pod
+	moved := pod1.DeepCopy()
+	bindNode(moved, "node2")
+	indexer.Update(moved)
+	if pods, _ := accessor.GetPodsOnNode("node2"); len(pods) != 2 {
+		t.Fatalf("expecting 2 pods on node2, got %v", pods)
+	}
+
+	accessor.podSynced = func() bool { return false }
+	if _, err := accessor.GetPodsOnNode("node1"); !errors.Is(err, ErrNotSynced) {
+		t.Fatalf("expecting not synced error, got %v", err)
+	}
+}
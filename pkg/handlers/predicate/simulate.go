@@ -0,0 +1,59 @@
+package predicate
+
+import (
+	"sort"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+)
+
+// NodeDecision is the decision of a pod on a node.
+type NodeDecision struct {
+	Node   string `json:"node"`
+	Fit    bool   `json:"fit"`
+	Reason string `json:"reason,omitempty"`
+	// an internal error predicating the node, such as a missing object
+	Error string `json:"error,omitempty"`
+}
+
+// PodDecisions are the decisions of a pod on the nodes in the order of their names.
+type PodDecisions struct {
+	Pod   string         `json:"pod"`
+	Nodes []NodeDecision `json:"nodes"`
+}
+
+// Simulate predicates each pod on all the nodes of the cluster made of the objects, without an API server.
+// The pods are predicated independently, none of them is taken as scheduled for the others.
+func Simulate(options *config.OptionConfig, objects []runtime.Object, pods []*v1.Pod) ([]PodDecisions, error) {
+	accessor, err := newMemoryAccessor(objects)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := accessor.GetAllNodes()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+
+	handler := &PredicateHandler{cfg: options, accessor: accessor}
+	results := make([]PodDecisions, 0, len(pods))
+	for _, pod := range pods {
+		decisions := PodDecisions{
+			Pod:   pod.Namespace + "/" + pod.Name,
+			Nodes: make([]NodeDecision, 0, len(nodes)),
+		}
+		snapshot := handler.takeSnapshot(pod)
+		for _, node := range nodes {
+			result := handler.predicateNodeInSnapshot(snapshot, node.Name, pod)
+			decision := NodeDecision{Node: node.Name, Fit: result.fit, Reason: result.reason}
+			if result.err != nil {
+				decision.Error = result.err.Error()
+			}
+			decisions.Nodes = append(decisions.Nodes, decision)
+		}
+		results = append(results, decisions)
+	}
+	return results, nil
+}
@@ -0,0 +1,66 @@
+package predicate
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestSimulate(t *testing.T) {
+	node1 := buildNode(t, "node1", "4", "10G")
+	node2 := buildNode(t, "node2", "4", "10G")
+	cpu := "2"
+	pv := buildPV("pv1", &node1.Name, &cpu, nil)
+	pvc := buildPVC("test", "pvc1")
+	bind(pv, pvc)
+
+	running := buildPod(t, "test", "running", []string{pvc.Name}, []string{"1"}, []string{"1G"})
+	bindNode(running, node1.Name)
+	// terminated pods are not taken as consuming resources
+	terminated := buildPod(t, "test", "terminated", []string{}, []string{"4"}, []string{"1G"})
+	bindNode(terminated, node1.Name)
+	terminated.Status.Phase = v1.PodSucceeded
+	objects := []runtime.Object{node2, node1, pv, pvc, running, terminated, &v1.ConfigMap{}}
+
+	mounting := buildPod(t, "test", "mounting", []string{pvc.Name}, []string{"1"}, []string{"1G"})
+	plain := buildPod(t, "test", "plain", []string{}, []string{"3"}, []string{"1G"})
+	results, err := Simulate(opts, objects, []*v1.Pod{mounting, plain})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	expected := []PodDecisions{
+		{
+			Pod: "test/mounting",
+			Nodes: []NodeDecision{
+				{Node: "node1", Fit: true},
+				{Node: "node2", Fit: true},
+			},
+		},
+		{
+			Pod: "test/plain",
+			Nodes: []NodeDecision{
+				{Node: "node1", Reason: "cpu not enough after reserving for local persistent volume"},
+				{Node: "node2", Fit: true},
+			},
+		},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Fatalf("expecting %v, got %v", expected, results)
+	}
+
+	// the reservation is updated in memory
+	accessor, err := newMemoryAccessor(objects)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	updated := pv.DeepCopy()
+	updated.Annotations[CPU_KEY] = "1"
+	if _, err := accessor.UpdatePersistentVolume(updated); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	handler := &PredicateHandler{cfg: opts, accessor: accessor}
+	assert(t).Unfit(handler.predicateOneNode(node1, mounting))
+}
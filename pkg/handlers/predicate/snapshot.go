@@ -0,0 +1,172 @@
+package predicate
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"k8s.io/api/core/v1"
+)
+
+// filterSnapshot holds what a filter call predicates the nodes against, so that each node is predicated
+// against one fixed entry however many workers read it. It is not a consistent view of the cluster:
+// the ledger snapshot, the claims and the nodes computed by snapshotNodes are read from the caches
+// at different moments, and a node missing from all of them is read from the informer caches when predicated.
+type filterSnapshot struct {
+	// nil if the reservation ledger is not built yet or computed with other options,
+	// then each node is computed from the informer caches
+	ledger *ledgerSnapshot
+	// the nodes the ledger snapshot misses, computed from the informer caches by snapshotNodes.
+	// A map is never written once set, snapshotNodes replaces it with a copy holding the new entries.
+	nodes map[string]*snapshotEntry
+
+	// the PVCs of the pod volumes, or the error getting them
+	claims    []*v1.PersistentVolumeClaim
+	claimsErr error
+}
+
+// snapshotEntry is a node computed from the informer caches, with the error getting the node or computing its ledger.
+type snapshotEntry struct {
+	node      *v1.Node
+	nodeErr   error
+	ledger    *nodeLedger
+	ledgerErr error
+}
+
+func (h *PredicateHandler) takeSnapshot(pod *v1.Pod) *filterSnapshot {
+	snapshot := &filterSnapshot{
+		ledger: h.ledgerSnapshot(),
+	}
+	snapshot.claims, snapshot.claimsErr = h.podClaims(pod)
+	return snapshot
+}
+
+// snapshotNodes computes the nodes the ledger snapshot misses, such as before the first full recompute of the ledger,
+// after the options are reloaded or for a node just added, before the nodes are predicated.
+// The nodes are computed in parallel, each worker writing only its own slot, and published as a new map once all are done.
+// It stops once the context is done, since the remaining nodes are given up anyway.
+func (h *PredicateHandler) snapshotNodes(ctx context.Context, snapshot *filterSnapshot, nodeNames []string) {
+	missNodeNames := make([]string, 0, len(nodeNames))
+	seen := make(map[string]bool, len(nodeNames))
+	for _, nodeName := range nodeNames {
+		if seen[nodeName] || snapshot.nodeLedger(nodeName) != nil {
+			continue
+		}
+		if _, exist := snapshot.nodes[nodeName]; exist {
+			continue
+		}
+		seen[nodeName] = true
+		missNodeNames = append(missNodeNames, nodeName)
+	}
+	if len(missNodeNames) == 0 {
+		return
+	}
+
+	entries := make([]*snapshotEntry, len(missNodeNames))
+	parallelize(h.cfg.FilterParallelism, len(missNodeNames), func(piece int) {
+		if ctx.Err() != nil {
+			return
+		}
+		// a panic leaves the slot empty, then the node is computed again when predicated, where the panic is recovered
+		defer func() {
+			recover()
+		}()
+		entry := &snapshotEntry{}
+		if entry.node, entry.nodeErr = h.accessor.GetNode(missNodeNames[piece]); entry.nodeErr == nil {
+			entry.ledger, entry.ledgerErr = h.computeNodeLedger(entry.node)
+		}
+		entries[piece] = entry
+	})
+
+	nodes := make(map[string]*snapshotEntry, len(snapshot.nodes)+len(entries))
+	for nodeName, entry := range snapshot.nodes {
+		nodes[nodeName] = entry
+	}
+	for piece, entry := range entries {
+		// nil if given up or panicked
+		if entry != nil {
+			nodes[missNodeNames[piece]] = entry
+		}
+	}
+	snapshot.nodes = nodes
+}
+
+// snapshotNode returns the node in the snapshot, or from the informer cache if the snapshot misses it.
+func (h *PredicateHandler) snapshotNode(snapshot *filterSnapshot, nodeName string) (*v1.Node, error) {
+	if ledger := snapshot.nodeLedger(nodeName); ledger != nil {
+		return ledger.Node, nil
+	}
+	if entry, exist := snapshot.nodes[nodeName]; exist {
+		return entry.node, entry.nodeErr
+	}
+	return h.accessor.GetNode(nodeName)
+}
+
+// snapshotNodeLedger returns the ledger of the node in the snapshot, or computes it if the snapshot misses the node,
+// such as a node predicated by predicateOneNode.
+func (h *PredicateHandler) snapshotNodeLedger(snapshot *filterSnapshot, node *v1.Node) (*nodeLedger, error) {
+	if ledger := snapshot.nodeLedger(node.Name); ledger != nil {
+		return ledger, nil
+	}
+	if entry, exist := snapshot.nodes[node.Name]; exist && entry.nodeErr == nil {
+		return entry.ledger, entry.ledgerErr
+	}
+	return h.computeNodeLedger(node)
+}
+
+// nodeLedger returns the ledger of the node in the ledger snapshot, or nil if the node is computed from the informer caches.
+func (s *filterSnapshot) nodeLedger(nodeName string) *nodeLedger {
+	if s.ledger == nil {
+		return nil
+	}
+	return s.ledger.nodes[nodeName]
+}
+
+// nodeResult is the result of predicating a node, written only by the worker predicating it.
+type nodeResult struct {
+	// false if the node is given up after the deadline
+	predicated bool
+	fit        bool
+	reason     string
+	// an internal error, answered by the failure policy
+	err error
+}
+
+// parallelize calls do with each piece in [0, pieces) from at most workers goroutines, and returns once all are done.
+func parallelize(workers, pieces int, do func(piece int)) {
+	if workers > pieces {
+		workers = pieces
+	}
+	if workers <= 1 {
+		for piece := 0; piece < pieces; piece++ {
+			do(piece)
+		}
+		return
+	}
+
+	toDo := make(chan int, pieces)
+	for piece := 0; piece < pieces; piece++ {
+		toDo <- piece
+	}
+	close(toDo)
+
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for piece := range toDo {
+				do(piece)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// recoverNodeResult turns a panic predicating a node into an internal error of the node,
+// since the recovery middleware does not cover the workers.
+func recoverNodeResult(result *nodeResult) {
+	if r := recover(); r != nil {
+		*result = nodeResult{predicated: true, err: fmt.Errorf("panic: %v", r)}
+	}
+}
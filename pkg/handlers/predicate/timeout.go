@@ -0,0 +1,48 @@
+package predicate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/glog"
+	"k8s.io/kubernetes/pkg/scheduler/api"
+)
+
+// policies answering the nodes not predicated before the deadline
+const (
+	// answers with an error, so that the scheduler fails to schedule the pod in this round
+	FilterTimeoutPolicyError = "error"
+	// answers the nodes as fit
+	FilterTimeoutPolicyPassAll = "pass-all"
+	// answers the nodes as failed
+	FilterTimeoutPolicyFailAll = "fail-all"
+)
+
+// filterContext returns the context with the deadline of --filter-timeout, if it is earlier than the one of the request.
+func (h *PredicateHandler) filterContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if h.cfg.FilterTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, h.cfg.FilterTimeout)
+}
+
+// timeoutResult answers the remaining nodes with the timeout policy, keeping the ones already predicated.
+func (h *PredicateHandler) timeoutResult(podName string, fitNodeNames []string, failedNodesMap map[string]string, remaining []string, err error) (*api.ExtenderFilterResult, error) {
+	glog.Warningf("Fail to predicate pod %s on %d nodes in time: %s, answer them by policy %s", podName, len(remaining), err, h.cfg.FilterTimeoutPolicy)
+
+	switch h.cfg.FilterTimeoutPolicy {
+	case FilterTimeoutPolicyPassAll:
+		fitNodeNames = append(fitNodeNames, remaining...)
+	case FilterTimeoutPolicyFailAll:
+		for _, nodeName := range remaining {
+			failedNodesMap[nodeName] = fmt.Sprintf("not predicated in time: %s", err)
+		}
+	default:
+		return nil, fmt.Errorf("fail to predicate pod %s on %d nodes in time: %w", podName, len(remaining), err)
+	}
+
+	return &api.ExtenderFilterResult{
+		NodeNames:   &fitNodeNames,
+		FailedNodes: failedNodesMap,
+	}, nil
+}
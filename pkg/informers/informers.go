@@ -0,0 +1,188 @@
+package informers
+
+import (
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NewInformerFactory returns a factory whose informers of nodes, pods and persistent volumes only cache
+// the objects and the fields read by the predicate, taking a fraction of the memory of the full objects.
+// The objects in the caches must not be written back to the API server, except the persistent volumes, which are not stripped.
+func NewInformerFactory(client kubernetes.Interface, resyncPeriod time.Duration) kubeinformers.SharedInformerFactory {
+	factory := kubeinformers.NewSharedInformerFactory(client, resyncPeriod)
+	// registered before the default ones, so that the listers of the factory share them
+	factory.InformerFor(&v1.Node{}, newNodeInformer)
+	factory.InformerFor(&v1.Pod{}, newPodInformer)
+	factory.InformerFor(&v1.PersistentVolume{}, newPersistentVolumeInformer)
+	return factory
+}
+
+// transformFunc returns the object to cache, and false to drop it.
+type transformFunc func(obj runtime.Object) (runtime.Object, bool)
+
+// transformListWatch applies the transform to the objects listed and watched.
+func transformListWatch(listFunc cache.ListFunc, watchFunc cache.WatchFunc, transform transformFunc) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			list, err := listFunc(options)
+			if err != nil {
+				return nil, err
+			}
+
+			items, err := meta.ExtractList(list)
+			if err != nil {
+				return nil, err
+			}
+			kept := make([]runtime.Object, 0, len(items))
+			for _, item := range items {
+				if obj, keep := transform(item); keep {
+					kept = append(kept, obj)
+				}
+			}
+			if err := meta.SetList(list, kept); err != nil {
+				return nil, err
+			}
+			return list, nil
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			w, err := watchFunc(options)
+			if err != nil {
+				return nil, err
+			}
+
+			return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+				if event.Type == watch.Error {
+					return event, true
+				}
+				obj, keep := transform(event.Object)
+				event.Object = obj
+				return event, keep
+			}), nil
+		},
+	}
+}
+
+func newNodeInformer(client kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	lw := transformListWatch(
+		func(options metav1.ListOptions) (runtime.Object, error) {
+			return client.CoreV1().Nodes().List(options)
+		},
+		func(options metav1.ListOptions) (watch.Interface, error) {
+			return client.CoreV1().Nodes().Watch(options)
+		},
+		func(obj runtime.Object) (runtime.Object, bool) {
+			if node, ok := obj.(*v1.Node); ok {
+				return StripNode(node), true
+			}
+			return obj, true
+		},
+	)
+	return cache.NewSharedIndexInformer(lw, &v1.Node{}, resyncPeriod, cache.Indexers{})
+}
+
+// ScheduledPodSelector selects the pods taking resources of nodes, which are scheduled and not terminated.
+var ScheduledPodSelector = fields.AndSelectors(
+	fields.OneTermNotEqualSelector("spec.nodeName", ""),
+	fields.OneTermNotEqualSelector("status.phase", string(v1.PodSucceeded)),
+	fields.OneTermNotEqualSelector("status.phase", string(v1.PodFailed)),
+).String()
+
+func newPodInformer(client kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	lw := transformListWatch(
+		func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = ScheduledPodSelector
+			return client.CoreV1().Pods(metav1.NamespaceAll).List(options)
+		},
+		func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = ScheduledPodSelector
+			return client.CoreV1().Pods(metav1.NamespaceAll).Watch(options)
+		},
+		func(obj runtime.Object) (runtime.Object, bool) {
+			if pod, ok := obj.(*v1.Pod); ok {
+				return StripPod(pod), true
+			}
+			return obj, true
+		},
+	)
+	return cache.NewSharedIndexInformer(lw, &v1.Pod{}, resyncPeriod, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+}
+
+func newPersistentVolumeInformer(client kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	lw := transformListWatch(
+		func(options metav1.ListOptions) (runtime.Object, error) {
+			return client.CoreV1().PersistentVolumes().List(options)
+		},
+		func(options metav1.ListOptions) (watch.Interface, error) {
+			return client.CoreV1().PersistentVolumes().Watch(options)
+		},
+		func(obj runtime.Object) (runtime.Object, bool) {
+			// the local volume source is immutable, so that a PV is never dropped after cached
+			if pv, ok := obj.(*v1.PersistentVolume); ok {
+				return pv, pv.Spec.Local != nil
+			}
+			return obj, true
+		},
+	)
+	return cache.NewSharedIndexInformer(lw, &v1.PersistentVolume{}, resyncPeriod, cache.Indexers{})
+}
+
+func stripObjectMeta(objectMeta metav1.ObjectMeta) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:              objectMeta.Name,
+		Namespace:         objectMeta.Namespace,
+		UID:               objectMeta.UID,
+		ResourceVersion:   objectMeta.ResourceVersion,
+		DeletionTimestamp: objectMeta.DeletionTimestamp,
+		Labels:            objectMeta.Labels,
+	}
+}
+
+// StripNode keeps the labels matched by the PV node affinity, the annotations and the resources of the node,
+// dropping the large parts of the status, such as the images and conditions.
+func StripNode(node *v1.Node) *v1.Node {
+	stripped := &v1.Node{
+		ObjectMeta: stripObjectMeta(node.ObjectMeta),
+	}
+	stripped.Annotations = node.Annotations
+	stripped.Status.Capacity = node.Status.Capacity
+	stripped.Status.Allocatable = node.Status.Allocatable
+	return stripped
+}
+
+// StripPod keeps the node, the PVC volumes and the resource requests of the containers of the pod.
+func StripPod(pod *v1.Pod) *v1.Pod {
+	stripped := &v1.Pod{
+		ObjectMeta: stripObjectMeta(pod.ObjectMeta),
+	}
+	stripped.Spec.NodeName = pod.Spec.NodeName
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+		stripped.Spec.Volumes = append(stripped.Spec.Volumes, v1.Volume{
+			Name: volume.Name,
+			VolumeSource: v1.VolumeSource{
+				PersistentVolumeClaim: volume.PersistentVolumeClaim,
+			},
+		})
+	}
+	for _, container := range pod.Spec.Containers {
+		stripped.Spec.Containers = append(stripped.Spec.Containers, v1.Container{
+			Name: container.Name,
+			Resources: v1.ResourceRequirements{
+				Requests: container.Resources.Requests,
+			},
+		})
+	}
+	stripped.Status.Phase = pod.Status.Phase
+	return stripped
+}
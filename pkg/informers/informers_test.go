@@ -0,0 +1,186 @@
+package informers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func fullPod() *v1.Pod {
+	pod := &v1.Pod{}
+	pod.Name = "pod1"
+	pod.Namespace = "ns1"
+	pod.ResourceVersion = "10"
+	pod.Annotations = map[string]string{"large": "value"}
+	pod.Spec.NodeName = "node1"
+	pod.Spec.Volumes = []v1.Volume{
+		{Name: "data", VolumeSource: v1.VolumeSource{PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: "pvc1"}}},
+		{Name: "config", VolumeSource: v1.VolumeSource{ConfigMap: &v1.ConfigMapVolumeSource{}}},
+	}
+	pod.Spec.Containers = []v1.Container{
+		{
+			Name:  "app",
+			Image: "app:latest",
+			Env:   []v1.EnvVar{{Name: "FOO", Value: "bar"}},
+			Resources: v1.ResourceRequirements{
+				Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+				Limits:   v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")},
+			},
+		},
+	}
+	pod.Status.Phase = v1.PodRunning
+	pod.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady}}
+	return pod
+}
+
+func TestStripPod(t *testing.T) {
+	stripped := StripPod(fullPod())
+	if stripped.Name != "pod1" || stripped.Namespace != "ns1" || stripped.ResourceVersion != "10" || stripped.Spec.NodeName != "node1" || stripped.Status.Phase != v1.PodRunning {
+		t.Fatalf("unexpected stripped pod %v", stripped)
+	}
+	if len(stripped.Spec.Volumes) != 1 || stripped.Spec.Volumes[0].PersistentVolumeClaim.ClaimName != "pvc1" {
+		t.Fatalf("expecting only the pvc volume kept, got %v", stripped.Spec.Volumes)
+	}
+	container := stripped.Spec.Containers[0]
+	if container.Resources.Requests.Cpu().String() != "1" || len(container.Resources.Limits) != 0 || len(container.Env) != 0 || len(container.Image) != 0 {
+		t.Fatalf("expecting only the requests of the container kept, got %v", container)
+	}
+	if len(stripped.Annotations) != 0 || len(stripped.Status.Conditions) != 0 {
+		t.Fatalf("expecting annotations and conditions dropped, got %v", stripped)
+	}
+}
+
+func TestStripNode(t *testing.T) {
+	node := &v1.Node{}
+	node.Name = "node1"
+	node.Labels = map[string]string{"zone": "a"}
+	node.Annotations = map[string]string{"published": "true"}
+	node.Status.Allocatable = v1.ResourceList{v1.ResourceCPU: resource.MustParse("8")}
+	node.Status.Capacity = v1.ResourceList{v1.ResourceCPU: resource.MustParse("8")}
+	node.Status.Images = []v1.ContainerImage{{Names: []string{"app:latest"}}}
+
+	stripped := StripNode(node)
+	if stripped.Labels["zone"] != "a" || stripped.Annotations["published"] != "true" ||
+		stripped.Status.Allocatable.Cpu().String() != "8" || stripped.Status.Capacity.Cpu().String() != "8" {
+		t.Fatalf("unexpected stripped node %v", stripped)
+	}
+	if len(stripped.Status.Images) != 0 {
+		t.Fatalf("expecting images dropped, got %v", stripped.Status.Images)
+	}
+}
+
+func TestTransformListWatch(t *testing.T) {
+	local := &v1.PersistentVolume{}
+	local.Name = "local"
+	local.Spec.Local = &v1.LocalVolumeSource{Path: "/tmp"}
+	remote := &v1.PersistentVolume{}
+	remote.Name = "remote"
+
+	fakeWatch := watch.NewFake()
+	lw := transformListWatch(
+		func(options metav1.ListOptions) (runtime.Object, error) {
+			return &v1.PersistentVolumeList{Items: []v1.PersistentVolume{*local, *remote}}, nil
+		},
+		func(options metav1.ListOptions) (watch.Interface, error) {
+			return fakeWatch, nil
+		},
+		func(obj runtime.Object) (runtime.Object, bool) {
+			pv := obj.(*v1.PersistentVolume)
+			return pv, pv.Spec.Local != nil
+		},
+	)
+
+	list, err := lw.List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if items := list.(*v1.PersistentVolumeList).Items; len(items) != 1 || items[0].Name != "local" {
+		t.Fatalf("expecting only the local pv listed, got %v", items)
+	}
+
+	w, err := lw.Watch(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	defer w.Stop()
+	go func() {
+		fakeWatch.Add(remote)
+		fakeWatch.Modify(local)
+	}()
+	select {
+	case event := <-w.ResultChan():
+		if event.Type != watch.Modified || event.Object.(*v1.PersistentVolume).Name != "local" {
+			t.Fatalf("expecting only the local pv watched, got %v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expecting the event of the local pv")
+	}
+}
+
+func TestInformerFactory(t *testing.T) {
+	stopCh := make(chan struct{})
+	fieldSelectors := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("watch") == "true" {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			select {
+			case <-stopCh:
+			case <-r.Context().Done():
+			}
+			return
+		}
+
+		switch r.URL.Path {
+		case "/api/v1/pods":
+			fieldSelectors <- r.URL.Query().Get("fieldSelector")
+			list := &v1.PodList{Items: []v1.Pod{*fullPod()}}
+			list.ResourceVersion = "10"
+			json.NewEncoder(w).Encode(list)
+		case "/api/v1/nodes":
+			json.NewEncoder(w).Encode(&v1.NodeList{})
+		case "/api/v1/persistentvolumes":
+			json.NewEncoder(w).Encode(&v1.PersistentVolumeList{})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	defer close(stopCh)
+
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	factory := NewInformerFactory(client, 0)
+	lister := factory.Core().V1().Pods().Lister()
+	factory.Start(stopCh)
+	for informer, synced := range factory.WaitForCacheSync(stopCh) {
+		if !synced {
+			t.Fatalf("fail to sync informer %v", informer)
+		}
+	}
+
+	if selector := <-fieldSelectors; selector != ScheduledPodSelector {
+		t.Fatalf("expecting pods listed by %s, got %s", ScheduledPodSelector, selector)
+	}
+	pods, err := lister.Pods("ns1").List(labels.Everything())
+	if err != nil || len(pods) != 1 {
+		t.Fatalf("expecting the pod listed, got %v, %v", pods, err)
+	}
+	if len(pods[0].Spec.Volumes) != 1 || len(pods[0].Annotations) != 0 {
+		t.Fatalf("expecting the stripped pod cached, got %v", pods[0])
+	}
+}
@@ -0,0 +1,129 @@
+package leaderelection
+
+import (
+	"fmt"
+
+	coordinationv1beta1 "k8s.io/api/coordination/v1beta1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	coordinationv1beta1client "k8s.io/client-go/kubernetes/typed/coordination/v1beta1"
+	rl "k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	LeasesResourceLock = "leases"
+)
+
+// NewResourceLock returns the lock of client-go's leader election for the lock type,
+// adding the lease lock the vendored client-go lacks.
+func NewResourceLock(lockType, namespace, name string, client clientset.Interface, lockConfig rl.ResourceLockConfig) (rl.Interface, error) {
+	if lockType == LeasesResourceLock {
+		return &LeaseLock{
+			LeaseMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      name,
+			},
+			Client:     client.CoordinationV1beta1(),
+			LockConfig: lockConfig,
+		}, nil
+	}
+	return rl.New(lockType, namespace, name, client.CoreV1(), lockConfig)
+}
+
+// LeaseLock stores the leader election record in the spec of a Lease,
+// in the same way as the lease lock added to client-go in Kubernetes 1.14.
+type LeaseLock struct {
+	LeaseMeta  metav1.ObjectMeta
+	Client     coordinationv1beta1client.LeasesGetter
+	LockConfig rl.ResourceLockConfig
+	lease      *coordinationv1beta1.Lease
+}
+
+func (l *LeaseLock) Get() (*rl.LeaderElectionRecord, error) {
+	lease, err := l.Client.Leases(l.LeaseMeta.Namespace).Get(l.LeaseMeta.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	l.lease = lease
+	return leaseSpecToRecord(&lease.Spec), nil
+}
+
+func (l *LeaseLock) Create(record rl.LeaderElectionRecord) error {
+	lease, err := l.Client.Leases(l.LeaseMeta.Namespace).Create(&coordinationv1beta1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: l.LeaseMeta.Namespace,
+			Name:      l.LeaseMeta.Name,
+		},
+		Spec: recordToLeaseSpec(&record),
+	})
+	if err != nil {
+		return err
+	}
+	l.lease = lease
+	return nil
+}
+
+func (l *LeaseLock) Update(record rl.LeaderElectionRecord) error {
+	if l.lease == nil {
+		return fmt.Errorf("lease %s is not got or created yet", l.Describe())
+	}
+
+	lease := l.lease.DeepCopy()
+	lease.Spec = recordToLeaseSpec(&record)
+	lease, err := l.Client.Leases(l.LeaseMeta.Namespace).Update(lease)
+	if err != nil {
+		return err
+	}
+	l.lease = lease
+	return nil
+}
+
+func (l *LeaseLock) RecordEvent(event string) {
+	if l.LockConfig.EventRecorder == nil || l.lease == nil {
+		return
+	}
+	message := fmt.Sprintf("%v %v", l.LockConfig.Identity, event)
+	l.LockConfig.EventRecorder.Event(&coordinationv1beta1.Lease{ObjectMeta: l.lease.ObjectMeta}, v1.EventTypeNormal, "LeaderElection", message)
+}
+
+func (l *LeaseLock) Identity() string {
+	return l.LockConfig.Identity
+}
+
+func (l *LeaseLock) Describe() string {
+	return fmt.Sprintf("%s/%s", l.LeaseMeta.Namespace, l.LeaseMeta.Name)
+}
+
+func leaseSpecToRecord(spec *coordinationv1beta1.LeaseSpec) *rl.LeaderElectionRecord {
+	record := &rl.LeaderElectionRecord{}
+	if spec.HolderIdentity != nil {
+		record.HolderIdentity = *spec.HolderIdentity
+	}
+	if spec.LeaseDurationSeconds != nil {
+		record.LeaseDurationSeconds = int(*spec.LeaseDurationSeconds)
+	}
+	if spec.LeaseTransitions != nil {
+		record.LeaderTransitions = int(*spec.LeaseTransitions)
+	}
+	if spec.AcquireTime != nil {
+		record.AcquireTime = metav1.Time{Time: spec.AcquireTime.Time}
+	}
+	if spec.RenewTime != nil {
+		record.RenewTime = metav1.Time{Time: spec.RenewTime.Time}
+	}
+	return record
+}
+
+func recordToLeaseSpec(record *rl.LeaderElectionRecord) coordinationv1beta1.LeaseSpec {
+	holderIdentity := record.HolderIdentity
+	leaseDurationSeconds := int32(record.LeaseDurationSeconds)
+	leaseTransitions := int32(record.LeaderTransitions)
+	return coordinationv1beta1.LeaseSpec{
+		HolderIdentity:       &holderIdentity,
+		LeaseDurationSeconds: &leaseDurationSeconds,
+		AcquireTime:          &metav1.MicroTime{Time: record.AcquireTime.Time},
+		RenewTime:            &metav1.MicroTime{Time: record.RenewTime.Time},
+		LeaseTransitions:     &leaseTransitions,
+	}
+}
@@ -0,0 +1,239 @@
+package leaderelection
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	coordinationv1beta1 "k8s.io/api/coordination/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	coordinationv1beta1client "k8s.io/client-go/kubernetes/typed/coordination/v1beta1"
+	"k8s.io/client-go/tools/leaderelection"
+	rl "k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+type memoryLeases struct {
+	lock    sync.Mutex
+	lease   *coordinationv1beta1.Lease
+	version int
+	fail    map[string]bool
+}
+
+// memoryLeasesClient is the client of a candidate, the methods not used by the lock are left unimplemented.
+type memoryLeasesClient struct {
+	coordinationv1beta1client.LeaseInterface
+	*memoryLeases
+	identity string
+}
+
+func (c *memoryLeasesClient) Leases(namespace string) coordinationv1beta1client.LeaseInterface {
+	return c
+}
+
+func (c *memoryLeasesClient) Get(name string, options metav1.GetOptions) (*coordinationv1beta1.Lease, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.fail[c.identity] {
+		return nil, fmt.Errorf("unreachable")
+	}
+	if c.lease == nil {
+		return nil, errors.NewNotFound(schema.GroupResource{Resource: "leases"}, name)
+	}
+	return c.lease.DeepCopy(), nil
+}
+
+func (c *memoryLeasesClient) Create(lease *coordinationv1beta1.Lease) (*coordinationv1beta1.Lease, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.lease != nil {
+		return nil, errors.NewAlreadyExists(schema.GroupResource{Resource: "leases"}, lease.Name)
+	}
+	return c.store(lease), nil
+}
+
+func (c *memoryLeasesClient) Update(lease *coordinationv1beta1.Lease) (*coordinationv1beta1.Lease, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.fail[c.identity] {
+		return nil, fmt.Errorf("unreachable")
+	}
+	if lease.ResourceVersion != c.lease.ResourceVersion {
+		return nil, errors.NewConflict(schema.GroupResource{Resource: "leases"}, lease.Name, fmt.Errorf("modified"))
+	}
+	return c.store(lease), nil
+}
+
+func (c *memoryLeasesClient) store(lease *coordinationv1beta1.Lease) *coordinationv1beta1.Lease {
+	c.version++
+	c.lease = lease.DeepCopy()
+	c.lease.ResourceVersion = strconv.Itoa(c.version)
+	return c.lease.DeepCopy()
+}
+
+func (l *memoryLeases) setFail(identity string, fail bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.fail[identity] = fail
+}
+
+func (l *memoryLeases) holder() string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.lease == nil || l.lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *l.lease.Spec.HolderIdentity
+}
+
+type leadingState struct {
+	lock    sync.Mutex
+	leading map[string]bool
+}
+
+func (s *leadingState) set(identity string, leading bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.leading[identity] = leading
+}
+
+func (s *leadingState) leaders() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	leaders := []string{}
+	for identity, leading := range s.leading {
+		if leading {
+			leaders = append(leaders, identity)
+		}
+	}
+	return leaders
+}
+
+func TestLeaseLock(t *testing.T) {
+	leases := &memoryLeases{fail: map[string]bool{}}
+	lock := &LeaseLock{
+		LeaseMeta:  metav1.ObjectMeta{Namespace: "kube-system", Name: "test"},
+		Client:     &memoryLeasesClient{memoryLeases: leases, identity: "a"},
+		LockConfig: rl.ResourceLockConfig{Identity: "a"},
+	}
+
+	if _, err := lock.Get(); !errors.IsNotFound(err) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+	if err := lock.Update(rl.LeaderElectionRecord{}); err == nil {
+		t.Fatal("expected err updating a lease not got or created yet")
+	}
+	// no event recorder is provided
+	lock.RecordEvent("became leader")
+
+	now := metav1.NewTime(time.Now().Truncate(time.Second))
+	record := rl.LeaderElectionRecord{
+		HolderIdentity:       "a",
+		LeaseDurationSeconds: 15,
+		AcquireTime:          now,
+		RenewTime:            now,
+	}
+	if err := lock.Create(record); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	record.LeaderTransitions = 2
+	if err := lock.Update(record); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	got, err := lock.Get()
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if got.HolderIdentity != "a" || got.LeaseDurationSeconds != 15 || got.LeaderTransitions != 2 || !got.RenewTime.Equal(&now) {
+		t.Fatalf("unexpected record %+v", got)
+	}
+	if lock.Identity() != "a" || lock.Describe() != "kube-system/test" {
+		t.Fatalf("unexpected identity %s or description %s", lock.Identity(), lock.Describe())
+	}
+}
+
+func TestLeaderElectionWithLeaseLock(t *testing.T) {
+	leases := &memoryLeases{fail: map[string]bool{}}
+	state := &leadingState{leading: map[string]bool{}}
+
+	cancels := map[string]context.CancelFunc{}
+	doneChs := map[string]chan struct{}{}
+	for _, identity := range []string{"a", "b"} {
+		identity := identity
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock: &LeaseLock{
+				LeaseMeta:  metav1.ObjectMeta{Namespace: "kube-system", Name: "test"},
+				Client:     &memoryLeasesClient{memoryLeases: leases, identity: identity},
+				LockConfig: rl.ResourceLockConfig{Identity: identity},
+			},
+			LeaseDuration: 1 * time.Second,
+			RenewDeadline: 500 * time.Millisecond,
+			RetryPeriod:   100 * time.Millisecond,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					state.set(identity, true)
+				},
+				OnStoppedLeading: func() {
+					state.set(identity, false)
+				},
+			},
+		})
+		if err != nil {
+			t.Fatalf("unexpected err: %s", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		doneCh := make(chan struct{})
+		cancels[identity] = cancel
+		doneChs[identity] = doneCh
+		go func() {
+			defer close(doneCh)
+			elector.Run(ctx)
+		}()
+	}
+
+	waitForLeaders := func(expectedCount int) []string {
+		var leaders []string
+		for i := 0; i < 50; i++ {
+			time.Sleep(100 * time.Millisecond)
+			leaders = state.leaders()
+			if len(leaders) == expectedCount {
+				return leaders
+			}
+		}
+		t.Fatalf("expected %d leaders, got %v", expectedCount, leaders)
+		return nil
+	}
+
+	leader := waitForLeaders(1)[0]
+	if leases.holder() != leader {
+		t.Fatalf("expected lease held by %s, got %s", leader, leases.holder())
+	}
+	other := "a"
+	if leader == "a" {
+		other = "b"
+	}
+
+	// the leader loses the leadership if it fails to renew, then the other one takes over once the lease expires
+	leases.setFail(leader, true)
+	<-doneChs[leader]
+	for i := 0; i < 50 && leases.holder() != other; i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if leases.holder() != other {
+		t.Fatalf("expected lease taken over by %s, got %s", other, leases.holder())
+	}
+	if leaders := waitForLeaders(1); leaders[0] != other {
+		t.Fatalf("expected leader %s, got %v", other, leaders)
+	}
+
+	cancels[other]()
+	<-doneChs[other]
+	waitForLeaders(0)
+	cancels[leader]()
+}
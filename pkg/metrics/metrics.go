@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "lpv_res_predicate"
+
+var (
+	// FilterCalls counts the filter calls by result, which is "success" or "error".
+	FilterCalls = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "filter_calls_total",
+			Help:      "Number of filter calls by result.",
+		},
+		[]string{"result"},
+	)
+
+	// FilterDuration observes the latency of filter calls in seconds.
+	FilterDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "filter_duration_seconds",
+			Help:      "Latency of filter calls in seconds.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+		},
+	)
+
+	// FilterNodeErrors counts the internal errors predicating a node by the failure policy applied,
+	// the reason, such as "not-synced" or "api-failure", and the kind of the object failing to be read, if any.
+	FilterNodeErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "filter_node_errors_total",
+			Help:      "Number of internal errors predicating a node by the failure policy applied, the reason and the object kind.",
+		},
+		[]string{"policy", "reason", "kind"},
+	)
+
+	// FilterCacheLookups counts the decisions of nodes looked up in the filter decision cache by result, which is "hit" or "miss".
+	FilterCacheLookups = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "filter_cache_lookups_total",
+			Help:      "Number of decisions of nodes looked up in the filter decision cache by result.",
+		},
+		[]string{"result"},
+	)
+
+	// FilterRecordsDropped counts the filter calls not recorded since the records queued to be written are full.
+	FilterRecordsDropped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "filter_records_dropped_total",
+			Help:      "Number of filter calls not recorded since the queue of records to be written is full.",
+		},
+	)
+
+	// LedgerDrifts counts the nodes whose reservation ledger drifts from the periodic full recompute.
+	LedgerDrifts = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "ledger_drifts_total",
+			Help:      "Number of nodes whose reservation ledger drifts from the periodic full recompute.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(FilterCalls, FilterDuration, FilterNodeErrors, FilterCacheLookups, FilterRecordsDropped, LedgerDrifts)
+}
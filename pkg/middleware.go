@@ -0,0 +1,202 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/golang/glog"
+	"k8s.io/apimachinery/pkg/util/rand"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+	"github.com/wu8685/lpv-res-predicate/pkg/handlers"
+)
+
+const (
+	RequestIDHeader = "X-Request-Id"
+
+	RequestIDMiddleware = "request-id"
+	AccessLogMiddleware = "access-log"
+	RecoveryMiddleware  = "recovery"
+	BodyLimitMiddleware = "body-limit"
+	TimeoutMiddleware   = "timeout"
+
+	// registered by pkg/middlewares/auth
+	AuthMiddleware = "auth"
+)
+
+func init() {
+	RegisterMiddlewareInit(RequestIDMiddleware, newRequestIDMiddleware)
+	RegisterMiddlewareInit(AccessLogMiddleware, newAccessLogMiddleware)
+	RegisterMiddlewareInit(RecoveryMiddleware, newRecoveryMiddleware)
+	RegisterMiddlewareInit(BodyLimitMiddleware, newBodyLimitMiddleware)
+	RegisterMiddlewareInit(TimeoutMiddleware, newTimeoutMiddleware)
+}
+
+// Middleware wraps the REST API of the named handler.
+type Middleware func(handlerName string, next http.HandlerFunc) http.HandlerFunc
+
+// MiddlewareInit returns a nil Middleware if the middleware is not enabled by the config.
+type MiddlewareInit func(*config.Config) (Middleware, error)
+
+// MiddlewareSkipper is implemented by handlers opting out of some middlewares.
+type MiddlewareSkipper interface {
+	SkipMiddlewares() []string
+}
+
+type namedMiddlewareInit struct {
+	name string
+	init MiddlewareInit
+}
+
+// RegisterMiddlewareInit appends a middleware to the chain, the middlewares registered earlier are outer.
+func RegisterMiddlewareInit(name string, middlewareInit MiddlewareInit) {
+	for _, registered := range middlewareInits {
+		if registered.name == name {
+			panic(fmt.Sprintf("middleware init %s already exist", name))
+		}
+	}
+
+	middlewareInits = append(middlewareInits, namedMiddlewareInit{name, middlewareInit})
+}
+
+var middlewareInits = []namedMiddlewareInit{}
+
+type namedMiddleware struct {
+	name       string
+	middleware Middleware
+}
+
+type middlewareChain []namedMiddleware
+
+func newMiddlewareChain(cfg *config.Config) (middlewareChain, error) {
+	chain := middlewareChain{}
+	for _, registered := range middlewareInits {
+		middleware, err := registered.init(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("fail to initialize middleware %s: %s", registered.name, err)
+		}
+		if middleware == nil {
+			glog.V(1).Infof("Middleware %s is disabled", registered.name)
+			continue
+		}
+		chain = append(chain, namedMiddleware{registered.name, middleware})
+	}
+	return chain, nil
+}
+
+// wrap applies the chain to a REST API of the handler, except the middlewares it opts out of.
+func (c middlewareChain) wrap(handlerName string, handler Handler, handlerFunc http.HandlerFunc) http.HandlerFunc {
+	skipped := map[string]bool{}
+	if skipper, ok := handler.(MiddlewareSkipper); ok {
+		for _, name := range skipper.SkipMiddlewares() {
+			skipped[name] = true
+		}
+	}
+
+	for i := len(c) - 1; i >= 0; i-- {
+		if skipped[c[i].name] {
+			continue
+		}
+		handlerFunc = c[i].middleware(handlerName, handlerFunc)
+	}
+	return handlerFunc
+}
+
+type requestIDKey struct{}
+
+// RequestID returns the ID of the request set by the request-id middleware.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestIDMiddleware(cfg *config.Config) (Middleware, error) {
+	return func(handlerName string, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if len(id) == 0 {
+				id = rand.String(16)
+			}
+
+			w.Header().Set(RequestIDHeader, id)
+			next(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		}
+	}, nil
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func newAccessLogMiddleware(cfg *config.Config) (Middleware, error) {
+	return func(handlerName string, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			startTime := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next(recorder, r)
+			glog.V(1).Infof("%s %s %d %s [%s] from %s, handled by %s", r.Method, r.URL.Path, recorder.status,
+				time.Now().Sub(startTime).String(), RequestID(r.Context()), r.RemoteAddr, handlerName)
+		}
+	}, nil
+}
+
+// ErrorResult is the response of an unexpected error,
+// whose Error field is recognized by kube-scheduler as the one of ExtenderFilterResult.
+type ErrorResult struct {
+	Error string
+}
+
+func newRecoveryMiddleware(cfg *config.Config) (Middleware, error) {
+	return func(handlerName string, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if p := recover(); p != nil {
+					glog.Errorf("Panic in handler %s for %s %s [%s]: %v\n%s", handlerName, r.Method, r.URL.Path, RequestID(r.Context()), p, debug.Stack())
+					handlers.WriteResponse(w, http.StatusInternalServerError, &ErrorResult{
+						Error: fmt.Sprintf("internal error in handler %s: %v", handlerName, p),
+					})
+				}
+			}()
+			next(w, r)
+		}
+	}, nil
+}
+
+func newBodyLimitMiddleware(cfg *config.Config) (Middleware, error) {
+	limit := cfg.Options.MaxRequestBodyBytes
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	return func(handlerName string, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next(w, r)
+		}
+	}, nil
+}
+
+// the timeout middleware sets the deadline of the request context, which is up to the handler to honor
+func newTimeoutMiddleware(cfg *config.Config) (Middleware, error) {
+	timeout := cfg.Options.RequestTimeout
+	if timeout <= 0 {
+		return nil, nil
+	}
+
+	return func(handlerName string, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next(w, r.WithContext(ctx))
+		}
+	}, nil
+}
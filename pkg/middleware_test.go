@@ -0,0 +1,122 @@
+package pkg
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+)
+
+type skippingHandler struct {
+	skipped []string
+}
+
+func (h *skippingHandler) RestInfos() []RestInfo {
+	return nil
+}
+
+func (h *skippingHandler) SkipMiddlewares() []string {
+	return h.skipped
+}
+
+func newTestMiddlewareChain(t *testing.T) middlewareChain {
+	chain, err := newMiddlewareChain(&config.Config{
+		Options: &config.OptionConfig{
+			MaxRequestBodyBytes: 8,
+			RequestTimeout:      time.Minute,
+		},
+	})
+	if err != nil {
+		t.Fatalf("fail to build middleware chain: %s", err)
+	}
+	return chain
+}
+
+func TestDuplicateMiddleware(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("expecting panic")
+		}
+	}()
+	RegisterMiddlewareInit(RecoveryMiddleware, newRecoveryMiddleware)
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	chain := newTestMiddlewareChain(t)
+	handlerFunc := chain.wrap("test", &skippingHandler{}, func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	handlerFunc(w, httptest.NewRequest("POST", "/test", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expecting status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+
+	result := &ErrorResult{}
+	if err := json.Unmarshal(w.Body.Bytes(), result); err != nil {
+		t.Fatalf("fail to decode response %q: %s", w.Body.String(), err)
+	}
+	if !strings.Contains(result.Error, "boom") {
+		t.Fatalf("expecting the panic in error, got %q", result.Error)
+	}
+}
+
+func TestSkipMiddleware(t *testing.T) {
+	chain := newTestMiddlewareChain(t)
+	handlerFunc := chain.wrap("test", &skippingHandler{skipped: []string{RecoveryMiddleware}}, func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("expecting panic not recovered")
+		}
+	}()
+	handlerFunc(httptest.NewRecorder(), httptest.NewRequest("POST", "/test", nil))
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	chain := newTestMiddlewareChain(t)
+	var got string
+	handlerFunc := chain.wrap("test", &skippingHandler{}, func(w http.ResponseWriter, r *http.Request) {
+		got = RequestID(r.Context())
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/test", nil)
+	r.Header.Set(RequestIDHeader, "abc")
+	handlerFunc(w, r)
+	if got != "abc" || w.Header().Get(RequestIDHeader) != "abc" {
+		t.Fatalf("expecting request id abc, got %q in context and %q in response", got, w.Header().Get(RequestIDHeader))
+	}
+
+	w = httptest.NewRecorder()
+	handlerFunc(w, httptest.NewRequest("POST", "/test", nil))
+	if len(got) == 0 || w.Header().Get(RequestIDHeader) != got {
+		t.Fatalf("expecting a generated request id, got %q in context and %q in response", got, w.Header().Get(RequestIDHeader))
+	}
+}
+
+func TestBodyLimitAndTimeoutMiddleware(t *testing.T) {
+	chain := newTestMiddlewareChain(t)
+	var readErr error
+	var hasDeadline bool
+	handlerFunc := chain.wrap("test", &skippingHandler{}, func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = ioutil.ReadAll(r.Body)
+		_, hasDeadline = r.Context().Deadline()
+	})
+
+	handlerFunc(httptest.NewRecorder(), httptest.NewRequest("POST", "/test", strings.NewReader("more than 8 bytes")))
+	if readErr == nil {
+		t.Fatal("expecting the body over limit fails to read")
+	}
+	if !hasDeadline {
+		t.Fatal("expecting the request context has a deadline")
+	}
+}
@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang/glog"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+
+	"github.com/wu8685/lpv-res-predicate/pkg"
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+	"github.com/wu8685/lpv-res-predicate/pkg/handlers"
+)
+
+const cacheSize = 4096
+
+func init() {
+	pkg.RegisterMiddlewareInit(pkg.AuthMiddleware, NewAuthMiddleware)
+}
+
+// userInfo is the identity of a request, from either the verified client certificate or the bearer token.
+type userInfo struct {
+	Username string
+	UID      string
+	Groups   []string
+	Extra    map[string]authenticationv1.ExtraValue
+}
+
+// delegatedAuth authenticates requests by TokenReview and authorizes them by SubjectAccessReview,
+// against the virtual resource named by the handler, like kube-rbac-proxy.
+type delegatedAuth struct {
+	cfg *config.Config
+
+	// token hash -> *userInfo, or nil if the token is invalid
+	authnCache *cache.LRUExpireCache
+	// authorization attributes -> bool
+	authzCache *cache.LRUExpireCache
+}
+
+// NewAuthMiddleware returns a nil Middleware if the delegated auth is not enabled.
+func NewAuthMiddleware(cfg *config.Config) (pkg.Middleware, error) {
+	if !cfg.Options.DelegatedAuth {
+		return nil, nil
+	}
+	if cfg.Client == nil {
+		return nil, fmt.Errorf("delegated auth requires a client of the API server")
+	}
+
+	a := &delegatedAuth{
+		cfg:        cfg,
+		authnCache: cache.NewLRUExpireCache(cacheSize),
+		authzCache: cache.NewLRUExpireCache(cacheSize),
+	}
+	return a.wrap, nil
+}
+
+func (a *delegatedAuth) wrap(handlerName string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := a.authenticate(r)
+		if err != nil {
+			glog.Errorf("Fail to authenticate %s %s: %s", r.Method, r.URL.Path, err)
+			handlers.WriteResponse(w, http.StatusInternalServerError, &pkg.ErrorResult{Error: fmt.Sprintf("fail to authenticate: %s", err)})
+			return
+		}
+		if user == nil {
+			handlers.WriteResponse(w, http.StatusUnauthorized, &pkg.ErrorResult{Error: "unauthorized"})
+			return
+		}
+
+		allowed, err := a.authorize(user, handlerName, r.Method)
+		if err != nil {
+			glog.Errorf("Fail to authorize %s to %s %s: %s", user.Username, r.Method, r.URL.Path, err)
+			handlers.WriteResponse(w, http.StatusInternalServerError, &pkg.ErrorResult{Error: fmt.Sprintf("fail to authorize: %s", err)})
+			return
+		}
+		if !allowed {
+			glog.V(2).Infof("Forbid %s to %s %s", user.Username, r.Method, r.URL.Path)
+			handlers.WriteResponse(w, http.StatusForbidden, &pkg.ErrorResult{
+				Error: fmt.Sprintf("user %s is forbidden to %s %s/%s %s", user.Username, verb(r.Method), a.cfg.Options.AuthResourceGroup, a.cfg.Options.AuthResource, handlerName),
+			})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// authenticate returns a nil user if the request is not authenticated.
+func (a *delegatedAuth) authenticate(r *http.Request) (*userInfo, error) {
+	// the client certificate is verified against --client-ca-file already
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		subject := r.TLS.VerifiedChains[0][0].Subject
+		return &userInfo{Username: subject.CommonName, Groups: subject.Organization}, nil
+	}
+
+	token := bearerToken(r)
+	if len(token) == 0 {
+		return nil, nil
+	}
+
+	key := fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+	if cached, exist := a.authnCache.Get(key); exist {
+		return cached.(*userInfo), nil
+	}
+
+	review, err := a.cfg.Client.AuthenticationV1().TokenReviews().Create(&authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var user *userInfo
+	if review.Status.Authenticated {
+		user = &userInfo{
+			Username: review.Status.User.Username,
+			UID:      review.Status.User.UID,
+			Groups:   review.Status.User.Groups,
+			Extra:    review.Status.User.Extra,
+		}
+	} else {
+		glog.V(2).Infof("Token is not authenticated: %s", review.Status.Error)
+	}
+	a.authnCache.Add(key, user, a.cfg.Options.AuthCacheTTL)
+	return user, nil
+}
+
+func (a *delegatedAuth) authorize(user *userInfo, handlerName, method string) (bool, error) {
+	if a.isAlwaysAllowed(user, handlerName) {
+		return true, nil
+	}
+
+	attributes := &authorizationv1.ResourceAttributes{
+		Verb:     verb(method),
+		Group:    a.cfg.Options.AuthResourceGroup,
+		Resource: a.cfg.Options.AuthResource,
+		Name:     handlerName,
+	}
+	key := fmt.Sprintf("%s/%s/%v/%v/%v", user.Username, user.UID, user.Groups, user.Extra, *attributes)
+	if cached, exist := a.authzCache.Get(key); exist {
+		return cached.(bool), nil
+	}
+
+	extra := map[string]authorizationv1.ExtraValue{}
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	review, err := a.cfg.Client.AuthorizationV1().SubjectAccessReviews().Create(&authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:               user.Username,
+			UID:                user.UID,
+			Groups:             user.Groups,
+			Extra:              extra,
+			ResourceAttributes: attributes,
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	a.authzCache.Add(key, review.Status.Allowed, a.cfg.Options.AuthCacheTTL)
+	return review.Status.Allowed, nil
+}
+
+// isAlwaysAllowed lets the identity of kube-scheduler call the extender verbs without SubjectAccessReview.
+func (a *delegatedAuth) isAlwaysAllowed(user *userInfo, handlerName string) bool {
+	if !contains(a.cfg.Options.AuthExtenderHandlers, handlerName) {
+		return false
+	}
+	return contains(a.cfg.Options.AuthAlwaysAllowUsers, user.Username)
+}
+
+func bearerToken(r *http.Request) string {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return ""
+	}
+	return strings.TrimSpace(parts[1])
+}
+
+func verb(method string) string {
+	switch method {
+	case http.MethodPost:
+		return "create"
+	case http.MethodPut:
+		return "update"
+	case http.MethodPatch:
+		return "patch"
+	case http.MethodDelete:
+		return "delete"
+	default:
+		return "get"
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
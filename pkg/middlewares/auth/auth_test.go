@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/wu8685/lpv-res-predicate/pkg/config"
+)
+
+// fakeAPIServer authenticates token "<user>-token" as the user, and allows user "admin" only.
+type fakeAPIServer struct {
+	tokenReviews  int
+	accessReviews int
+}
+
+func (s *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/tokenreviews"):
+		s.tokenReviews++
+		review := &authenticationv1.TokenReview{}
+		json.NewDecoder(r.Body).Decode(review)
+		if strings.HasSuffix(review.Spec.Token, "-token") {
+			review.Status.Authenticated = true
+			review.Status.User.Username = strings.TrimSuffix(review.Spec.Token, "-token")
+		}
+		json.NewEncoder(w).Encode(review)
+	case strings.HasSuffix(r.URL.Path, "/subjectaccessreviews"):
+		s.accessReviews++
+		review := &authorizationv1.SubjectAccessReview{}
+		json.NewDecoder(r.Body).Decode(review)
+		review.Status.Allowed = review.Spec.User == "admin"
+		json.NewEncoder(w).Encode(review)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestAuthHandler(t *testing.T, apiserver *fakeAPIServer) http.HandlerFunc {
+	server := httptest.NewServer(apiserver)
+	t.Cleanup(server.Close)
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	middleware, err := NewAuthMiddleware(&config.Config{
+		Client: client,
+		Options: &config.OptionConfig{
+			DelegatedAuth:        true,
+			AuthResourceGroup:    "lpvrespredicate.io",
+			AuthResource:         "handlers",
+			AuthCacheTTL:         time.Minute,
+			AuthAlwaysAllowUsers: []string{"system:kube-scheduler"},
+			AuthExtenderHandlers: []string{"filter"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	return middleware("status", func(w http.ResponseWriter, r *http.Request) {})
+}
+
+func request(handlerFunc http.HandlerFunc, token string) int {
+	r := httptest.NewRequest("GET", "/status", nil)
+	if len(token) > 0 {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handlerFunc(w, r)
+	return w.Code
+}
+
+func TestDelegatedAuth(t *testing.T) {
+	apiserver := &fakeAPIServer{}
+	handlerFunc := newTestAuthHandler(t, apiserver)
+
+	if code := request(handlerFunc, ""); code != http.StatusUnauthorized {
+		t.Fatalf("expecting %d without token, got %d", http.StatusUnauthorized, code)
+	}
+	if code := request(handlerFunc, "invalid"); code != http.StatusUnauthorized {
+		t.Fatalf("expecting %d with invalid token, got %d", http.StatusUnauthorized, code)
+	}
+	if code := request(handlerFunc, "guest-token"); code != http.StatusForbidden {
+		t.Fatalf("expecting %d for guest, got %d", http.StatusForbidden, code)
+	}
+	// the scheduler is only allowed to the extender handlers
+	if code := request(handlerFunc, "system:kube-scheduler-token"); code != http.StatusForbidden {
+		t.Fatalf("expecting %d for scheduler, got %d", http.StatusForbidden, code)
+	}
+	for i := 0; i < 3; i++ {
+		if code := request(handlerFunc, "admin-token"); code != http.StatusOK {
+			t.Fatalf("expecting %d for admin, got %d", http.StatusOK, code)
+		}
+	}
+
+	if apiserver.tokenReviews != 4 || apiserver.accessReviews != 3 {
+		t.Fatalf("expecting reviews cached, got %d token reviews and %d access reviews", apiserver.tokenReviews, apiserver.accessReviews)
+	}
+}
+
+func TestAlwaysAllowScheduler(t *testing.T) {
+	a := &delegatedAuth{cfg: &config.Config{Options: &config.OptionConfig{
+		AuthAlwaysAllowUsers: []string{"system:kube-scheduler"},
+		AuthExtenderHandlers: []string{"filter"},
+	}}}
+
+	if !a.isAlwaysAllowed(&userInfo{Username: "system:kube-scheduler"}, "filter") {
+		t.Fatal("expecting scheduler allowed to filter")
+	}
+	if a.isAlwaysAllowed(&userInfo{Username: "system:kube-scheduler"}, "status") {
+		t.Fatal("expecting scheduler not always allowed to status")
+	}
+	if a.isAlwaysAllowed(&userInfo{Username: "guest"}, "filter") {
+		t.Fatal("expecting guest not always allowed to filter")
+	}
+}
+
+func TestDisabledAuth(t *testing.T) {
+	middleware, err := NewAuthMiddleware(&config.Config{Options: &config.OptionConfig{}})
+	if err != nil || middleware != nil {
+		t.Fatalf("expecting auth disabled, got %v, %v", middleware, err)
+	}
+}
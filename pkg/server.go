@@ -1,19 +1,33 @@
 package pkg
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/golang/glog"
-	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	rl "k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/wu8685/lpv-res-predicate/pkg/config"
+	leaselock "github.com/wu8685/lpv-res-predicate/pkg/leaderelection"
 )
 
 type PredicateServer struct {
 	cfg *config.Config
+
+	lock        sync.Mutex
+	reloadables []Reloadable
 }
 
 func NewPredicateServer(cfg *config.Config) *PredicateServer {
@@ -22,33 +36,264 @@ func NewPredicateServer(cfg *config.Config) *PredicateServer {
 	}
 }
 
-func (s *PredicateServer) Run() error {
+// Run serves until stopCh is closed, then shuts down gracefully.
+func (s *PredicateServer) Run(stopCh <-chan struct{}) error {
+	chain, err := newMiddlewareChain(s.cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := validateHandlerNames(s.cfg.Options); err != nil {
+		return err
+	}
+
 	router := mux.NewRouter()
+	runnables := []Runnable{}
 	for name, init := range restHandlerInits {
+		if !IsHandlerEnabled(name, s.cfg.Options.Handlers) {
+			glog.V(1).Infof("Handler %s is disabled", name)
+			continue
+		}
+
 		restObj, err := init(s.cfg)
 		if err != nil {
 			return fmt.Errorf("fail to initialize rest handler %s: %s", name, err)
 		}
 
+		s.addReloadable(restObj)
+		if runnable, ok := restObj.(Runnable); ok {
+			runnables = append(runnables, runnable)
+		}
+
 		for _, rest := range restObj.RestInfos() {
-			path := buildPath(name, rest.Path)
+			path := HandlerPath(s.cfg.Options, name, rest.Path)
 			glog.V(0).Infof("Register REST API: %v - %s", path, rest.Methods)
-			router.Path(path).Methods(rest.Methods...).HandlerFunc(rest.Handler)
+			router.Path(path).Methods(rest.Methods...).HandlerFunc(chain.wrap(name, restObj, rest.Handler))
+		}
+	}
+
+	controllers := []Controller{}
+	for name, init := range controllerInits {
+		ctrl, err := init(s.cfg)
+		if err != nil {
+			return fmt.Errorf("fail to initialize controller %s: %s", name, err)
+		}
+		if ctrl == nil {
+			glog.V(1).Infof("Controller %s is disabled", name)
+			continue
+		}
+
+		glog.V(0).Infof("Register controller: %s", name)
+		controllers = append(controllers, ctrl)
+		s.addReloadable(ctrl)
+	}
+
+	var elector *leaderelection.LeaderElector
+	if s.cfg.Options.LeaderElect {
+		var err error
+		if elector, err = s.newLeaderElector(controllers); err != nil {
+			return fmt.Errorf("fail to initialize leader election: %s", err)
 		}
 	}
 
 	glog.V(1).Infof("Start informers")
-	s.cfg.InformerFactory.Start(wait.NeverStop)
+	s.cfg.InformerFactory.Start(stopCh)
+
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", s.cfg.Options.ListenPort),
+		Handler: router,
+	}
+	serve := server.ListenAndServe
+	if len(s.cfg.Options.TLSCertFile) > 0 {
+		reloader, err := newTLSReloader(s.cfg.Options.TLSCertFile, s.cfg.Options.TLSPrivateKeyFile, s.cfg.Options.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = reloader.TLSConfig()
+		serve = func() error {
+			return server.ListenAndServeTLS("", "")
+		}
+	}
+
+	// serve health checks while waiting for caches to sync, readiness reflects the sync state
+	glog.V(0).Infof("Start on %s, HTTPS: %v, client certificate required: %v", server.Addr, server.TLSConfig != nil, len(s.cfg.Options.ClientCAFile) > 0)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- serve()
+	}()
+
+	if err := s.waitForCacheSync(stopCh); err != nil {
+		return err
+	}
+
+	select {
+	case <-stopCh:
+		return s.shutdown(server)
+	default:
+	}
+	s.cfg.State.SetSynced()
+	glog.V(0).Infof("Informer caches are synced")
+
+	// handlers run on every replica, regardless of leadership
+	for _, runnable := range runnables {
+		go runnable.Run(stopCh)
+	}
+	if elector != nil {
+		go runLeaderElection(elector, stopCh)
+	} else {
+		runControllers(controllers, stopCh)
+	}
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-stopCh:
+		return s.shutdown(server)
+	}
+}
+
+// Reload delivers the reloaded options to the handlers and controllers supporting it.
+func (s *PredicateServer) Reload(options *config.OptionConfig) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, reloadable := range s.reloadables {
+		reloadable.Reload(options)
+	}
+}
+
+func (s *PredicateServer) addReloadable(obj interface{}) {
+	reloadable, ok := obj.(Reloadable)
+	if !ok {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.reloadables = append(s.reloadables, reloadable)
+}
+
+// newLeaderElector returns a leader elector running the controllers only when leading.
+func (s *PredicateServer) newLeaderElector(controllers []Controller) (*leaderelection.LeaderElector, error) {
+	opts := s.cfg.Options
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("fail to get hostname: %s", err)
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: s.cfg.Client.CoreV1().Events(opts.LeaderElectResourceNamespace)})
+	lock, err := leaselock.NewResourceLock(opts.LeaderElectResourceLock, opts.LeaderElectResourceNamespace, opts.LeaderElectResourceName, s.cfg.Client, rl.ResourceLockConfig{
+		Identity:      hostname + "_" + rand.String(8),
+		EventRecorder: broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "lpv-res-predicate"}),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.cfg.State.SetLeaderElection()
+	return leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: opts.LeaderElectLeaseDuration,
+		RenewDeadline: opts.LeaderElectRenewDeadline,
+		RetryPeriod:   opts.LeaderElectRetryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				s.cfg.State.SetLeading(true)
+				runControllers(controllers, ctx.Done())
+			},
+			OnStoppedLeading: func() {
+				if s.cfg.State.Leading() {
+					glog.V(0).Infof("Stop leading, stop controllers")
+					s.cfg.State.SetLeading(false)
+				}
+			},
+			OnNewLeader: func(identity string) {
+				glog.V(0).Infof("New leader is observed: %s", identity)
+				s.cfg.State.SetLeader(identity)
+			},
+		},
+	})
+}
+
+// runLeaderElection campaigns again once the leadership is lost, since the elector of client-go returns then.
+func runLeaderElection(elector *leaderelection.LeaderElector, stopCh <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+
+	for {
+		elector.Run(ctx)
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+	}
+}
 
-	addr := fmt.Sprintf(":%d", s.cfg.Options.ListenPort)
-	glog.V(0).Infof("Start on %s", addr)
-	return http.ListenAndServe(addr, router)
+func runControllers(controllers []Controller, stopCh <-chan struct{}) {
+	for _, ctrl := range controllers {
+		go ctrl.Run(stopCh)
+	}
 }
 
-func buildPath(name, subPath string) string {
-	subPath = strings.Trim(subPath, "/")
-	if len(subPath) == 0 {
-		return "/" + strings.Trim(name, "/")
+// waitForCacheSync returns an error if the caches are not synced in time, or nil if stopped meanwhile.
+func (s *PredicateServer) waitForCacheSync(stopCh <-chan struct{}) error {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	syncStopCh := make(chan struct{})
+	go func() {
+		defer close(syncStopCh)
+		select {
+		case <-stopCh:
+		case <-time.After(s.cfg.Options.CacheSyncTimeout):
+		case <-doneCh:
+		}
+	}()
+
+	for informerType, synced := range s.cfg.InformerFactory.WaitForCacheSync(syncStopCh) {
+		if !synced {
+			select {
+			case <-stopCh:
+				return nil
+			default:
+			}
+			return fmt.Errorf("timed out waiting for cache of %v to sync in %s", informerType, s.cfg.Options.CacheSyncTimeout)
+		}
+	}
+	return nil
+}
+
+// shutdown marks the server not ready and keeps serving for the drain period,
+// so that the clients stop sending requests before the listener is closed.
+// Then it waits for the in-flight requests to finish.
+func (s *PredicateServer) shutdown(server *http.Server) error {
+	s.cfg.State.SetShuttingDown()
+	glog.V(0).Infof("Shutting down, keep serving for %s before closing the listener", s.cfg.Options.ShutdownDrainPeriod)
+	time.Sleep(s.cfg.Options.ShutdownDrainPeriod)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Options.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("fail to wait for in-flight requests in %s: %s", s.cfg.Options.ShutdownTimeout, err)
+	}
+
+	glog.V(0).Infof("Server is shut down")
+	return nil
+}
+
+// joinPath joins the path segments, ignoring the empty ones.
+func joinPath(segments ...string) string {
+	parts := []string{}
+	for _, segment := range segments {
+		if segment = strings.Trim(segment, "/"); len(segment) > 0 {
+			parts = append(parts, segment)
+		}
 	}
-	return fmt.Sprintf("/%s/%s", strings.Trim(name, "/"), subPath)
+	return "/" + strings.Join(parts, "/")
 }
\ No newline at end of file
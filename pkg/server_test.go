@@ -2,15 +2,19 @@ package pkg
 
 import "testing"
 
-func TestBuildPath(t *testing.T) {
-	if "/a" != buildPath("a", "") {
+func TestJoinPath(t *testing.T) {
+	if "/a" != joinPath("a", "") {
 		t.Fatal()
 	}
-	if "/a" != buildPath("/a/", "") {
+	if "/a" != joinPath("/a/", "") {
 		t.Fatal()
 	}
 
-	if "/a/b" != buildPath("/a/", "/b/") {
+	if "/a/b" != joinPath("/a/", "/b/") {
+		t.Fatal()
+	}
+
+	if "/prefix/a/b" != joinPath("/prefix/", "", "a", "b/") {
 		t.Fatal()
 	}
 }
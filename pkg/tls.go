@@ -0,0 +1,164 @@
+package pkg
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// tlsReloader serves the certificate and the client CA bundle from files,
+// and reloads them once the files are modified, so that rotated files take effect without restart.
+type tlsReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	lock        sync.Mutex
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+	clientCAs   *x509.CertPool
+	caModTime   time.Time
+}
+
+func newTLSReloader(certFile, keyFile, clientCAFile string) (*tlsReloader, error) {
+	r := &tlsReloader{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+	}
+
+	// fail fast on malformed files
+	if _, err := r.GetCertificate(nil); err != nil {
+		return nil, err
+	}
+	if len(clientCAFile) > 0 {
+		if _, err := r.getClientCAs(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// TLSConfig builds the tls config of the server. It requires and verifies client certificates
+// against the client CA bundle, if the bundle is provided.
+func (r *tlsReloader) TLSConfig() *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+
+	if len(r.clientCAFile) > 0 {
+		cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			clientCAs, err := r.getClientCAs()
+			if err != nil {
+				return nil, err
+			}
+
+			return &tls.Config{
+				MinVersion:     tls.VersionTLS12,
+				GetCertificate: r.GetCertificate,
+				ClientAuth:     tls.RequireAndVerifyClientCert,
+				ClientCAs:      clientCAs,
+			}, nil
+		}
+	}
+	return cfg
+}
+
+func (r *tlsReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certModTime, err := modTime(r.certFile)
+	if err != nil {
+		return nil, err
+	}
+	keyModTime, err := modTime(r.keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.cert != nil && certModTime.Equal(r.certModTime) && keyModTime.Equal(r.keyModTime) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			// the cert and key files may be in the middle of rotation, keep serving the old one.
+			// The failed files are not loaded again until they are modified, instead of on every handshake.
+			glog.Errorf("Fail to reload certificate %s and key %s, keep the old one: %s", r.certFile, r.keyFile, err)
+			r.certModTime = certModTime
+			r.keyModTime = keyModTime
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("fail to load certificate %s and key %s: %s", r.certFile, r.keyFile, err)
+	}
+
+	if r.cert != nil {
+		glog.V(0).Infof("Reload certificate %s and key %s", r.certFile, r.keyFile)
+	}
+	r.cert = &cert
+	r.certModTime = certModTime
+	r.keyModTime = keyModTime
+	return r.cert, nil
+}
+
+func (r *tlsReloader) getClientCAs() (*x509.CertPool, error) {
+	caModTime, err := modTime(r.clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.clientCAs != nil && caModTime.Equal(r.caModTime) {
+		return r.clientCAs, nil
+	}
+
+	pool, err := loadCertPool(r.clientCAFile)
+	if err != nil {
+		if r.clientCAs != nil {
+			glog.Errorf("Fail to reload client CA bundle %s, keep the old one: %s", r.clientCAFile, err)
+			r.caModTime = caModTime
+			return r.clientCAs, nil
+		}
+		return nil, err
+	}
+
+	if r.clientCAs != nil {
+		glog.V(0).Infof("Reload client CA bundle %s", r.clientCAFile)
+	}
+	r.clientCAs = pool
+	r.caModTime = caModTime
+	return r.clientCAs, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read client CA bundle %s: %s", file, err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in client CA bundle %s", file)
+	}
+	return pool, nil
+}
+
+func modTime(file string) (time.Time, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("fail to stat %s: %s", file, err)
+	}
+	return info.ModTime(), nil
+}
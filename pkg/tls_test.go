@@ -0,0 +1,105 @@
+package pkg
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/cert"
+)
+
+func TestTLSReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls-reloader")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	writeCertKey(t, certFile, keyFile, "first")
+	writeCertKey(t, caFile, filepath.Join(dir, "ca.key"), "ca")
+
+	reloader, err := newTLSReloader(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	first, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	tlsConfig, err := reloader.TLSConfig().GetConfigForClient(nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if tlsConfig.ClientCAs == nil {
+		t.Fatal("expected client CAs")
+	}
+
+	// rotate
+	writeCertKey(t, certFile, keyFile, "second")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	os.Chtimes(keyFile, future, future)
+
+	second, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if bytes.Equal(first.Certificate[0], second.Certificate[0]) {
+		t.Fatal("expected certificate reloaded")
+	}
+
+	// broken files keep the old certificate
+	ioutil.WriteFile(certFile, []byte("broken"), 0600)
+	future = future.Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+
+	third, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if !bytes.Equal(second.Certificate[0], third.Certificate[0]) {
+		t.Fatal("expected the old certificate kept")
+	}
+	// the broken files are not loaded again until modified
+	if !reloader.certModTime.Equal(future) {
+		t.Fatalf("expected the modification time of the failed reload recorded, got %s", reloader.certModTime)
+	}
+
+	if _, err := newTLSReloader(certFile, keyFile, ""); err == nil {
+		t.Fatal("expected err for broken certificate")
+	}
+
+	// fixed files are reloaded
+	writeCertKey(t, certFile, keyFile, "fourth")
+	future = future.Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	os.Chtimes(keyFile, future, future)
+
+	fourth, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if bytes.Equal(second.Certificate[0], fourth.Certificate[0]) {
+		t.Fatal("expected certificate reloaded once fixed")
+	}
+}
+
+func writeCertKey(t *testing.T, certFile, keyFile, host string) {
+	certPEM, keyPEM, err := cert.GenerateSelfSignedCertKey(host, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+}